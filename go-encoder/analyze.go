@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+	"strconv"
+
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/cache"
+)
+
+// Bucket is count of values in range [Min, Max].
+type Bucket struct {
+	Min   int
+	Max   int
+	Count int
+}
+
+func (s Bucket) String() string {
+	if s.Min == s.Max {
+		return strconv.Itoa(s.Min)
+	}
+	return strconv.Itoa(s.Min) + "-" + strconv.Itoa(s.Max)
+}
+
+// Histogram counts values in buckets of powers of two, 0, 1, 2-3, 4-7 and so on.
+type Histogram []Bucket
+
+func (s *Histogram) Add(v int) {
+	i := bits.Len(uint(v))
+	for len(*s) <= i {
+		n := len(*s)
+		b := Bucket{}
+		if n > 0 {
+			b = Bucket{Min: 1 << (n - 1), Max: 1<<n - 1}
+		}
+		*s = append(*s, b)
+	}
+	(*s)[i].Count++
+}
+
+// AnalyzeStats is how far samples can be compressed, and how close cache codec is to it.
+// Entropy is empirical, in bits per sample, entropy of higher orders does not count size of model,
+// so ideal size is by entropy of order zero of samples or of their deltas, whichever is smaller.
+type AnalyzeStats struct {
+	NumSamples        int
+	NumDistinct       int
+	Entropy           [3]float64 // of sample given previous 0, 1 and 2 samples
+	DeltaEntropy      float64    // of difference to previous sample
+	CacheSize         int
+	NumCacheMisses    int
+	CacheRanks        Histogram // of index of sample in cache, before sample is added
+	CacheRankEntropy  float64   // of index, with miss as one more index
+	RunsEqual         Histogram // of lengths of runs of same sample
+	RunsCacheHits     Histogram // of lengths of runs of samples in cache
+	RunsCacheMisses   Histogram // of lengths of runs of samples not in cache
+	Size              int       // of samples as 16 bits
+	IdealSize         int       // by entropy
+	IdealRatio        float64
+	EncodedSize       int // by cache codec
+	Ratio             float64
+	CacheEncoderStats CacheSampleEncoderStats
+	GraphStats        GraphTransitionEncoderStats
+}
+
+// entropy of counts of symbols of context, and of total number of symbols.
+// It is zero when there are no symbols, as of input shorter than order.
+func entropy(counts map[uint64]int, contexts map[uint64]int, contextOf func(uint64) uint64, n int) float64 {
+	if n <= 0 {
+		return 0
+	}
+	var h float64
+	for k, c := range counts {
+		h -= float64(c) * math.Log2(float64(c)/float64(contexts[contextOf(k)]))
+	}
+	return h / float64(n)
+}
+
+// analyzeSamples counts statistics of samples, cache is of same policy as of encoder and is reset at keyframes.
+func analyzeSamples(encoderConfig CacheSampleEncoderConfig, cacheConfig cache.Config, samples []uint16) (AnalyzeStats, error) {
+	stats := AnalyzeStats{NumSamples: len(samples), CacheSize: cacheConfig.Size, Size: 2 * len(samples)}
+	if len(samples) == 0 {
+		return stats, nil
+	}
+
+	// symbol is sample in low 16 bits, context is previous samples above it
+	var orders [3]map[uint64]int
+	for k := range orders {
+		orders[k] = make(map[uint64]int)
+	}
+	deltas := make(map[uint64]int)
+
+	c := cache.New(cacheConfig)
+	ranks := make(map[uint64]int)
+	runEqual, runHits, runMisses := 0, 0, 0
+
+	for i, v := range samples {
+		var context uint64
+		for k := range orders {
+			if i >= k {
+				orders[k][context<<16|uint64(v)]++
+			}
+			if i > k {
+				context = context<<16 | uint64(samples[i-k-1])
+			}
+		}
+
+		var delta int
+		if i > 0 {
+			delta = int(int16(v)) - int(int16(samples[i-1]))
+		}
+		deltas[uint64(delta+(1<<16))]++
+
+		if i > 0 && v == samples[i-1] {
+			runEqual++
+		} else {
+			if runEqual > 0 {
+				stats.RunsEqual.Add(runEqual)
+			}
+			runEqual = 1
+		}
+
+		if encoderConfig.KeyframeInterval > 0 && i%encoderConfig.KeyframeInterval == 0 {
+			c.Reset()
+		}
+		if rank := c.Index(v); rank >= 0 {
+			stats.CacheRanks.Add(rank)
+			ranks[uint64(rank)]++
+			if runMisses > 0 {
+				stats.RunsCacheMisses.Add(runMisses)
+				runMisses = 0
+			}
+			runHits++
+		} else {
+			stats.NumCacheMisses++
+			ranks[math.MaxUint64]++
+			if runHits > 0 {
+				stats.RunsCacheHits.Add(runHits)
+				runHits = 0
+			}
+			runMisses++
+		}
+		c.Add(v)
+	}
+	stats.RunsEqual.Add(runEqual)
+	if runHits > 0 {
+		stats.RunsCacheHits.Add(runHits)
+	}
+	if runMisses > 0 {
+		stats.RunsCacheMisses.Add(runMisses)
+	}
+
+	stats.NumDistinct = len(orders[0])
+	for k := range orders {
+		contexts := make(map[uint64]int)
+		for key, count := range orders[k] {
+			contexts[key>>16] += count
+		}
+		// first samples have no context of order
+		stats.Entropy[k] = entropy(orders[k], contexts, func(key uint64) uint64 { return key >> 16 }, len(samples)-k)
+	}
+	single := func(uint64) uint64 { return 0 }
+	stats.DeltaEntropy = entropy(deltas, map[uint64]int{0: len(samples)}, single, len(samples))
+	stats.CacheRankEntropy = entropy(ranks, map[uint64]int{0: len(samples)}, single, len(samples))
+
+	stats.IdealSize = int(math.Ceil(min(stats.Entropy[0], stats.DeltaEntropy) * float64(len(samples)) / 8))
+	if stats.IdealSize > 0 {
+		stats.IdealRatio = float64(stats.Size) / float64(stats.IdealSize)
+	}
+
+	encoder := NewCacheSampleEncoder(encoderConfig, cache.New(cacheConfig), bufio.NewWriter(io.Discard))
+	graph := NewGraphTransitionEncoder()
+	for _, v := range samples {
+		if err := encoder.Write(v); err != nil {
+			return stats, err
+		}
+		if err := graph.Write(v); err != nil {
+			return stats, err
+		}
+	}
+	if err := encoder.FlushBuffer(); err != nil {
+		return stats, err
+	}
+	stats.CacheEncoderStats, stats.GraphStats = encoder.Stats(), graph.Stats()
+	stats.EncodedSize = int(encoder.Size())
+	if stats.EncodedSize > 0 {
+		stats.Ratio = float64(stats.Size) / float64(stats.EncodedSize)
+	}
+	return stats, nil
+}
+
+// analyze writes statistics of samples of input as text or JSON.
+func analyze(asJSON bool, encoderConfig CacheSampleEncoderConfig, cacheConfig cache.Config, inputConfig InputConfig, r io.Reader, w io.Writer) error {
+	sampleReader, _, err := newSampleReader(inputConfig, r)
+	if err != nil {
+		return err
+	}
+	samples, err := readAllSamples(sampleReader)
+	if err != nil {
+		return err
+	}
+
+	stats, err := analyzeSamples(encoderConfig, cacheConfig, samples)
+	if err != nil {
+		return err
+	}
+
+	if asJSON {
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(stats)
+	}
+	return writeAnalyzeText(stats, w)
+}
+
+func writeAnalyzeText(stats AnalyzeStats, w io.Writer) error {
+	var err error
+	printf := func(format string, args ...any) {
+		if err == nil {
+			_, err = fmt.Fprintf(w, format, args...)
+		}
+	}
+	histogram := func(name string, h Histogram) {
+		printf("%s:\n", name)
+		for _, b := range h {
+			if b.Count > 0 {
+				printf("  %-12s %d\n", b, b.Count)
+			}
+		}
+	}
+
+	printf("samples: %d\n", stats.NumSamples)
+	printf("distinct: %d\n", stats.NumDistinct)
+	for k, h := range stats.Entropy {
+		printf("entropy order %d: %.3f bits\n", k, h)
+	}
+	printf("entropy of delta: %.3f bits\n", stats.DeltaEntropy)
+	printf("cache size: %d misses: %d rank entropy: %.3f bits\n", stats.CacheSize, stats.NumCacheMisses, stats.CacheRankEntropy)
+	histogram("cache ranks", stats.CacheRanks)
+	histogram("runs of equal samples", stats.RunsEqual)
+	histogram("runs of cache hits", stats.RunsCacheHits)
+	histogram("runs of cache misses", stats.RunsCacheMisses)
+	printf("size: %d ideal: %d ratio: %.3f\n", stats.Size, stats.IdealSize, stats.IdealRatio)
+	printf("encoded: %d ratio: %.3f\n", stats.EncodedSize, stats.Ratio)
+	printf("cache encoder: %+v\n", stats.CacheEncoderStats)
+	printf("graph: %+v\n", stats.GraphStats)
+	return err
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/cache"
+)
+
+func TestAnalyzeSamples(t *testing.T) {
+	config := CacheSampleEncoderConfig{
+		EncodedSeqMaxLen:    (1 << 13) - 1,
+		NotEncodedSeqMaxLen: (1 << 7) - 1,
+		ByteOrder:           binary.LittleEndian,
+	}
+
+	var samples []uint16
+	for range 1000 {
+		samples = append(samples, 1, 1, 2)
+	}
+
+	stats, err := analyzeSamples(config, cache.Config{Size: 1 << 10}, samples)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	near := func(a, b float64) bool { return math.Abs(a-b) < 1e-3 }
+	if stats.NumSamples != 3000 || stats.NumDistinct != 2 || stats.NumCacheMisses != 2 {
+		t.Errorf("stats(%+v)", stats)
+	}
+	if h := -(2*math.Log2(2.0/3) + math.Log2(1.0/3)) / 3; !near(stats.Entropy[0], h) {
+		t.Errorf("entropy of order 0(%f) != %f", stats.Entropy[0], h)
+	}
+	if !near(stats.Entropy[2], 0) {
+		t.Errorf("entropy of order 2(%f) != 0", stats.Entropy[2])
+	}
+	if stats.Entropy[1] <= stats.Entropy[2] || stats.Entropy[1] >= stats.Entropy[0] {
+		t.Errorf("entropy of order 1(%f) is not between others", stats.Entropy[1])
+	}
+
+	if exp := (Histogram{{Min: 0, Max: 0, Count: 1999}, {Min: 1, Max: 1, Count: 999}}); len(stats.CacheRanks) != 2 || stats.CacheRanks[0] != exp[0] || stats.CacheRanks[1] != exp[1] {
+		t.Errorf("cache ranks(%v) != %v", stats.CacheRanks, exp)
+	}
+	if n := stats.RunsEqual[1].Count + stats.RunsEqual[2].Count; n != 2000 || stats.RunsEqual[2].Count != 1000 {
+		t.Errorf("runs of equal samples(%v)", stats.RunsEqual)
+	}
+	if stats.IdealRatio <= stats.Ratio || stats.EncodedSize == 0 || stats.CacheEncoderStats.NumTotalSamples != 3000 || stats.GraphStats.NumFrom != 2 {
+		t.Errorf("stats(%+v)", stats)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/cache"
+)
+
+type BaselineConfig struct {
+	Path         string  // zip archive with recordings, or directory of WAV
+	BaselinePath string  // JSON of Baseline
+	Update       bool    // write baseline instead of comparing with it
+	Tolerance    float64 // fraction encoded size can grow by
+}
+
+// Baseline is compressed sizes of recordings to detect regressions.
+type Baseline struct {
+	Size        int64            `json:"size"`
+	EncodedSize int64            `json:"encoded_size"`
+	Ratio       float64          `json:"ratio"`
+	Files       map[string]int64 `json:"files"` // encoded size by name
+}
+
+func measureBaseline(path string, encoderConfig CacheSampleEncoderConfig, cacheConfig cache.Config) (Baseline, error) {
+	baseline := Baseline{Files: make(map[string]int64)}
+	err := walkRecordings(path, func(name string, data []byte) error {
+		encoded, err := encodeBytes(CacheCodec{}, encoderConfig, cacheConfig, data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		baseline.Size += int64(len(data))
+		baseline.EncodedSize += int64(len(encoded))
+		baseline.Files[name] = int64(len(encoded))
+		return nil
+	})
+	if baseline.EncodedSize > 0 {
+		baseline.Ratio = float64(baseline.Size) / float64(baseline.EncodedSize)
+	}
+	return baseline, err
+}
+
+// compareBaseline encodes recordings and fails if any is larger than in baseline beyond tolerance, or writes new baseline.
+func compareBaseline(config BaselineConfig, encoderConfig CacheSampleEncoderConfig, cacheConfig cache.Config, w io.Writer) error {
+	current, err := measureBaseline(config.Path, encoderConfig, cacheConfig)
+	if err != nil {
+		return err
+	}
+
+	if config.Update {
+		b, err := json.MarshalIndent(current, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(w, "baseline of %d files, ratio %.4f\n", len(current.Files), current.Ratio)
+		return os.WriteFile(config.BaselinePath, append(b, '\n'), 0644)
+	}
+
+	b, err := os.ReadFile(config.BaselinePath)
+	if err != nil {
+		return err
+	}
+	var baseline Baseline
+	if err := json.Unmarshal(b, &baseline); err != nil {
+		return err
+	}
+
+	var names []string
+	for name := range baseline.Files {
+		names = append(names, name)
+	}
+	for name := range current.Files {
+		if _, ok := baseline.Files[name]; !ok {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	numRegressions := 0
+	for _, name := range names {
+		expected, inBaseline := baseline.Files[name]
+		got, inCurrent := current.Files[name]
+		switch {
+		case !inCurrent:
+			numRegressions++
+			fmt.Fprintf(w, "MISSING %s\n", name)
+		case !inBaseline:
+			fmt.Fprintf(w, "NEW %s %d bytes\n", name, got)
+		case float64(got) > float64(expected)*(1+config.Tolerance):
+			numRegressions++
+			fmt.Fprintf(w, "REGRESSION %s %d -> %d bytes (%+.2f%%)\n", name, expected, got, 100*(float64(got)/float64(expected)-1))
+		case got < expected:
+			fmt.Fprintf(w, "IMPROVEMENT %s %d -> %d bytes (%+.2f%%)\n", name, expected, got, 100*(float64(got)/float64(expected)-1))
+		}
+	}
+	fmt.Fprintf(w, "ratio %.4f -> %.4f\n", baseline.Ratio, current.Ratio)
+
+	if numRegressions > 0 {
+		return fmt.Errorf("%d of %d files regressed beyond tolerance %g", numRegressions, len(names), config.Tolerance)
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/cache"
+)
+
+const batchEncodedExt = ".brainwire"
+
+type BatchConfig struct {
+	InDir   string
+	OutDir  string // mirror of InDir with encoded files
+	Workers int
+	Verify  bool // decode and compare with original
+}
+
+type BatchResult struct {
+	Path        string // relative to InDir
+	Size        int64
+	EncodedSize int64
+	Verified    bool
+	Err         error
+}
+
+func (s BatchResult) Ratio() float64 {
+	if s.EncodedSize == 0 {
+		return 0
+	}
+	return float64(s.Size) / float64(s.EncodedSize)
+}
+
+// batch encodes every WAV in directory concurrently and writes summary as CSV.
+func batch(config BatchConfig, encoderConfig CacheSampleEncoderConfig, cacheConfig cache.Config, w *bufio.Writer) error {
+	if config.InDir == "" || config.OutDir == "" {
+		return fmt.Errorf("batch requires input and output directories")
+	}
+
+	var paths []string
+	err := filepath.WalkDir(config.InDir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() && strings.EqualFold(filepath.Ext(p), ".wav") {
+			rel, err := filepath.Rel(config.InDir, p)
+			if err != nil {
+				return err
+			}
+			paths = append(paths, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	results := make([]BatchResult, len(paths))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for range max(config.Workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				results[i] = batchFile(config, encoderConfig, cacheConfig, paths[i])
+			}
+		}()
+	}
+	for i := range paths {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return writeBatchSummary(results, w)
+}
+
+func batchFile(config BatchConfig, encoderConfig CacheSampleEncoderConfig, cacheConfig cache.Config, rel string) BatchResult {
+	result := BatchResult{Path: rel}
+
+	original, err := os.ReadFile(filepath.Join(config.InDir, rel))
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	result.Size = int64(len(original))
+
+	encoded, err := encodeBytes(CacheCodec{}, encoderConfig, cacheConfig, original)
+	if err != nil {
+		result.Err = err
+		return result
+	}
+	result.EncodedSize = int64(len(encoded))
+
+	out := filepath.Join(config.OutDir, rel+batchEncodedExt)
+	if err := os.MkdirAll(filepath.Dir(out), 0755); err != nil {
+		result.Err = err
+		return result
+	}
+	if err := os.WriteFile(out, encoded, 0644); err != nil {
+		result.Err = err
+		return result
+	}
+
+	if !config.Verify {
+		return result
+	}
+
+	if result.Err = verifyBytes(encoderConfig, cacheConfig, original, encoded); result.Err == nil {
+		result.Verified = true
+	}
+	return result
+}
+
+// encodeBytes encodes WAV in memory.
+func encodeBytes(codec Codec, encoderConfig CacheSampleEncoderConfig, cacheConfig cache.Config, original []byte) ([]byte, error) {
+	var encoded bytes.Buffer
+	w := bufio.NewWriter(&encoded)
+	if err := encode(codec, encoderConfig, cacheConfig, InputConfig{Format: "wav"}, bytes.NewReader(original), w); err != nil {
+		return nil, err
+	}
+	if err := w.Flush(); err != nil {
+		return nil, err
+	}
+	return encoded.Bytes(), nil
+}
+
+// decodeBytes decodes single file in memory.
+func decodeBytes(encoderConfig CacheSampleEncoderConfig, cacheConfig cache.Config, encoded []byte) ([]byte, error) {
+	var decoded bytes.Buffer
+	output := &Output{Writer: &decoded}
+	if err := decode(encoderConfig, cacheConfig, bufio.NewReader(bytes.NewReader(encoded)), output); err != nil {
+		return nil, fmt.Errorf("decode: %w", err)
+	}
+	if err := output.Close(); err != nil {
+		return nil, err
+	}
+	return decoded.Bytes(), nil
+}
+
+// verifyBytes decodes in memory and compares with original, samples of near-lossless stream are compared within max error.
+func verifyBytes(encoderConfig CacheSampleEncoderConfig, cacheConfig cache.Config, original, encoded []byte) error {
+	if encoderConfig.MaxError > 0 {
+		_, err := verifyStream(encoderConfig.MaxError, encoderConfig, cacheConfig, InputConfig{Format: "wav"}, bytes.NewReader(original), bytes.NewReader(encoded))
+		return err
+	}
+
+	decoded, err := decodeBytes(encoderConfig, cacheConfig, encoded)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(original, decoded) {
+		return fmt.Errorf("decoded is different from original")
+	}
+	return nil
+}
+
+func writeBatchSummary(results []BatchResult, w *bufio.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"file", "size", "encoded_size", "ratio", "verified", "error"})
+
+	var total BatchResult
+	total.Path = "total"
+	total.Verified = true
+	numFailed := 0
+	for _, q := range results {
+		errText := ""
+		if q.Err != nil {
+			errText = q.Err.Error()
+			numFailed++
+		}
+		cw.Write([]string{q.Path, strconv.FormatInt(q.Size, 10), strconv.FormatInt(q.EncodedSize, 10), strconv.FormatFloat(q.Ratio(), 'f', 2, 64), strconv.FormatBool(q.Verified), errText})
+
+		total.Size += q.Size
+		total.EncodedSize += q.EncodedSize
+		total.Verified = total.Verified && q.Verified
+	}
+
+	totalErr := ""
+	if numFailed > 0 {
+		totalErr = fmt.Sprintf("%d of %d files failed", numFailed, len(results))
+	}
+	cw.Write([]string{total.Path, strconv.FormatInt(total.Size, 10), strconv.FormatInt(total.EncodedSize, 10), strconv.FormatFloat(total.Ratio(), 'f', 2, 64), strconv.FormatBool(total.Verified && len(results) > 0), totalErr})
+
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return err
+	}
+	if numFailed > 0 {
+		return fmt.Errorf("%s", totalErr)
+	}
+	return nil
+}
@@ -0,0 +1,79 @@
+package cache
+
+import "sort"
+
+type Config struct {
+	Size int
+}
+
+type entry struct {
+	key   uint16
+	count int
+}
+
+// Cache is not as efficient, but is ok for prototype.
+type Cache struct {
+	config Config
+	order  []entry
+}
+
+func New(config Config) *Cache {
+	return &Cache{
+		config: config,
+		order:  make([]entry, 0, config.Size),
+	}
+}
+
+func (s *Cache) Pop() {
+	if len(s.order) == 0 {
+		return
+	}
+	s.order = s.order[:len(s.order)-1]
+}
+
+func (s *Cache) Add(v uint16) {
+	if i := s.Index(v); i >= 0 {
+		s.order[i].count++
+	} else {
+		if s.IsFull() {
+			s.Pop()
+		}
+		s.order = append(s.order, entry{key: v, count: 1})
+	}
+	sort.SliceStable(s.order, func(i, j int) bool { return s.order[i].count > s.order[j].count })
+}
+
+func (s *Cache) Index(v uint16) int {
+	for i, q := range s.order {
+		if q.key == v {
+			return i
+		}
+	}
+	return -1
+}
+
+// Find is index of first key within maxError of v, as signed samples, or -1 if there is none.
+func (s *Cache) Find(v uint16, maxError int) int {
+	for i, q := range s.order {
+		if d := int(int16(q.key)) - int(int16(v)); d >= -maxError && d <= maxError {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *Cache) At(i int) uint16 { return s.order[i].key }
+
+func (s *Cache) IsFull() bool { return len(s.order) >= s.config.Size }
+
+func (s *Cache) Len() int { return len(s.order) }
+
+// Clone is copy of cache with same entries.
+func (s *Cache) Clone() *Cache {
+	c := New(s.config)
+	c.order = append(c.order, s.order...)
+	return c
+}
+
+// Reset removes all entries.
+func (s *Cache) Reset() { s.order = s.order[:0] }
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/cache"
+)
+
+// SampleEncoder writes encoded samples, samples are written in full after FlushBuffer.
+// Zero word after samples ends them.
+type SampleEncoder interface {
+	Write(v uint16) error
+	FlushBuffer() error
+}
+
+// SampleDecoder reads samples until zero word or end of stream, which is io.EOF.
+// Buffered is number of decoded samples that Next returns without reading.
+type SampleDecoder interface {
+	Next() (uint16, error)
+	Buffered() int
+}
+
+// Codec makes encoders and decoders of samples.
+// ID is stored in encoded stream, so decoder is chosen by it.
+type Codec interface {
+	ID() byte
+	Name() string
+	NewEncoder(config CacheSampleEncoderConfig, cacheConfig cache.Config, w io.Writer) SampleEncoder
+	NewDecoder(config CacheSampleEncoderConfig, cacheConfig cache.Config, r io.Reader) SampleDecoder
+}
+
+const (
+	CodecIDCache byte = iota + 1
+	CodecIDRaw
+	CodecIDAdaptive
+)
+
+// Codecs is registry of codecs.
+var Codecs = []Codec{CacheCodec{}, RawCodec{}, AdaptiveCodec{}}
+
+// RegisterCodec adds codec to registry.
+func RegisterCodec(codec Codec) error {
+	if _, ok := CodecByID(codec.ID()); ok {
+		return fmt.Errorf("codec with ID(%d) is already registered", codec.ID())
+	}
+	if _, ok := CodecByName(codec.Name()); ok {
+		return fmt.Errorf("codec with name(%s) is already registered", codec.Name())
+	}
+	Codecs = append(Codecs, codec)
+	return nil
+}
+
+func CodecByID(id byte) (Codec, bool) {
+	i := slices.IndexFunc(Codecs, func(c Codec) bool { return c.ID() == id })
+	if i < 0 {
+		return nil, false
+	}
+	return Codecs[i], true
+}
+
+func CodecByName(name string) (Codec, bool) {
+	i := slices.IndexFunc(Codecs, func(c Codec) bool { return c.Name() == name })
+	if i < 0 {
+		return nil, false
+	}
+	return Codecs[i], true
+}
+
+// CacheCodec is frequency ordered cache of samples with markers, its streams have no codec ID for compatibility.
+type CacheCodec struct{}
+
+func (s CacheCodec) ID() byte { return CodecIDCache }
+
+func (s CacheCodec) Name() string { return "cache" }
+
+func (s CacheCodec) NewEncoder(config CacheSampleEncoderConfig, cacheConfig cache.Config, w io.Writer) SampleEncoder {
+	return NewCacheSampleEncoder(config, cache.New(cacheConfig), asByteWriter(w))
+}
+
+func (s CacheCodec) NewDecoder(config CacheSampleEncoderConfig, cacheConfig cache.Config, r io.Reader) SampleDecoder {
+	return NewCacheSampleDecoder(config, cache.New(cacheConfig), r)
+}
+
+// AdaptiveCodec codes each block by cache or delta, whichever is smaller, with cache shared by all blocks.
+type AdaptiveCodec struct{}
+
+func (s AdaptiveCodec) ID() byte { return CodecIDAdaptive }
+
+func (s AdaptiveCodec) Name() string { return "adaptive" }
+
+func (s AdaptiveCodec) NewEncoder(config CacheSampleEncoderConfig, cacheConfig cache.Config, w io.Writer) SampleEncoder {
+	config.Adaptive = true
+	return NewCacheSampleEncoder(config, cache.New(cacheConfig), asByteWriter(w))
+}
+
+func (s AdaptiveCodec) NewDecoder(config CacheSampleEncoderConfig, cacheConfig cache.Config, r io.Reader) SampleDecoder {
+	config.Adaptive = true
+	return NewCacheSampleDecoder(config, cache.New(cacheConfig), r)
+}
+
+// RawCodec stores samples as is, in blocks of uint16 count followed by samples.
+// It is for samples that do not compress, such as noise.
+type RawCodec struct{}
+
+func (s RawCodec) ID() byte { return CodecIDRaw }
+
+func (s RawCodec) Name() string { return "raw" }
+
+func (s RawCodec) NewEncoder(config CacheSampleEncoderConfig, cacheConfig cache.Config, w io.Writer) SampleEncoder {
+	return &RawSampleEncoder{config: config, w: w, buffer: make([]uint16, 0, config.EncodedSeqMaxLen)}
+}
+
+func (s RawCodec) NewDecoder(config CacheSampleEncoderConfig, cacheConfig cache.Config, r io.Reader) SampleDecoder {
+	return &RawSampleDecoder{config: config, r: r}
+}
+
+type RawSampleEncoder struct {
+	config CacheSampleEncoderConfig
+	w      io.Writer
+	buffer []uint16
+}
+
+func (s *RawSampleEncoder) Write(v uint16) error {
+	if len(s.buffer) >= s.config.EncodedSeqMaxLen {
+		if err := s.FlushBuffer(); err != nil {
+			return err
+		}
+	}
+	s.buffer = append(s.buffer, v)
+	return nil
+}
+
+func (s *RawSampleEncoder) FlushBuffer() error {
+	if len(s.buffer) == 0 {
+		return nil
+	}
+	if err := binary.Write(s.w, s.config.ByteOrder, uint16(len(s.buffer))); err != nil {
+		return err
+	}
+	if err := binary.Write(s.w, s.config.ByteOrder, s.buffer); err != nil {
+		return err
+	}
+	s.buffer = s.buffer[:0]
+	return nil
+}
+
+type RawSampleDecoder struct {
+	config    CacheSampleEncoderConfig
+	r         io.Reader
+	remaining int
+}
+
+func (s *RawSampleDecoder) Next() (sample uint16, err error) {
+	if s.remaining == 0 {
+		var count uint16
+		if err := binary.Read(s.r, s.config.ByteOrder, &count); err != nil {
+			return 0, err
+		}
+		if count == 0 {
+			return 0, io.EOF
+		}
+		s.remaining = int(count)
+	}
+
+	if err := binary.Read(s.r, s.config.ByteOrder, &sample); err != nil {
+		return 0, err
+	}
+	s.remaining--
+	return sample, nil
+}
+
+func (s *RawSampleDecoder) Buffered() int { return 0 }
+
+type byteWriter struct{ io.Writer }
+
+func (s byteWriter) WriteByte(c byte) error {
+	_, err := s.Write([]byte{c})
+	return err
+}
+
+// asByteWriter is w, or w with WriteByte when it does not have it.
+func asByteWriter(w io.Writer) interface {
+	io.ByteWriter
+	io.Writer
+} {
+	if bw, ok := w.(interface {
+		io.ByteWriter
+		io.Writer
+	}); ok {
+		return bw
+	}
+	return byteWriter{w}
+}
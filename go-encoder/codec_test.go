@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math/rand/v2"
+	"slices"
+	"testing"
+
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/cache"
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/encoding"
+)
+
+func TestCodecs(t *testing.T) {
+	config := CacheSampleEncoderConfig{
+		EncodedSeqMaxLen:    (1 << 13) - 1,
+		NotEncodedSeqMaxLen: (1 << 7) - 1,
+		ByteOrder:           binary.LittleEndian,
+	}
+	cacheConfig := cache.Config{Size: 1 << 10}
+
+	r := rand.New(rand.NewPCG(1, 2))
+	samples := make([]uint16, 20000)
+	for i := range samples {
+		samples[i] = uint16(r.IntN(100) * 64)
+	}
+
+	for _, codec := range Codecs {
+		t.Run(codec.Name(), func(t *testing.T) {
+			var b bytes.Buffer
+			encoder := codec.NewEncoder(config, cacheConfig, &b)
+			for _, v := range samples {
+				if err := encoder.Write(v); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := encoder.FlushBuffer(); err != nil {
+				t.Fatal(err)
+			}
+			b.Write([]byte{0, 0, 'x'})
+
+			decoder := codec.NewDecoder(config, cacheConfig, &b)
+			var got []uint16
+			for {
+				v, err := decoder.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				got = append(got, v)
+			}
+			if !slices.Equal(got, samples) {
+				t.Errorf("decoded %d samples, expected %d", len(got), len(samples))
+			}
+			if b.String() != "x" {
+				t.Errorf("zero word does not end samples, rest %q", b.String())
+			}
+		})
+	}
+}
+
+func TestRegisterCodec(t *testing.T) {
+	if err := RegisterCodec(RawCodec{}); err == nil {
+		t.Error("expected error")
+	}
+	if codec, ok := CodecByName("cache"); !ok || codec.ID() != CodecIDCache {
+		t.Error(codec)
+	}
+	if _, ok := CodecByID(0); ok {
+		t.Error("unexpected codec")
+	}
+}
+
+func TestAdaptiveCodec_BlockTypes(t *testing.T) {
+	config := CacheSampleEncoderConfig{
+		EncodedSeqMaxLen:    (1 << 13) - 1,
+		NotEncodedSeqMaxLen: (1 << 7) - 1,
+		ByteOrder:           binary.LittleEndian,
+	}
+	cacheConfig := cache.Config{Size: 1 << 10}
+
+	// few values, then drift, then few values again that are still in cache
+	var samples []uint16
+	for i := range 3 * config.EncodedSeqMaxLen {
+		switch i / config.EncodedSeqMaxLen {
+		case 1:
+			samples = append(samples, uint16(i*3))
+		default:
+			samples = append(samples, uint16(i%5)*1000)
+		}
+	}
+
+	var b bytes.Buffer
+	encoder := AdaptiveCodec{}.NewEncoder(config, cacheConfig, &b).(*CacheSampleEncoder)
+	for _, v := range samples {
+		encoder.Write(v)
+	}
+	if err := encoder.FlushBuffer(); err != nil {
+		t.Fatal(err)
+	}
+	if stats := encoder.Stats(); stats.NumBlocksByType[encoding.BlockCache] != 2 || stats.NumBlocksByType[encoding.BlockDelta] != 1 {
+		t.Errorf("wrong blocks %v", stats.NumBlocksByType)
+	}
+
+	decoder := AdaptiveCodec{}.NewDecoder(config, cacheConfig, &b)
+	for i, exp := range samples {
+		v, err := decoder.Next()
+		if err != nil || v != exp {
+			t.Fatalf("sample(%d) %d != %d: %v", i, v, exp, err)
+		}
+	}
+	if _, err := decoder.Next(); err != io.EOF {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/gzip"
+	"compress/lzw"
+	"compress/zlib"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/cache"
+)
+
+type CompareConfig struct {
+	Path    string // zip archive with recordings, directory of WAV, or single file
+	CSVPath string // CSV of results, none if empty
+}
+
+// Compressor is method to compare, either codec, general purpose compressor or both one after another.
+type Compressor struct {
+	Name       string
+	Compress   func(original []byte) ([]byte, error)
+	Decompress func(compressed []byte) ([]byte, error)
+}
+
+type CompareResult struct {
+	File           string
+	Method         string
+	Size           int64
+	CompressedSize int64
+	CompressTime   time.Duration
+	DecompressTime time.Duration
+}
+
+func (s CompareResult) Ratio() float64 {
+	if s.CompressedSize == 0 {
+		return 0
+	}
+	return float64(s.Size) / float64(s.CompressedSize)
+}
+
+func throughput(size int64, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+	return float64(size) / 1e6 / d.Seconds()
+}
+
+func codecCompressor(codec Codec, encoderConfig CacheSampleEncoderConfig, cacheConfig cache.Config) Compressor {
+	return Compressor{
+		Name:       codec.Name(),
+		Compress:   func(b []byte) ([]byte, error) { return encodeBytes(codec, encoderConfig, cacheConfig, b) },
+		Decompress: func(b []byte) ([]byte, error) { return decodeBytes(encoderConfig, cacheConfig, b) },
+	}
+}
+
+func streamCompressor(name string, newWriter func(w io.Writer) (io.WriteCloser, error), newReader func(r io.Reader) (io.ReadCloser, error)) Compressor {
+	return Compressor{
+		Name: name,
+		Compress: func(b []byte) ([]byte, error) {
+			var out bytes.Buffer
+			w, err := newWriter(&out)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := w.Write(b); err != nil {
+				return nil, err
+			}
+			if err := w.Close(); err != nil {
+				return nil, err
+			}
+			return out.Bytes(), nil
+		},
+		Decompress: func(b []byte) ([]byte, error) {
+			r, err := newReader(bytes.NewReader(b))
+			if err != nil {
+				return nil, err
+			}
+			defer r.Close()
+			return io.ReadAll(r)
+		},
+	}
+}
+
+// chain is first compressor followed by second.
+func chain(first, second Compressor) Compressor {
+	return Compressor{
+		Name: first.Name + "+" + second.Name,
+		Compress: func(b []byte) ([]byte, error) {
+			b, err := first.Compress(b)
+			if err != nil {
+				return nil, err
+			}
+			return second.Compress(b)
+		},
+		Decompress: func(b []byte) ([]byte, error) {
+			b, err := second.Decompress(b)
+			if err != nil {
+				return nil, err
+			}
+			return first.Decompress(b)
+		},
+	}
+}
+
+// generalCompressors are compressors of standard library at each level.
+func generalCompressors() (all []Compressor, best []Compressor) {
+	levels := []int{flate.HuffmanOnly, flate.BestSpeed, 2, 3, 4, 5, 6, 7, 8, flate.BestCompression}
+	levelName := func(level int) string {
+		if level == flate.HuffmanOnly {
+			return "huffman"
+		}
+		return strconv.Itoa(level)
+	}
+
+	for _, level := range levels {
+		all = append(all,
+			streamCompressor("flate-"+levelName(level),
+				func(w io.Writer) (io.WriteCloser, error) { return flate.NewWriter(w, level) },
+				func(r io.Reader) (io.ReadCloser, error) { return flate.NewReader(r), nil },
+			),
+			streamCompressor("gzip-"+levelName(level),
+				func(w io.Writer) (io.WriteCloser, error) { return gzip.NewWriterLevel(w, level) },
+				func(r io.Reader) (io.ReadCloser, error) { return gzip.NewReader(r) },
+			),
+			streamCompressor("zlib-"+levelName(level),
+				func(w io.Writer) (io.WriteCloser, error) { return zlib.NewWriterLevel(w, level) },
+				func(r io.Reader) (io.ReadCloser, error) { return zlib.NewReader(r) },
+			),
+		)
+		if level == flate.BestCompression {
+			best = append(best, all[len(all)-3:]...)
+		}
+	}
+
+	for _, order := range []lzw.Order{lzw.LSB, lzw.MSB} {
+		name := map[lzw.Order]string{lzw.LSB: "lzw-lsb", lzw.MSB: "lzw-msb"}[order]
+		all = append(all, streamCompressor(name,
+			func(w io.Writer) (io.WriteCloser, error) { return lzw.NewWriter(w, order, 8), nil },
+			func(r io.Reader) (io.ReadCloser, error) { return lzw.NewReader(r, order, 8), nil },
+		))
+	}
+	best = append(best, all[len(all)-2])
+
+	return all, best
+}
+
+// compareCompressors are codecs, general purpose compressors, and codecs followed by best of general purpose compressors.
+func compareCompressors(encoderConfig CacheSampleEncoderConfig, cacheConfig cache.Config) []Compressor {
+	var compressors []Compressor
+	for _, codec := range Codecs {
+		compressors = append(compressors, codecCompressor(codec, encoderConfig, cacheConfig))
+	}
+
+	general, best := generalCompressors()
+	compressors = append(compressors, general...)
+
+	for _, codec := range Codecs {
+		for _, q := range best {
+			compressors = append(compressors, chain(codecCompressor(codec, encoderConfig, cacheConfig), q))
+		}
+	}
+	return compressors
+}
+
+func compareOne(compressor Compressor, name string, original []byte) (CompareResult, error) {
+	result := CompareResult{File: name, Method: compressor.Name, Size: int64(len(original))}
+
+	start := time.Now()
+	compressed, err := compressor.Compress(original)
+	if err != nil {
+		return result, fmt.Errorf("%s %s: %w", name, compressor.Name, err)
+	}
+	result.CompressTime = time.Since(start)
+	result.CompressedSize = int64(len(compressed))
+
+	start = time.Now()
+	decompressed, err := compressor.Decompress(compressed)
+	if err != nil {
+		return result, fmt.Errorf("%s %s: %w", name, compressor.Name, err)
+	}
+	result.DecompressTime = time.Since(start)
+
+	if !bytes.Equal(original, decompressed) {
+		return result, fmt.Errorf("%s %s: decompressed is different from original", name, compressor.Name)
+	}
+	return result, nil
+}
+
+// compare compresses every input by every method and writes table of results, and CSV of them.
+func compare(config CompareConfig, encoderConfig CacheSampleEncoderConfig, cacheConfig cache.Config, w io.Writer) error {
+	compressors := compareCompressors(encoderConfig, cacheConfig)
+
+	var results []CompareResult
+	totals := make([]CompareResult, len(compressors))
+	for i, q := range compressors {
+		totals[i] = CompareResult{File: "total", Method: q.Name}
+	}
+
+	err := walkRecordings(config.Path, func(name string, data []byte) error {
+		for i, q := range compressors {
+			result, err := compareOne(q, name, data)
+			if err != nil {
+				return err
+			}
+			results = append(results, result)
+
+			totals[i].Size += result.Size
+			totals[i].CompressedSize += result.CompressedSize
+			totals[i].CompressTime += result.CompressTime
+			totals[i].DecompressTime += result.DecompressTime
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	results = append(results, totals...)
+
+	if err := writeCompareTable(results, w); err != nil {
+		return err
+	}
+
+	if config.CSVPath == "" {
+		return nil
+	}
+	f, err := os.Create(config.CSVPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := writeCompareCSV(results, f); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+func compareRow(q CompareResult) []string {
+	return []string{
+		q.File,
+		q.Method,
+		strconv.FormatInt(q.Size, 10),
+		strconv.FormatInt(q.CompressedSize, 10),
+		strconv.FormatFloat(q.Ratio(), 'f', 3, 64),
+		strconv.FormatFloat(throughput(q.Size, q.CompressTime), 'f', 2, 64),
+		strconv.FormatFloat(throughput(q.Size, q.DecompressTime), 'f', 2, 64),
+	}
+}
+
+var compareColumns = []string{"file", "method", "size", "compressed_size", "ratio", "compress_mb_s", "decompress_mb_s"}
+
+func writeCompareTable(results []CompareResult, w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	row := func(vs []string) {
+		for _, v := range vs {
+			fmt.Fprint(tw, v, "\t")
+		}
+		fmt.Fprintln(tw)
+	}
+	row(compareColumns)
+	for _, q := range results {
+		row(compareRow(q))
+	}
+	return tw.Flush()
+}
+
+func writeCompareCSV(results []CompareResult, w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write(compareColumns)
+	for _, q := range results {
+		cw.Write(compareRow(q))
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,213 @@
+package conformance
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/bits"
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/cache"
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/encoding"
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/wav"
+)
+
+const (
+	CacheSize    = 1 << 10
+	BlockLen     = (1 << 13) - 1
+	MaxCount     = (1 << 13) - 1
+	SampleRate   = 19531
+	EncodedExt   = ".encoded"
+	DecodedExt   = ".wav"
+	WAVHeaderLen = 44
+)
+
+// Vector is encoded stream and samples that decoder has to produce.
+type Vector struct {
+	Name    string
+	Encoded []byte // without WAV header
+	Samples []uint16
+}
+
+func (s Vector) header() wav.WAVHeader {
+	header := wav.NewWAVHeader(SampleRate, 1)
+	header.SetDataSize(uint64(len(s.Samples)) * wav.SampleSize)
+	return header
+}
+
+// EncodedWAV is encoded stream of WAV input.
+func (s Vector) EncodedWAV() []byte {
+	var b bytes.Buffer
+	header := s.header()
+	header.MarshalBinary(&b)
+	b.Write(s.Encoded)
+	return b.Bytes()
+}
+
+// DecodedWAV is WAV file that decoder has to produce.
+func (s Vector) DecodedWAV() []byte {
+	var b bytes.Buffer
+	w := wav.NewWAVWriter(s.header(), &b)
+	w.WriteHeader()
+	w.WriteSamples(s.Samples)
+	return b.Bytes()
+}
+
+// builder writes markers and keeps cache of decoder to know which samples they decode into.
+type builder struct {
+	name    string
+	cache   *cache.Cache
+	b       bytes.Buffer
+	samples []uint16
+}
+
+func newBuilder(name string) *builder {
+	return &builder{name: name, cache: cache.New(cache.Config{Size: CacheSize})}
+}
+
+func (s *builder) marker(m encoding.Marker) {
+	if m.Count < 1 || m.Count > MaxCount {
+		panic(fmt.Errorf("%s: count(%d) is out of bound", s.name, m.Count))
+	}
+	if len(s.samples)/BlockLen != (len(s.samples)+m.Count-1)/BlockLen {
+		panic(fmt.Errorf("%s: marker of %d samples at %d crosses block", s.name, m.Count, len(s.samples)))
+	}
+	if err := m.MarshalBinaryToWriter(&s.b, binary.LittleEndian); err != nil {
+		panic(err)
+	}
+}
+
+// raw writes samples not encoded.
+func (s *builder) raw(samples ...uint16) *builder {
+	s.marker(encoding.Marker{Count: len(samples)})
+	for _, v := range samples {
+		binary.Write(&s.b, binary.LittleEndian, v)
+		s.cache.Add(v)
+		s.samples = append(s.samples, v)
+	}
+	return s
+}
+
+// encoded writes keys packed with encoding size.
+func (s *builder) encoded(encodingSize int, keys ...byte) *builder {
+	packer := bits.Packers[encodingSize]
+	if len(keys)%packer.UnpackedLen() != 0 {
+		panic(fmt.Errorf("%s: %d keys do not fill groups of %d", s.name, len(keys), packer.UnpackedLen()))
+	}
+
+	s.marker(encoding.Marker{Count: len(keys), EncodingSize: encodingSize, IsEncoded: true})
+	for i := 0; i < len(keys); i += packer.UnpackedLen() {
+		s.b.Write(packer.Pack(keys[i : i+packer.UnpackedLen()]))
+		for _, k := range keys[i : i+packer.UnpackedLen()] {
+			if int(k) > packer.MaxKeyIndex() {
+				panic(fmt.Errorf("%s: key(%d) does not fit into %d bits", s.name, k, encodingSize))
+			}
+			if int(k) >= s.cache.Len() {
+				panic(fmt.Errorf("%s: key(%d) is not in cache of %d samples", s.name, k, s.cache.Len()))
+			}
+			v := s.cache.At(int(k))
+			s.cache.Add(v)
+			s.samples = append(s.samples, v)
+		}
+	}
+	return s
+}
+
+// eof writes zero marker.
+func (s *builder) eof() *builder {
+	s.b.Write([]byte{0, 0})
+	return s
+}
+
+func (s *builder) vector() Vector {
+	return Vector{Name: s.name, Encoded: bytes.Clone(s.b.Bytes()), Samples: s.samples}
+}
+
+func seq(from, n int) []uint16 {
+	vs := make([]uint16, n)
+	for i := range vs {
+		vs[i] = uint16(from + i)
+	}
+	return vs
+}
+
+func repeat(key byte, n int) []byte { return bytes.Repeat([]byte{key}, n) }
+
+func keys(n int) []byte {
+	vs := make([]byte, n)
+	for i := range vs {
+		vs[i] = byte(i)
+	}
+	return vs
+}
+
+// Generate makes vectors that cover every marker and packer case.
+func Generate() []Vector {
+	var vs []Vector
+	add := func(b *builder) { vs = append(vs, b.vector()) }
+
+	add(newBuilder("empty"))
+	add(newBuilder("eof_only").eof())
+
+	// not encoded
+	add(newBuilder("raw_count_1").raw(0x1234))
+	add(newBuilder("raw_count_2_extremes").raw(0x0000, 0xFFFF))
+	add(newBuilder("raw_count_127").raw(seq(0xFF00, 127)...))
+	add(newBuilder("raw_count_max").raw(seq(0, MaxCount)...))
+	add(newBuilder("raw_then_eof").raw(1, 2, 3).eof())
+
+	// encoded by each packer, smallest and largest keys
+	add(newBuilder("encoded_4bit").raw(seq(100, 16)...).encoded(4, 0, 15))
+	add(newBuilder("encoded_4bit_all_keys").raw(seq(100, 16)...).encoded(4, keys(16)...))
+	add(newBuilder("encoded_6bit").raw(seq(100, 64)...).encoded(6, 0, 63, 17, 42))
+	add(newBuilder("encoded_6bit_all_keys").raw(seq(100, 64)...).encoded(6, keys(64)...))
+	add(newBuilder("encoded_7bit").raw(seq(100, 127)...).raw(500).encoded(7, 0, 127, 1, 126, 64, 63, 2, 125))
+	add(newBuilder("encoded_7bit_all_keys").raw(seq(100, 127)...).raw(500).encoded(7, keys(128)...))
+
+	// largest counts of each packer
+	add(newBuilder("encoded_4bit_count_max").raw(7).encoded(4, repeat(0, 8190)...))
+	add(newBuilder("encoded_6bit_count_max").raw(7).encoded(6, repeat(0, 8188)...))
+	add(newBuilder("encoded_7bit_count_max").raw(7).encoded(7, repeat(0, 8184)...))
+
+	// cache order changes with counts while decoding
+	add(newBuilder("cache_reorder").raw(10, 20, 30).encoded(4, 2, 2, 2, 1).encoded(6, 0, 1, 2, 0).raw(40).encoded(4, 3, 0))
+
+	// mixed markers, then zero marker
+	add(newBuilder("mixed").raw(1, 2).encoded(4, 1, 0).raw(3).encoded(6, 2, 2, 0, 1).encoded(7, 0, 1, 2, 0, 1, 2, 0, 1).raw(1).eof())
+
+	// cache is full, last entry is removed
+	b := newBuilder("cache_eviction")
+	for i := 0; i < CacheSize+10; i += 100 {
+		b.raw(seq(1000+i, 100)...)
+	}
+	b.encoded(7, keys(128)...)
+	for range 8 {
+		b.encoded(6, 63, 62, 61, 60)
+	}
+	add(b)
+
+	// blocks of samples
+	b = newBuilder("blocks")
+	b.raw(seq(0, 100)...)
+	b.encoded(7, repeat(5, 8088)...)
+	b.raw(1, 2, 3)
+	b.raw(seq(40, 120)...)
+	b.encoded(4, repeat(1, 30)...)
+	add(b)
+
+	return vs
+}
+
+// WriteVectors writes encoded and decoded WAV files of vectors into directory.
+func WriteVectors(dir string, vectors []Vector) error {
+	for _, v := range vectors {
+		if err := os.WriteFile(filepath.Join(dir, v.Name+EncodedExt), v.EncodedWAV(), 0644); err != nil {
+			return err
+		}
+		if err := os.WriteFile(filepath.Join(dir, v.Name+DecodedExt), v.DecodedWAV(), 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
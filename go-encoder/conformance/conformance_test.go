@@ -0,0 +1,72 @@
+package conformance_test
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/conformance"
+)
+
+func buildGo(t *testing.T) string {
+	testbin := filepath.Join(t.TempDir(), "go-encoder")
+	if out, err := exec.Command("go", "build", "-o", testbin, "..").CombinedOutput(); err != nil {
+		t.Fatal(err, string(out))
+	}
+	return testbin
+}
+
+func buildC(t *testing.T, src string) string {
+	cc, err := exec.LookPath("cc")
+	if err != nil {
+		t.Skip("no C compiler")
+	}
+	testbin := filepath.Join(t.TempDir(), filepath.Base(src)+".bin")
+	if out, err := exec.Command(cc, "-o", testbin, filepath.Join("..", "..", src)).CombinedOutput(); err != nil {
+		t.Fatal(err, string(out))
+	}
+	return testbin
+}
+
+func testDecoder(t *testing.T, decode func(in, out string) ([]byte, error)) {
+	dir := t.TempDir()
+	vectors := conformance.Generate()
+	if err := conformance.WriteVectors(dir, vectors); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range vectors {
+		t.Run(v.Name, func(t *testing.T) {
+			in := filepath.Join(dir, v.Name+conformance.EncodedExt)
+			out := filepath.Join(dir, v.Name+".decoded")
+			if msg, err := decode(in, out); err != nil {
+				t.Fatal(err, string(msg))
+			}
+
+			decoded, err := os.ReadFile(out)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := v.DecodedWAV()
+			if !bytes.Equal(expected, decoded) {
+				t.Errorf("decoded(%d bytes) != expected(%d bytes) at byte %d", len(decoded), len(expected), conformance.FirstDiff(expected, decoded))
+			}
+		})
+	}
+}
+
+func TestConformance_Go(t *testing.T) {
+	testbin := buildGo(t)
+	testDecoder(t, func(in, out string) ([]byte, error) {
+		return exec.Command(testbin, "-mode", "decode", "-in", in, "-out", out).CombinedOutput()
+	})
+}
+
+func TestConformance_C(t *testing.T) {
+	testbin := buildC(t, "simple_cache_decoder.c")
+	testDecoder(t, func(in, out string) ([]byte, error) {
+		return exec.Command(testbin, in, out).CombinedOutput()
+	})
+}
@@ -0,0 +1,43 @@
+// Package conformance is specification of encoded stream and vectors to check decoders against it.
+//
+// # Specification, version 1
+//
+// Encoded stream of WAV input is 44 bytes of original WAV header followed by markers.
+// Inputs of other formats start with container header instead, see package container.
+// All multi-byte values are little endian.
+//
+// Marker is uint16 word.
+// Zero word marks end of samples, bytes after it are trailer of input that is copied as is.
+// End of stream without zero word also ends samples.
+// Otherwise two least significant bits are code of encoding size:
+//
+//	00: 4 bits, 2 keys packed in 1 byte
+//	01: 6 bits, 4 keys packed in 3 bytes
+//	10: 7 bits, 8 keys packed in 7 bytes
+//	11: reserved, invalid
+//
+// Remaining 14 bits are two's complement count.
+// Positive count N is followed by N/K groups of packed keys, where K is number of keys in group, N is multiple of K.
+// Negative count -N is followed by N not encoded samples of uint16, with code of encoding size 00.
+// Count is in [1, 8191].
+//
+// Packed groups, where kN is N-th key and bits are from most significant:
+//
+//	4 bits: [k1:4 k0:4]
+//	6 bits: [k0:2 k1:6] [k0:2 k2:6] [k0:2 k3:6], most significant bits of k0 first
+//	7 bits: [k0:1 k1:7] ... [k0:1 k7:7], most significant bit of k0 first
+//
+// Key is index in cache, which is decoded into sample.
+//
+// Cache holds up to 1024 samples with count of how many times each was seen, ordered by count descending.
+// Every sample, encoded or not, is added to cache right after it is decoded, one by one.
+// Adding sample that is in cache increments its count.
+// Adding sample that is not in cache appends it with count 1, when cache is full last entry is removed first.
+// After adding, entries are stable sorted by count descending, entries with same count keep their order.
+//
+// Samples are coded in blocks of 8191 samples, last block may be shorter.
+// Marker does not cross boundary of blocks.
+package conformance
+
+// Version of specification.
+const Version = 1
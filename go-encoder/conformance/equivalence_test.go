@@ -0,0 +1,110 @@
+package conformance_test
+
+import (
+	"bytes"
+	"math"
+	"math/rand/v2"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/conformance"
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/wav"
+)
+
+func synthetic(n int, f func(i int) int16) []byte {
+	samples := make([]int16, n)
+	for i := range samples {
+		samples[i] = f(i)
+	}
+
+	header := wav.NewWAVHeader(conformance.SampleRate, 1)
+	header.SetDataSize(uint64(n) * wav.SampleSize)
+
+	var b bytes.Buffer
+	w := wav.NewWAVWriter(header, &b)
+	w.WriteHeader()
+	w.WriteInt16Samples(samples)
+	return b.Bytes()
+}
+
+func syntheticSignals() map[string][]byte {
+	r := rand.New(rand.NewPCG(1, 2))
+	return map[string][]byte{
+		"empty":        synthetic(0, nil),
+		"one":          synthetic(1, func(i int) int16 { return -1 }),
+		"constant":     synthetic(20000, func(i int) int16 { return 1000 }),
+		"ramp":         synthetic(20000, func(i int) int16 { return int16(i) }),
+		"block":        synthetic(8191, func(i int) int16 { return int16(i % 7) }),
+		"block_plus_1": synthetic(8192, func(i int) int16 { return int16(i % 70) }),
+		"noise":        synthetic(30000, func(i int) int16 { return int16(r.IntN(1 << 16)) }),
+		"neural": synthetic(50000, func(i int) int16 {
+			v := 200*math.Sin(float64(i)/30) + r.NormFloat64()*40
+			if r.IntN(500) == 0 {
+				v -= 1500
+			}
+			return int16(v/64) * 64
+		}),
+	}
+}
+
+func TestEquivalence(t *testing.T) {
+	goBin := buildGo(t)
+	cEncoder := buildC(t, "simple_cache_encoder.c")
+	cDecoder := buildC(t, "simple_cache_decoder.c")
+
+	dir := t.TempDir()
+	inputs := map[string]string{}
+	for name, data := range syntheticSignals() {
+		inputs[name] = filepath.Join(dir, name+".wav")
+		if err := os.WriteFile(inputs[name], data, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	testdata, _ := filepath.Glob(filepath.Join("..", "testdata", "*.wav"))
+	for _, f := range testdata {
+		inputs[filepath.Base(f)] = f
+	}
+
+	run := func(t *testing.T, name string, args ...string) []byte {
+		out := filepath.Join(dir, name)
+		args = append(args, out)
+		if msg, err := exec.Command(args[0], args[1:]...).CombinedOutput(); err != nil {
+			t.Fatal(err, string(msg))
+		}
+		b, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+
+	for name, in := range inputs {
+		t.Run(name, func(t *testing.T) {
+			original, err := os.ReadFile(in)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			goEncoded := run(t, name+".go.encoded", goBin, "-mode", "encode", "-in", in, "-out")
+			cEncoded := run(t, name+".c.encoded", cEncoder, in)
+			if d := conformance.Divergence(goEncoded, cEncoded, conformance.WAVHeaderLen); d != "" {
+				t.Errorf("encoded Go != C: %s", d)
+			}
+
+			for encoder, encoded := range map[string]string{"go": name + ".go.encoded", "c": name + ".c.encoded"} {
+				in := filepath.Join(dir, encoded)
+				decoded := map[string][]byte{
+					"go": run(t, encoded+".go.decoded", goBin, "-mode", "decode", "-in", in, "-out"),
+					"c":  run(t, encoded+".c.decoded", cDecoder, in),
+				}
+				for decoder, d := range decoded {
+					if i := conformance.FirstDiff(original, d); i >= 0 {
+						t.Errorf("%s encoded, %s decoded: first diverging byte %d of %d and %d bytes", encoder, decoder, i, len(original), len(d))
+					}
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package conformance
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/bits"
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/encoding"
+)
+
+// MarkerPos is marker in encoded stream.
+type MarkerPos struct {
+	Index  int // number of markers before it
+	Offset int // of marker word in stream
+	Size   int // in bytes with payload
+	Sample int // number of samples before it
+	Marker encoding.Marker
+}
+
+func (s MarkerPos) String() string {
+	kind := "raw"
+	if s.Marker.IsEncoded {
+		kind = fmt.Sprintf("encoded %d bit", s.Marker.EncodingSize)
+	}
+	return fmt.Sprintf("marker #%d at byte %d (%s, count %d, sample %d)", s.Index, s.Offset, kind, s.Marker.Count, s.Sample)
+}
+
+// Markers parses markers of encoded stream after header of headerLen bytes, until zero marker or end of stream.
+func Markers(stream []byte, headerLen int) ([]MarkerPos, error) {
+	if len(stream) < headerLen {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	var markers []MarkerPos
+	offset, sample := headerLen, 0
+	for offset < len(stream) {
+		var m encoding.Marker
+		if err := m.UnmarshalBinaryFromReader(bytes.NewReader(stream[offset:]), binary.LittleEndian); err != nil {
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			return markers, fmt.Errorf("at byte %d: %w", offset, err)
+		}
+
+		size := m.SizeBytes()
+		if m.IsEncoded {
+			packer := bits.Packers[m.EncodingSize]
+			size += (m.Count / packer.UnpackedLen()) * packer.PackedLen()
+		} else {
+			size += m.Count * 2
+		}
+
+		markers = append(markers, MarkerPos{Index: len(markers), Offset: offset, Size: size, Sample: sample, Marker: m})
+		offset += size
+		sample += m.Count
+	}
+	return markers, nil
+}
+
+// FirstDiff is offset of first byte that differs, or -1 when equal.
+func FirstDiff(a, b []byte) int {
+	for i := range min(len(a), len(b)) {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	if len(a) != len(b) {
+		return min(len(a), len(b))
+	}
+	return -1
+}
+
+// Divergence describes where encoded streams differ first, empty when equal.
+func Divergence(a, b []byte, headerLen int) string {
+	offset := FirstDiff(a, b)
+	if offset < 0 {
+		return ""
+	}
+
+	msg := fmt.Sprintf("first diverging byte %d of %d and %d bytes", offset, len(a), len(b))
+	if offset < headerLen {
+		return msg + " in header"
+	}
+
+	for _, s := range [][]byte{a, b} {
+		markers, err := Markers(s, headerLen)
+		var at *MarkerPos
+		for i := range markers {
+			if markers[i].Offset <= offset && offset < markers[i].Offset+markers[i].Size {
+				at = &markers[i]
+			}
+		}
+		switch {
+		case at != nil:
+			msg += "; " + at.String()
+		case err != nil:
+			msg += "; " + err.Error()
+		default:
+			msg += "; after last marker"
+		}
+	}
+	return msg
+}
@@ -0,0 +1,44 @@
+package conformance
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestMarkers(t *testing.T) {
+	v := newBuilder("mixed").raw(1, 2, 3).encoded(4, 1, 0).encoded(6, 2, 2, 0, 1).eof().vector()
+
+	markers, err := Markers(v.Encoded, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(markers) != 3 {
+		t.Fatalf("markers(%d) != 3", len(markers))
+	}
+	offsets, samples := []int{0, 8, 11}, []int{0, 3, 5}
+	for i, m := range markers {
+		if m.Offset != offsets[i] || m.Sample != samples[i] {
+			t.Error(i, m)
+		}
+	}
+}
+
+func TestDivergence(t *testing.T) {
+	a := newBuilder("a").raw(1, 2, 3).encoded(4, 1, 0).encoded(6, 2, 2, 0, 1).vector().EncodedWAV()
+
+	if d := Divergence(a, a, WAVHeaderLen); d != "" {
+		t.Error(d)
+	}
+
+	b := bytes.Clone(a)
+	b[WAVHeaderLen+12]++
+	d := Divergence(a, b, WAVHeaderLen)
+	if !strings.Contains(d, "byte 56") || !strings.Contains(d, "marker #2 at byte 55 (encoded 6 bit, count 4, sample 5)") {
+		t.Error(d)
+	}
+
+	if d := Divergence(a, a[:WAVHeaderLen-1], WAVHeaderLen); !strings.HasSuffix(d, "in header") {
+		t.Error(d)
+	}
+}
@@ -0,0 +1,243 @@
+// Package container is header of encoded stream for inputs other than WAV.
+// Encoded WAV starts with its original WAV header, while other inputs start with Magic.
+// WAV is in container too when stream has sections, such as keyframes.
+//
+//	Magic [4]byte
+//	Version uint8
+//	Format uint8
+//	sections: Kind uint8, Size uint32, Data [Size]byte
+//	SectionEnd uint8
+//	samples encoded by markers
+//
+// With SectionSubstream, markers are in sections and are not after header.
+// With SectionPackets, markers are in packets of MTU bytes after header, see package packet.
+// With SectionKeyframes, cache is reset every Interval samples and markers do not cross keyframes.
+// Stream then always ends with zero marker, trailer of input and Index.
+package container
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+var Magic = [4]byte{'N', 'L', 'C', 'C'}
+
+const Version = 1
+
+var ErrNotContainer = errors.New("not a container")
+
+// Format is format of original input.
+type Format uint8
+
+const (
+	FormatRaw Format = iota + 1
+	FormatNPY
+	FormatEDF
+	FormatOpenEphys
+	FormatIntan
+	FormatWAV
+)
+
+func (s Format) String() string {
+	switch s {
+	case FormatRaw:
+		return "raw"
+	case FormatNPY:
+		return "npy"
+	case FormatEDF:
+		return "edf"
+	case FormatOpenEphys:
+		return "openephys"
+	case FormatIntan:
+		return "intan"
+	case FormatWAV:
+		return "wav"
+	default:
+		return fmt.Sprintf("Format(%d)", uint8(s))
+	}
+}
+
+type SectionKind uint8
+
+const (
+	SectionEnd SectionKind = iota
+	SectionMetadata
+	SectionKeyframes // Interval uint32
+	SectionCodec     // ID uint8, cache codec if there is no section
+	SectionSubstream // Stream uint8, Backend uint8, compressed stream, see package substream
+	SectionPackets   // MTU uint32
+	SectionMaxError  // MaxError uint32, of decoded samples from input
+	SectionSpikes    // windows of samples that are lossless when there is max error, see package spike
+)
+
+type Section struct {
+	Kind SectionKind
+	Data []byte
+}
+
+type Header struct {
+	Version  uint8
+	Format   Format
+	Sections []Section
+}
+
+// IsContainer checks first bytes of encoded stream.
+func IsContainer(b []byte) bool { return bytes.HasPrefix(b, Magic[:]) }
+
+// Section returns data of first section of given kind.
+func (s *Header) Section(kind SectionKind) ([]byte, bool) {
+	for _, q := range s.Sections {
+		if q.Kind == kind {
+			return q.Data, true
+		}
+	}
+	return nil, false
+}
+
+// Size in bytes.
+func (s *Header) Size() int {
+	n := len(Magic) + 1 + 1 + 1
+	for _, q := range s.Sections {
+		n += 1 + 4 + len(q.Data)
+	}
+	return n
+}
+
+// KeyframesSection makes section of keyframes every interval samples.
+func KeyframesSection(interval int) Section {
+	return Section{Kind: SectionKeyframes, Data: binary.LittleEndian.AppendUint32(nil, uint32(interval))}
+}
+
+// PacketsSection makes section of packets of mtu bytes.
+func PacketsSection(mtu int) Section {
+	return Section{Kind: SectionPackets, Data: binary.LittleEndian.AppendUint32(nil, uint32(mtu))}
+}
+
+// PacketMTU is size of packets of stream, zero if it is not in packets.
+func (s *Header) PacketMTU() (int, error) {
+	data, ok := s.Section(SectionPackets)
+	if !ok {
+		return 0, nil
+	}
+	if len(data) != 4 {
+		return 0, fmt.Errorf("packets section of %d bytes, expected 4", len(data))
+	}
+	return int(binary.LittleEndian.Uint32(data)), nil
+}
+
+// MaxErrorSection makes section of max error of samples of near-lossless stream.
+func MaxErrorSection(maxError int) Section {
+	return Section{Kind: SectionMaxError, Data: binary.LittleEndian.AppendUint32(nil, uint32(maxError))}
+}
+
+// MaxError of decoded samples from input, zero if stream is lossless.
+func (s *Header) MaxError() (int, error) {
+	data, ok := s.Section(SectionMaxError)
+	if !ok {
+		return 0, nil
+	}
+	if len(data) != 4 {
+		return 0, fmt.Errorf("max error section of %d bytes, expected 4", len(data))
+	}
+	return int(binary.LittleEndian.Uint32(data)), nil
+}
+
+// CodecSection makes section of codec of samples.
+func CodecSection(id byte) Section { return Section{Kind: SectionCodec, Data: []byte{id}} }
+
+// Codec is ID of codec of samples, false if there is no section.
+func (s *Header) Codec() (byte, bool, error) {
+	data, ok := s.Section(SectionCodec)
+	if !ok {
+		return 0, false, nil
+	}
+	if len(data) != 1 {
+		return 0, false, fmt.Errorf("codec section of %d bytes, expected 1", len(data))
+	}
+	return data[0], true, nil
+}
+
+// KeyframeInterval is number of samples between keyframes, zero if there are none.
+func (s *Header) KeyframeInterval() (int, error) {
+	data, ok := s.Section(SectionKeyframes)
+	if !ok {
+		return 0, nil
+	}
+	if len(data) != 4 {
+		return 0, fmt.Errorf("keyframes section of %d bytes, expected 4", len(data))
+	}
+	return int(binary.LittleEndian.Uint32(data)), nil
+}
+
+func (s *Header) MarshalBinary(w io.Writer) error {
+	for _, v := range []any{Magic, s.Version, s.Format} {
+		if err := binary.Write(w, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+
+	for _, q := range s.Sections {
+		if q.Kind == SectionEnd {
+			return errors.New("section end can not have data")
+		}
+		for _, v := range []any{q.Kind, uint32(len(q.Data)), q.Data} {
+			if err := binary.Write(w, binary.LittleEndian, v); err != nil {
+				return err
+			}
+		}
+	}
+
+	return binary.Write(w, binary.LittleEndian, SectionEnd)
+}
+
+func (s *Header) UnmarshalBinary(r io.Reader) error {
+	var magic [4]byte
+	if err := binary.Read(r, binary.LittleEndian, &magic); err != nil {
+		return err
+	}
+	if magic != Magic {
+		return ErrNotContainer
+	}
+
+	if err := binary.Read(r, binary.LittleEndian, &s.Version); err != nil {
+		return err
+	}
+	if s.Version > Version {
+		return fmt.Errorf("unsupported version(%d), expected at most %d", s.Version, Version)
+	}
+
+	if err := binary.Read(r, binary.LittleEndian, &s.Format); err != nil {
+		return err
+	}
+
+	s.Sections = nil
+	for {
+		var q Section
+		if err := binary.Read(r, binary.LittleEndian, &q.Kind); err != nil {
+			return err
+		}
+		if q.Kind == SectionEnd {
+			return nil
+		}
+
+		var size uint32
+		if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+			return err
+		}
+
+		// size is not trusted, so buffer grows only as data is read
+		var data bytes.Buffer
+		if _, err := io.CopyN(&data, r, int64(size)); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		q.Data = data.Bytes()
+
+		s.Sections = append(s.Sections, q)
+	}
+}
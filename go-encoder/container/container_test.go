@@ -0,0 +1,98 @@
+package container_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"runtime"
+	"testing"
+
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/container"
+)
+
+func TestHeader(t *testing.T) {
+	header := container.Header{
+		Version: container.Version,
+		Format:  container.FormatRaw,
+		Sections: []container.Section{
+			{Kind: container.SectionMetadata, Data: []byte{1, 2, 3}},
+			container.KeyframesSection(1000),
+			container.CodecSection(7),
+			container.PacketsSection(256),
+			container.MaxErrorSection(3),
+		},
+	}
+
+	var b bytes.Buffer
+	if err := header.MarshalBinary(&b); err != nil {
+		t.Fatal(err)
+	}
+	if b.Len() != header.Size() {
+		t.Errorf("size(%d) != %d", header.Size(), b.Len())
+	}
+	b.WriteString("payload")
+
+	if !container.IsContainer(b.Bytes()) {
+		t.Error("expected container")
+	}
+
+	var got container.Header
+	if err := got.UnmarshalBinary(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.Format != container.FormatRaw || got.Version != container.Version {
+		t.Errorf("wrong header %#v", got)
+	}
+
+	if v, ok := got.Section(container.SectionMetadata); !ok || !bytes.Equal(v, []byte{1, 2, 3}) {
+		t.Errorf("wrong section %v", v)
+	}
+
+	if v, err := got.KeyframeInterval(); err != nil || v != 1000 {
+		t.Errorf("wrong keyframe interval %d: %v", v, err)
+	}
+
+	if id, ok, err := got.Codec(); err != nil || !ok || id != 7 {
+		t.Errorf("wrong codec %d: %v", id, err)
+	}
+
+	if v, err := got.PacketMTU(); err != nil || v != 256 {
+		t.Errorf("wrong packet mtu %d: %v", v, err)
+	}
+
+	if v, err := got.MaxError(); err != nil || v != 3 {
+		t.Errorf("wrong max error %d: %v", v, err)
+	}
+
+	if b.String() != "payload" {
+		t.Errorf("payload is not after header: %q", b.String())
+	}
+}
+
+func TestHeader_NotContainer(t *testing.T) {
+	var got container.Header
+	if err := got.UnmarshalBinary(bytes.NewReader([]byte("RIFF...."))); err != container.ErrNotContainer {
+		t.Error(err)
+	}
+}
+
+func TestHeader_HugeSection(t *testing.T) {
+	b := append([]byte{}, container.Magic[:]...)
+	b = append(b, container.Version, byte(container.FormatRaw), byte(container.SectionMetadata))
+	b = binary.LittleEndian.AppendUint32(b, 0xFFFFFFFF)
+	b = append(b, 1, 2, 3)
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	var header container.Header
+	err := header.UnmarshalBinary(bytes.NewReader(b))
+	runtime.ReadMemStats(&after)
+
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("expected unexpected EOF, got %v", err)
+	}
+	if n := after.TotalAlloc - before.TotalAlloc; n > 1<<20 {
+		t.Errorf("allocated %d bytes for section of 3 bytes", n)
+	}
+}
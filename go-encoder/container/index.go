@@ -0,0 +1,104 @@
+package container
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// IndexEntry is keyframe, where cache is reset.
+// Offset is position of its first marker from start of markers.
+type IndexEntry struct {
+	Sample uint64
+	Offset uint64
+}
+
+// Index is block index that is written at the end of stream with keyframes, after trailer of input.
+//
+//	entries: Sample uint64, Offset uint64
+//	NumEntries uint64
+type Index []IndexEntry
+
+const indexEntrySize = 16
+
+// Size in bytes.
+func (s Index) Size() int { return len(s)*indexEntrySize + 8 }
+
+func (s Index) MarshalBinary(w io.Writer) error {
+	for _, v := range []any{[]IndexEntry(s), uint64(len(s))} {
+		if err := binary.Write(w, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ParseIndex reads index from the end of b and returns bytes before it.
+func ParseIndex(b []byte) (Index, []byte, error) {
+	if len(b) < 8 {
+		return nil, nil, io.ErrUnexpectedEOF
+	}
+	n := binary.LittleEndian.Uint64(b[len(b)-8:])
+	if n > uint64((len(b)-8)/indexEntrySize) {
+		return nil, nil, fmt.Errorf("index of %d entries does not fit into %d bytes", n, len(b))
+	}
+
+	index := make(Index, n)
+	start := len(b) - index.Size()
+	if err := binary.Read(bytes.NewReader(b[start:]), binary.LittleEndian, []IndexEntry(index)); err != nil {
+		return nil, nil, err
+	}
+	if err := index.validate(); err != nil {
+		return nil, nil, err
+	}
+	return index, b[:start], nil
+}
+
+// ReadIndex reads index from the end of stream.
+func ReadIndex(r io.ReadSeeker) (Index, error) {
+	end, err := r.Seek(-8, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	var n uint64
+	if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+		return nil, err
+	}
+	if n > uint64(end/indexEntrySize) {
+		return nil, fmt.Errorf("index of %d entries does not fit into %d bytes", n, end+8)
+	}
+
+	index := make(Index, n)
+	if _, err := r.Seek(end-int64(n)*indexEntrySize, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(r, binary.LittleEndian, []IndexEntry(index)); err != nil {
+		return nil, err
+	}
+	if err := index.validate(); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+// validate checks that each keyframe is after previous one, both in samples and in offset.
+func (s Index) validate() error {
+	for i := 1; i < len(s); i++ {
+		if s[i].Sample <= s[i-1].Sample || s[i].Offset <= s[i-1].Offset {
+			return fmt.Errorf("keyframe %d(%+v) is not after keyframe(%+v)", i, s[i], s[i-1])
+		}
+	}
+	return nil
+}
+
+// Find returns last keyframe at or before sample.
+func (s Index) Find(sample uint64) (IndexEntry, error) {
+	i := sort.Search(len(s), func(i int) bool { return s[i].Sample > sample })
+	if i == 0 {
+		return IndexEntry{}, errors.New("no keyframe before sample")
+	}
+	return s[i-1], nil
+}
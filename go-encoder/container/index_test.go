@@ -0,0 +1,74 @@
+package container_test
+
+import (
+	"bytes"
+	"slices"
+	"testing"
+
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/container"
+)
+
+func TestIndex(t *testing.T) {
+	index := container.Index{{Sample: 0, Offset: 0}, {Sample: 100, Offset: 30}, {Sample: 200, Offset: 75}}
+
+	var b bytes.Buffer
+	b.WriteString("trailer")
+	if err := index.MarshalBinary(&b); err != nil {
+		t.Fatal(err)
+	}
+	if b.Len() != len("trailer")+index.Size() {
+		t.Errorf("size(%d) != %d", index.Size(), b.Len())
+	}
+
+	t.Run("parse", func(t *testing.T) {
+		got, rest, err := container.ParseIndex(b.Bytes())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, index) || string(rest) != "trailer" {
+			t.Error(got, string(rest))
+		}
+	})
+
+	t.Run("read", func(t *testing.T) {
+		got, err := container.ReadIndex(bytes.NewReader(b.Bytes()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, index) {
+			t.Error(got)
+		}
+	})
+
+	t.Run("find", func(t *testing.T) {
+		for sample, exp := range map[uint64]uint64{0: 0, 99: 0, 100: 100, 150: 100, 1000: 200} {
+			got, err := index.Find(sample)
+			if err != nil || got.Sample != exp {
+				t.Error(sample, got, err)
+			}
+		}
+	})
+
+	t.Run("out of order", func(t *testing.T) {
+		for _, index := range []container.Index{
+			{{Sample: 0, Offset: 0}, {Sample: 100, Offset: 30}, {Sample: 50, Offset: 75}},
+			{{Sample: 0, Offset: 30}, {Sample: 100, Offset: 0}},
+			{{Sample: 0, Offset: 0}, {Sample: 100, Offset: 0}},
+		} {
+			var b bytes.Buffer
+			index.MarshalBinary(&b)
+			if _, _, err := container.ParseIndex(b.Bytes()); err == nil {
+				t.Errorf("parse %v: expected error", index)
+			}
+			if _, err := container.ReadIndex(bytes.NewReader(b.Bytes())); err == nil {
+				t.Errorf("read %v: expected error", index)
+			}
+		}
+	})
+
+	t.Run("too many entries", func(t *testing.T) {
+		if _, _, err := container.ParseIndex([]byte{1, 0, 0, 0, 0, 0, 0, 0}); err == nil {
+			t.Error("expected error")
+		}
+	})
+}
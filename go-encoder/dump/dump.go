@@ -0,0 +1,252 @@
+// Package dump writes samples as text table and reads them back.
+//
+//	time,ch0,ch1
+//	0.000000,-12,7
+//	0.000051,-10,3
+package dump
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const timeColumn = "time"
+
+type Config struct {
+	Separator   rune    // ',' for CSV, '\t' for TSV
+	Radix       int     // 2, 10, 16
+	Signed      bool    // decimal samples are int16
+	NumChannels int     // number of columns of interleaved samples
+	SampleRate  float64 // timestamps column is written when set
+	Header      bool    // first row has names of columns
+}
+
+func (s Config) Validate() error {
+	switch s.Radix {
+	case 2, 10, 16:
+	default:
+		return fmt.Errorf("unsupported radix(%d), expected 2, 10 or 16", s.Radix)
+	}
+	if s.NumChannels < 1 {
+		return errors.New("at least one channel required")
+	}
+	return nil
+}
+
+func (s Config) format(v uint16) string {
+	switch s.Radix {
+	case 2:
+		return fmt.Sprintf("0b%016b", v)
+	case 16:
+		return fmt.Sprintf("0x%04x", v)
+	default:
+		if s.Signed {
+			return strconv.Itoa(int(int16(v)))
+		}
+		return strconv.Itoa(int(v))
+	}
+}
+
+// parse accepts value in radix of config, with or without prefix of radix, negative values are int16.
+func (s Config) parse(q string) (uint16, error) {
+	q = strings.TrimSpace(q)
+	neg := strings.HasPrefix(q, "-")
+	q = strings.TrimPrefix(q, "-")
+
+	switch s.Radix {
+	case 2:
+		q = strings.TrimPrefix(strings.TrimPrefix(q, "0b"), "0B")
+	case 16:
+		q = strings.TrimPrefix(strings.TrimPrefix(q, "0x"), "0X")
+	}
+
+	v, err := strconv.ParseUint(q, s.Radix, 16)
+	if err != nil {
+		return 0, err
+	}
+	if neg {
+		if v > 1<<15 {
+			return 0, fmt.Errorf("value(-%s) does not fit into int16", q)
+		}
+		return uint16(-int16(v)), nil
+	}
+	return uint16(v), nil
+}
+
+// Writer writes interleaved samples as rows of channels.
+type Writer struct {
+	config  Config
+	w       io.Writer
+	row     []uint16
+	numRows int
+}
+
+func NewWriter(config Config, w io.Writer) *Writer {
+	return &Writer{config: config, w: w, row: make([]uint16, 0, config.NumChannels)}
+}
+
+func (s *Writer) WriteHeader() error {
+	var columns []string
+	if s.config.SampleRate > 0 {
+		columns = append(columns, timeColumn)
+	}
+	for i := range s.config.NumChannels {
+		columns = append(columns, "ch"+strconv.Itoa(i))
+	}
+	_, err := io.WriteString(s.w, strings.Join(columns, string(s.config.Separator))+"\n")
+	return err
+}
+
+func (s *Writer) WriteSamples(p []uint16) error {
+	for _, v := range p {
+		if s.row = append(s.row, v); len(s.row) == s.config.NumChannels {
+			if err := s.writeRow(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Writer) writeRow() error {
+	var b strings.Builder
+	if s.config.SampleRate > 0 {
+		b.WriteString(strconv.FormatFloat(float64(s.numRows)/s.config.SampleRate, 'f', 6, 64))
+		b.WriteRune(s.config.Separator)
+	}
+	for i, v := range s.row {
+		if i > 0 {
+			b.WriteRune(s.config.Separator)
+		}
+		b.WriteString(s.config.format(v))
+	}
+	for range s.config.NumChannels - len(s.row) {
+		b.WriteRune(s.config.Separator)
+	}
+	b.WriteByte('\n')
+
+	s.row = s.row[:0]
+	s.numRows++
+
+	_, err := io.WriteString(s.w, b.String())
+	return err
+}
+
+// Flush writes last partial row, its missing samples are empty cells.
+func (s *Writer) Flush() error {
+	if len(s.row) == 0 {
+		return nil
+	}
+	return s.writeRow()
+}
+
+// Reader reads rows of channels as interleaved samples.
+// Empty lines and lines starting with # are skipped, cells can not be empty,
+// except cells at end of last row, which is short of samples as written by Writer.Flush.
+// Number of channels is taken from first row, and all rows have same number of columns.
+type Reader struct {
+	config      Config
+	r           *csv.Reader
+	hasTime     bool
+	NumChannels int
+	pending     []uint16
+	partial     bool // row short of samples was read
+}
+
+func NewReader(config Config, r io.Reader) *Reader {
+	cr := csv.NewReader(r)
+	cr.Comma = config.Separator
+	cr.Comment = '#'
+	cr.FieldsPerRecord = 0
+	// leading space of tab separated cells would be separators of empty cells
+	cr.TrimLeadingSpace = !unicode.IsSpace(config.Separator)
+	cr.ReuseRecord = true
+	return &Reader{config: config, r: cr, hasTime: config.SampleRate > 0}
+}
+
+func (s *Reader) ReadSamples(p []uint16) (int, error) {
+	n := 0
+	for n < len(p) {
+		if len(s.pending) == 0 {
+			if err := s.readRow(); err != nil {
+				if n > 0 && err == io.EOF {
+					return n, nil
+				}
+				return n, err
+			}
+		}
+		k := copy(p[n:], s.pending)
+		s.pending = s.pending[k:]
+		n += k
+	}
+	return n, nil
+}
+
+func (s *Reader) readRow() error {
+	for {
+		fields, err := s.r.Read()
+		if err != nil {
+			return err
+		}
+		line, _ := s.r.FieldPos(0)
+		if s.partial {
+			return fmt.Errorf("line %d: row after row short of samples", line)
+		}
+
+		for i, q := range fields {
+			fields[i] = strings.TrimSpace(q)
+		}
+		header := s.NumChannels == 0 && s.config.Header
+
+		// cells after last sample of row
+		valid := len(fields)
+		for !header && valid > 1 && fields[valid-1] == "" {
+			valid--
+		}
+		for i, q := range fields[:valid] {
+			if q == "" {
+				return fmt.Errorf("line %d: column %d is empty", line, i+1)
+			}
+		}
+
+		if header {
+			s.hasTime = fields[0] == timeColumn
+			s.NumChannels = len(fields)
+			if s.hasTime {
+				s.NumChannels--
+			}
+			if s.NumChannels == 0 {
+				return fmt.Errorf("line %d: no channels", line)
+			}
+			continue
+		}
+
+		if s.hasTime {
+			if valid < 2 {
+				return fmt.Errorf("line %d: no channels after time", line)
+			}
+			fields, valid = fields[1:], valid-1
+		}
+		if s.NumChannels == 0 {
+			s.NumChannels = len(fields)
+		}
+		if len(fields) != s.NumChannels {
+			return fmt.Errorf("line %d: number of columns(%d) does not match number of channels(%d)", line, len(fields), s.NumChannels)
+		}
+
+		s.partial = valid < len(fields)
+		for _, q := range fields[:valid] {
+			v, err := s.config.parse(q)
+			if err != nil {
+				return fmt.Errorf("line %d: %w", line, err)
+			}
+			s.pending = append(s.pending, v)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,160 @@
+package dump_test
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/dump"
+)
+
+func ExampleWriter() {
+	w := dump.NewWriter(dump.Config{Separator: ',', Radix: 10, Signed: true, NumChannels: 2, SampleRate: 4, Header: true}, os.Stdout)
+	w.WriteHeader()
+	w.WriteSamples([]uint16{0, 1, 0xFFFF, 3, 7})
+	w.Flush()
+	// Output:
+	// time,ch0,ch1
+	// 0.000000,0,1
+	// 0.250000,-1,3
+	// 0.500000,7,
+}
+
+func ExampleWriter_hex() {
+	w := dump.NewWriter(dump.Config{Separator: '\t', Radix: 16, NumChannels: 1}, os.Stdout)
+	w.WriteSamples([]uint16{0x1f, 0xFFFF})
+	// Output:
+	// 0x001f
+	// 0xffff
+}
+
+func TestReaderWriter(t *testing.T) {
+	samples := []uint16{0, 1, 0xFFFF, 3, 0x8000, 0x7FFF}
+	for _, config := range []dump.Config{
+		{Separator: ',', Radix: 10, Signed: true, NumChannels: 2, SampleRate: 19531, Header: true},
+		{Separator: ',', Radix: 10, NumChannels: 3},
+		{Separator: '\t', Radix: 16, NumChannels: 1, SampleRate: 1},
+		{Separator: '\t', Radix: 2, NumChannels: 2, Header: true},
+	} {
+		var b bytes.Buffer
+		w := dump.NewWriter(config, &b)
+		if config.Header {
+			w.WriteHeader()
+		}
+		if err := w.WriteSamples(samples); err != nil {
+			t.Fatal(err)
+		}
+		text := b.String()
+
+		r := dump.NewReader(config, &b)
+		var got []uint16
+		p := make([]uint16, 4)
+		for {
+			n, err := r.ReadSamples(p)
+			got = append(got, p[:n]...)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if !slices.Equal(samples, got) {
+			t.Errorf("exp(%v) != got(%v) from:\n%s", samples, got, text)
+		}
+		if r.NumChannels != config.NumChannels {
+			t.Errorf("number of channels exp(%d) != got(%d)", config.NumChannels, r.NumChannels)
+		}
+	}
+}
+
+func TestReaderWriter_PartialRow(t *testing.T) {
+	samples := []uint16{1, 2, 3, 4, 5}
+	for _, config := range []dump.Config{
+		{Separator: ',', Radix: 10, NumChannels: 2},
+		{Separator: '\t', Radix: 16, NumChannels: 4, SampleRate: 100, Header: true},
+	} {
+		var b bytes.Buffer
+		w := dump.NewWriter(config, &b)
+		if config.Header {
+			w.WriteHeader()
+		}
+		w.WriteSamples(samples)
+		if err := w.Flush(); err != nil {
+			t.Fatal(err)
+		}
+		text := b.String()
+
+		r := dump.NewReader(config, &b)
+		p := make([]uint16, 10)
+		n, err := r.ReadSamples(p)
+		if err != nil {
+			t.Fatal(err, text)
+		}
+		if !slices.Equal(samples, p[:n]) || r.NumChannels != config.NumChannels {
+			t.Errorf("exp(%v) != got(%v) of channels(%d) from:\n%s", samples, p[:n], r.NumChannels, text)
+		}
+	}
+}
+
+func TestReader_HandEdited(t *testing.T) {
+	text := `
+# test vector
+time, ch0, ch1
+0.0, -5, 0x10
+
+0.1, 7, 65535
+`
+	r := dump.NewReader(dump.Config{Separator: ',', Radix: 10, Header: true}, strings.NewReader(text))
+	p := make([]uint16, 10)
+	n, _ := r.ReadSamples(p)
+
+	// hex is not decimal
+	if n != 0 {
+		t.Errorf("expected error, got %v", p[:n])
+	}
+
+	r = dump.NewReader(dump.Config{Separator: ',', Radix: 10, Header: true}, strings.NewReader(strings.ReplaceAll(text, "0x10", "16")))
+	n, err := r.ReadSamples(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if exp := []uint16{0xFFFB, 16, 7, 0xFFFF}; !slices.Equal(exp, p[:n]) {
+		t.Errorf("exp(%v) != got(%v)", exp, p[:n])
+	}
+}
+
+func TestReader_Malformed(t *testing.T) {
+	tests := []struct {
+		name   string
+		header bool
+		text   string
+	}{
+		{name: "empty cell", text: "1,,3\n"},
+		{name: "empty cell after first row", text: "1,2,3\n4,,6\n"},
+		{name: "short row", text: "1,2,3\n4,5\n"},
+		{name: "long row", text: "1,2\n3,4,5\n"},
+		{name: "header of separators", header: true, text: ",,,\n1,2,3,4\n"},
+		{name: "header of time only", header: true, text: "time\n0.1\n"},
+		{name: "empty cell after header", header: true, text: "ch0,ch1\n,1\n"},
+		{name: "row after short row", header: true, text: "ch0,ch1\n1,\n2,3\n"},
+		{name: "short row of time only", header: true, text: "time,ch0\n0.1,\n"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			r := dump.NewReader(dump.Config{Separator: ',', Radix: 10, Header: tc.header}, strings.NewReader(tc.text))
+			p := make([]uint16, 10)
+			var err error
+			for err == nil {
+				_, err = r.ReadSamples(p)
+			}
+			if err == io.EOF {
+				t.Error("expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,498 @@
+// Package edf reads and writes European Data Format (EDF, EDF+) and BioSemi Data Format (BDF) files.
+// https://www.edfplus.info/specs/edf.html
+// https://www.edfplus.info/specs/edfplus.html
+package edf
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+const (
+	headerSize       = 256
+	signalHeaderSize = 256
+)
+
+// BDFVersion is first field of BDF header, EDF has "0".
+var BDFVersion = "\xffBIOSEMI"
+
+type Signal struct {
+	Label             string
+	Transducer        string
+	PhysicalDimension string
+	PhysicalMin       float64
+	PhysicalMax       float64
+	DigitalMin        int
+	DigitalMax        int
+	Prefiltering      string
+	SamplesPerRecord  int
+	Reserved          string
+}
+
+// IsAnnotations is true for EDF+ and BDF+ annotations signal, its samples are bytes of TALs.
+func (s Signal) IsAnnotations() bool {
+	return s.Label == "EDF Annotations" || s.Label == "BDF Annotations"
+}
+
+type Header struct {
+	Version        string
+	Patient        string
+	Recording      string
+	StartDate      string // dd.mm.yy
+	StartTime      string // hh.mm.ss
+	Reserved       string // EDF+C, EDF+D, 24BIT
+	NumRecords     int    // -1 if unknown
+	RecordDuration float64
+	Signals        []Signal
+}
+
+func (s Header) IsBDF() bool { return s.Version == BDFVersion }
+
+// SampleSize is number of bytes in single sample.
+func (s Header) SampleSize() int {
+	if s.IsBDF() {
+		return 3
+	}
+	return 2
+}
+
+// Size is size of header in bytes.
+func (s Header) Size() int { return headerSize + signalHeaderSize*len(s.Signals) }
+
+// RecordSize is size of data record in bytes.
+func (s Header) RecordSize() int {
+	n := 0
+	for _, q := range s.Signals {
+		n += q.SamplesPerRecord
+	}
+	return n * s.SampleSize()
+}
+
+type field struct {
+	size  int
+	value *string
+}
+
+func (s *Header) MarshalBinary(w io.Writer) error {
+	var b bytes.Buffer
+
+	numRecords, recordDuration, size := strconv.Itoa(s.NumRecords), formatFloat(s.RecordDuration), strconv.Itoa(s.Size())
+	numSignals := strconv.Itoa(len(s.Signals))
+	for _, f := range []field{
+		{8, &s.Version}, {80, &s.Patient}, {80, &s.Recording}, {8, &s.StartDate}, {8, &s.StartTime},
+		{8, &size}, {44, &s.Reserved}, {8, &numRecords}, {8, &recordDuration}, {4, &numSignals},
+	} {
+		if err := writeField(&b, f); err != nil {
+			return err
+		}
+	}
+
+	columns := make([][]string, 10)
+	for _, q := range s.Signals {
+		for i, v := range []string{
+			q.Label, q.Transducer, q.PhysicalDimension,
+			formatFloat(q.PhysicalMin), formatFloat(q.PhysicalMax),
+			strconv.Itoa(q.DigitalMin), strconv.Itoa(q.DigitalMax),
+			q.Prefiltering, strconv.Itoa(q.SamplesPerRecord), q.Reserved,
+		} {
+			columns[i] = append(columns[i], v)
+		}
+	}
+	for i, size := range signalFieldSizes {
+		for j := range columns[i] {
+			if err := writeField(&b, field{size, &columns[i][j]}); err != nil {
+				return err
+			}
+		}
+	}
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+var signalFieldSizes = []int{16, 80, 8, 8, 8, 8, 8, 80, 8, 32}
+
+func (s *Header) UnmarshalBinary(r io.Reader) error {
+	b := make([]byte, headerSize)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return err
+	}
+
+	var size, numRecords, recordDuration, numSignals string
+	fields := []field{
+		{8, &s.Version}, {80, &s.Patient}, {80, &s.Recording}, {8, &s.StartDate}, {8, &s.StartTime},
+		{8, &size}, {44, &s.Reserved}, {8, &numRecords}, {8, &recordDuration}, {4, &numSignals},
+	}
+	readFields(b, fields)
+
+	if s.Version != "0" && s.Version != BDFVersion {
+		return fmt.Errorf("invalid version(%q), expected 0 or BIOSEMI", s.Version)
+	}
+
+	var err error
+	if s.NumRecords, err = strconv.Atoi(numRecords); err != nil {
+		return fmt.Errorf("invalid number of data records: %w", err)
+	}
+	if s.RecordDuration, err = strconv.ParseFloat(recordDuration, 64); err != nil {
+		return fmt.Errorf("invalid duration of data record: %w", err)
+	}
+	n, err := strconv.Atoi(numSignals)
+	if err != nil || n < 0 {
+		return fmt.Errorf("invalid number of signals(%s)", numSignals)
+	}
+	if v, err := strconv.Atoi(size); err != nil || v != headerSize+signalHeaderSize*n {
+		return fmt.Errorf("invalid number of bytes in header(%s) for %d signals", size, n)
+	}
+
+	b = make([]byte, signalHeaderSize*n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return err
+	}
+
+	columns := make([][]string, len(signalFieldSizes))
+	for i, size := range signalFieldSizes {
+		columns[i] = make([]string, n)
+		for j := range n {
+			readFields(b, []field{{size, &columns[i][j]}})
+			b = b[size:]
+		}
+	}
+
+	s.Signals = make([]Signal, n)
+	for j := range s.Signals {
+		q := &s.Signals[j]
+		q.Label, q.Transducer, q.PhysicalDimension = columns[0][j], columns[1][j], columns[2][j]
+		q.Prefiltering, q.Reserved = columns[7][j], columns[9][j]
+
+		if q.PhysicalMin, err = strconv.ParseFloat(columns[3][j], 64); err != nil {
+			return fmt.Errorf("signal %d: invalid physical minimum: %w", j, err)
+		}
+		if q.PhysicalMax, err = strconv.ParseFloat(columns[4][j], 64); err != nil {
+			return fmt.Errorf("signal %d: invalid physical maximum: %w", j, err)
+		}
+		if q.DigitalMin, err = strconv.Atoi(columns[5][j]); err != nil {
+			return fmt.Errorf("signal %d: invalid digital minimum: %w", j, err)
+		}
+		if q.DigitalMax, err = strconv.Atoi(columns[6][j]); err != nil {
+			return fmt.Errorf("signal %d: invalid digital maximum: %w", j, err)
+		}
+		if q.SamplesPerRecord, err = strconv.Atoi(columns[8][j]); err != nil || q.SamplesPerRecord < 0 {
+			return fmt.Errorf("signal %d: invalid number of samples in data record(%s)", j, columns[8][j])
+		}
+	}
+
+	return nil
+}
+
+func readFields(b []byte, fields []field) {
+	for _, f := range fields {
+		*f.value = strings.TrimRight(string(b[:f.size]), " ")
+		b = b[f.size:]
+	}
+}
+
+func writeField(b *bytes.Buffer, f field) error {
+	if len(*f.value) > f.size {
+		return fmt.Errorf("value(%q) is longer than %d", *f.value, f.size)
+	}
+	b.WriteString(*f.value)
+	b.WriteString(strings.Repeat(" ", f.size-len(*f.value)))
+	return nil
+}
+
+func formatFloat(v float64) string {
+	s := strconv.FormatFloat(v, 'f', -1, 64)
+	for prec := 8; len(s) > 8 && prec >= 0; prec-- {
+		s = strconv.FormatFloat(v, 'f', prec, 64)
+	}
+	return s
+}
+
+// Record has samples of each signal in data record.
+type Record struct {
+	Signals [][]int32
+}
+
+// Annotation is Time-stamped Annotations List (TAL) of EDF+.
+type Annotation struct {
+	Onset       float64
+	Duration    float64
+	HasDuration bool
+	Texts       []string
+}
+
+// Annotations parses TALs of annotation signal of record.
+func (s Header) Annotations(record Record) ([]Annotation, error) {
+	var annotations []Annotation
+	for i, q := range s.Signals {
+		if !q.IsAnnotations() {
+			continue
+		}
+		vs, err := ParseAnnotations(samplesToBytes(record.Signals[i], s.SampleSize()))
+		if err != nil {
+			return nil, err
+		}
+		annotations = append(annotations, vs...)
+	}
+	return annotations, nil
+}
+
+// ParseAnnotations parses TALs, which are terminated by zero bytes.
+func ParseAnnotations(b []byte) ([]Annotation, error) {
+	var annotations []Annotation
+	for _, tal := range bytes.Split(b, []byte{0}) {
+		if len(tal) == 0 {
+			continue
+		}
+
+		parts := strings.Split(string(tal), "\x14")
+		if len(parts) < 2 {
+			return nil, fmt.Errorf("invalid TAL(%q)", tal)
+		}
+
+		var a Annotation
+		timing := strings.SplitN(parts[0], "\x15", 2)
+
+		var err error
+		if a.Onset, err = strconv.ParseFloat(timing[0], 64); err != nil {
+			return nil, fmt.Errorf("invalid onset of TAL(%q): %w", tal, err)
+		}
+		if len(timing) == 2 {
+			a.HasDuration = true
+			if a.Duration, err = strconv.ParseFloat(timing[1], 64); err != nil {
+				return nil, fmt.Errorf("invalid duration of TAL(%q): %w", tal, err)
+			}
+		}
+
+		// last part is empty, since each text ends with 0x14
+		for _, text := range parts[1 : len(parts)-1] {
+			a.Texts = append(a.Texts, text)
+		}
+		annotations = append(annotations, a)
+	}
+	return annotations, nil
+}
+
+// MarshalAnnotations encodes TALs into samples of annotation signal with given number of samples.
+func (s Header) MarshalAnnotations(annotations []Annotation, numSamples int) ([]int32, error) {
+	var b bytes.Buffer
+	for _, a := range annotations {
+		if a.Onset >= 0 {
+			b.WriteByte('+')
+		}
+		b.WriteString(strconv.FormatFloat(a.Onset, 'f', -1, 64))
+		if a.HasDuration {
+			b.WriteByte(0x15)
+			b.WriteString(strconv.FormatFloat(a.Duration, 'f', -1, 64))
+		}
+		b.WriteByte(0x14)
+		for _, text := range a.Texts {
+			b.WriteString(text)
+			b.WriteByte(0x14)
+		}
+		b.WriteByte(0)
+	}
+
+	size := s.SampleSize()
+	if b.Len() > numSamples*size {
+		return nil, fmt.Errorf("annotations of %d bytes do not fit into %d samples", b.Len(), numSamples)
+	}
+	b.Write(make([]byte, numSamples*size-b.Len()))
+
+	return bytesToSamples(b.Bytes(), size), nil
+}
+
+func samplesToBytes(vs []int32, size int) []byte {
+	b := make([]byte, 0, len(vs)*size)
+	for _, v := range vs {
+		b = append(b, byte(v), byte(v>>8))
+		if size == 3 {
+			b = append(b, byte(v>>16))
+		}
+	}
+	return b
+}
+
+func bytesToSamples(b []byte, size int) []int32 {
+	vs := make([]int32, len(b)/size)
+	for i := range vs {
+		q := b[i*size:]
+		if size == 3 {
+			vs[i] = int32(uint32(q[0])|uint32(q[1])<<8|uint32(q[2])<<16) << 8 >> 8
+		} else {
+			vs[i] = int32(int16(uint16(q[0]) | uint16(q[1])<<8))
+		}
+	}
+	return vs
+}
+
+// Reader reads data records.
+// Reading stops after NumRecords data records, bytes after them are available in Trailer.
+type Reader struct {
+	Header    Header
+	r         io.Reader
+	rawHeader []byte
+	remaining int64 // -1 if number of data records is unknown
+	buf       []byte
+}
+
+func NewReader(r io.Reader) *Reader { return &Reader{r: r} }
+
+func (s *Reader) ReadHeader() error {
+	var b bytes.Buffer
+	if err := s.Header.UnmarshalBinary(io.TeeReader(s.r, &b)); err != nil {
+		return err
+	}
+	s.rawHeader = b.Bytes()
+
+	s.remaining = -1
+	if s.Header.NumRecords >= 0 {
+		s.remaining = int64(s.Header.NumRecords) * int64(s.Header.RecordSize())
+	}
+	return nil
+}
+
+// RawHeader is header bytes as they were read.
+func (s *Reader) RawHeader() []byte { return s.rawHeader }
+
+// Trailer is everything after data records.
+// It is valid only after all samples have been read.
+func (s *Reader) Trailer() io.Reader { return s.r }
+
+func (s *Reader) read(n int) ([]byte, error) {
+	if s.remaining == 0 {
+		return nil, io.EOF
+	}
+	if s.remaining > 0 && int64(n) > s.remaining {
+		n = int(s.remaining)
+	}
+
+	if cap(s.buf) < n {
+		s.buf = make([]byte, n)
+	}
+	b := s.buf[:n]
+
+	k, err := io.ReadFull(s.r, b)
+	if s.remaining > 0 {
+		s.remaining -= int64(k)
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+	}
+	return b[:k], err
+}
+
+func (s *Reader) ReadRecord() (Record, error) {
+	b, err := s.read(s.Header.RecordSize())
+	if err != nil {
+		if err == io.ErrUnexpectedEOF && len(b) == 0 {
+			err = io.EOF
+		}
+		return Record{}, err
+	}
+
+	size := s.Header.SampleSize()
+	record := Record{Signals: make([][]int32, len(s.Header.Signals))}
+	for i, q := range s.Header.Signals {
+		record.Signals[i] = bytesToSamples(b[:q.SamplesPerRecord*size], size)
+		b = b[q.SamplesPerRecord*size:]
+	}
+	return record, nil
+}
+
+// ReadSamples reads samples of data records as 16 bit words in order of file.
+// BDF sample is low 16 bits word then high 8 bits word.
+func (s *Reader) ReadSamples(p []uint16) (int, error) {
+	size := s.Header.SampleSize()
+	numSamples := len(p)
+	if size == 3 {
+		numSamples /= 2
+	}
+	if numSamples == 0 {
+		return 0, io.ErrShortBuffer
+	}
+
+	b, err := s.read(numSamples * size)
+	if err == io.ErrUnexpectedEOF && s.remaining < 0 {
+		// unknown number of data records, partial sample is trailer
+		s.r = io.MultiReader(bytes.NewReader(bytes.Clone(b[len(b)-len(b)%size:])), s.r)
+		err = nil
+	}
+	if err == nil && len(b) < numSamples*size {
+		s.remaining = 0
+	}
+
+	n := 0
+	for i := 0; i+size <= len(b); i += size {
+		if size == 3 {
+			p[n], p[n+1] = uint16(b[i])|uint16(b[i+1])<<8, uint16(b[i+2])
+			n += 2
+		} else {
+			p[n] = uint16(b[i]) | uint16(b[i+1])<<8
+			n++
+		}
+	}
+	return n, err
+}
+
+type Writer struct {
+	Header  Header
+	w       io.Writer
+	pending []uint16 // low word of BDF sample, which high word is not written yet
+}
+
+func NewWriter(header Header, w io.Writer) *Writer { return &Writer{Header: header, w: w} }
+
+func (s *Writer) WriteHeader() error { return s.Header.MarshalBinary(s.w) }
+
+func (s *Writer) WriteRecord(record Record) error {
+	if len(record.Signals) != len(s.Header.Signals) {
+		return fmt.Errorf("number of signals(%d) does not match header(%d)", len(record.Signals), len(s.Header.Signals))
+	}
+
+	size := s.Header.SampleSize()
+	b := make([]byte, 0, s.Header.RecordSize())
+	for i, q := range s.Header.Signals {
+		if len(record.Signals[i]) != q.SamplesPerRecord {
+			return fmt.Errorf("signal %d: number of samples(%d) does not match header(%d)", i, len(record.Signals[i]), q.SamplesPerRecord)
+		}
+		b = append(b, samplesToBytes(record.Signals[i], size)...)
+	}
+
+	_, err := s.w.Write(b)
+	return err
+}
+
+// WriteSamples writes 16 bit words in order of file.
+// BDF sample is low 16 bits word then high 8 bits word.
+func (s *Writer) WriteSamples(p []uint16) error {
+	if s.Header.IsBDF() {
+		if len(s.pending) > 0 {
+			p = append(s.pending, p...)
+			s.pending = nil
+		}
+		if len(p)%2 != 0 {
+			s.pending = []uint16{p[len(p)-1]}
+			p = p[:len(p)-1]
+		}
+	}
+
+	b := make([]byte, 0, len(p)*2)
+	for i := 0; i < len(p); i++ {
+		b = append(b, byte(p[i]), byte(p[i]>>8))
+		if s.Header.IsBDF() {
+			if p[i+1] > 0xFF {
+				return errors.New("high word of BDF sample does not fit into 8 bits")
+			}
+			b = append(b, byte(p[i+1]))
+			i++
+		}
+	}
+
+	_, err := s.w.Write(b)
+	return err
+}
@@ -0,0 +1,171 @@
+package edf_test
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/edf"
+)
+
+func newHeader(version string) edf.Header {
+	return edf.Header{
+		Version:        version,
+		Patient:        "X X X X",
+		Recording:      "Startdate 19-OCT-2026 X X X",
+		StartDate:      "19.10.26",
+		StartTime:      "10.00.00",
+		Reserved:       "EDF+C",
+		NumRecords:     3,
+		RecordDuration: 0.5,
+		Signals: []edf.Signal{
+			{
+				Label:             "EEG Fpz-Cz",
+				Transducer:        "AgAgCl electrode",
+				PhysicalDimension: "uV",
+				PhysicalMin:       -3276.8,
+				PhysicalMax:       3276.7,
+				DigitalMin:        -32768,
+				DigitalMax:        32767,
+				Prefiltering:      "HP:0.1Hz LP:75Hz",
+				SamplesPerRecord:  5,
+			},
+			{
+				Label:            "EDF Annotations",
+				DigitalMin:       -32768,
+				DigitalMax:       32767,
+				PhysicalMin:      -1,
+				PhysicalMax:      1,
+				SamplesPerRecord: 16,
+			},
+		},
+	}
+}
+
+func newRecords(t *testing.T, header edf.Header) []edf.Record {
+	var records []edf.Record
+	for i := range header.NumRecords {
+		annotations := []edf.Annotation{{Onset: float64(i) * header.RecordDuration, Texts: []string{""}}}
+		if i == 1 {
+			annotations = append(annotations, edf.Annotation{Onset: 0.6, Duration: 0.25, HasDuration: true, Texts: []string{"spike"}})
+		}
+		tals, err := header.MarshalAnnotations(annotations, header.Signals[1].SamplesPerRecord)
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, edf.Record{Signals: [][]int32{{int32(i), -1, 2, -300, 7}, tals}})
+	}
+	return records
+}
+
+func TestReaderWriter(t *testing.T) {
+	for _, version := range []string{"0", edf.BDFVersion} {
+		t.Run(version, func(t *testing.T) {
+			header := newHeader(version)
+			records := newRecords(t, header)
+
+			var b bytes.Buffer
+			w := edf.NewWriter(header, &b)
+			if err := w.WriteHeader(); err != nil {
+				t.Fatal(err)
+			}
+			if b.Len() != header.Size() {
+				t.Errorf("header size exp(%d) != got(%d)", header.Size(), b.Len())
+			}
+			for _, record := range records {
+				if err := w.WriteRecord(record); err != nil {
+					t.Fatal(err)
+				}
+			}
+			encoded := bytes.Clone(b.Bytes())
+
+			r := edf.NewReader(&b)
+			if err := r.ReadHeader(); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(header, r.Header) {
+				t.Errorf("header exp(%#v) != got(%#v)", header, r.Header)
+			}
+
+			for i := range records {
+				record, err := r.ReadRecord()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(records[i], record) {
+					t.Errorf("record %d: exp(%v) != got(%v)", i, records[i], record)
+				}
+
+				annotations, err := r.Header.Annotations(record)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(annotations) != 1+i%2 || annotations[0].Onset != float64(i)*0.5 {
+					t.Errorf("record %d: wrong annotations %#v", i, annotations)
+				}
+				if i == 1 && (annotations[1].Texts[0] != "spike" || annotations[1].Duration != 0.25) {
+					t.Errorf("wrong annotation %#v", annotations[1])
+				}
+			}
+			if _, err := r.ReadRecord(); err != io.EOF {
+				t.Error(err)
+			}
+
+			if !bytes.Equal(r.RawHeader(), encoded[:header.Size()]) {
+				t.Error("raw header is not the same")
+			}
+		})
+	}
+}
+
+func TestReaderWriter_Samples(t *testing.T) {
+	for _, version := range []string{"0", edf.BDFVersion} {
+		for _, numRecords := range []int{3, -1} {
+			header := newHeader(version)
+			records := newRecords(t, header)
+			header.NumRecords = numRecords
+
+			var b bytes.Buffer
+			w := edf.NewWriter(header, &b)
+			w.WriteHeader()
+			for _, record := range records {
+				w.WriteRecord(record)
+			}
+			b.WriteString("trailer")
+			encoded := bytes.Clone(b.Bytes())
+
+			r := edf.NewReader(&b)
+			if err := r.ReadHeader(); err != nil {
+				t.Fatal(err)
+			}
+
+			var words []uint16
+			p := make([]uint16, 5)
+			for {
+				n, err := r.ReadSamples(p)
+				words = append(words, p[:n]...)
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var out bytes.Buffer
+			out.Write(r.RawHeader())
+			w = edf.NewWriter(r.Header, &out)
+			for i := 0; i < len(words); i += 3 {
+				if err := w.WriteSamples(words[i:min(i+3, len(words))]); err != nil {
+					t.Fatal(err)
+				}
+			}
+			io.Copy(&out, r.Trailer())
+
+			if !bytes.Equal(encoded, out.Bytes()) {
+				t.Errorf("version(%q) records(%d): output is not the same", version, numRecords)
+			}
+		}
+	}
+}
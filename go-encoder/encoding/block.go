@@ -0,0 +1,55 @@
+package encoding
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+type BlockType uint8
+
+const (
+	BlockCache BlockType = iota + 1 // markers of cache
+	BlockDelta                      // differences of samples, see AppendDelta
+)
+
+// BlockMarker starts block of adaptive coding, which is coded by one of block coders.
+// It is uint16 of count in 14 most significant bits and type in 2 least significant bits.
+// Zero word ends samples, as with Marker.
+type BlockMarker struct {
+	Type  BlockType
+	Count int
+}
+
+func (s *BlockMarker) SizeBytes() int { return 2 }
+
+func (s *BlockMarker) MarshalBinaryToWriter(w io.Writer, endian binary.ByteOrder) error {
+	if s.Count < 1 || s.Count > ((1<<14)-1) {
+		return fmt.Errorf("count %d is out of bound", s.Count)
+	}
+	if s.Type != BlockCache && s.Type != BlockDelta {
+		return fmt.Errorf("unsupported block type %d", s.Type)
+	}
+	return binary.Write(w, endian, uint16(s.Count<<2)|uint16(s.Type))
+}
+
+func (s *BlockMarker) UnmarshalBinaryFromReader(r io.Reader, endian binary.ByteOrder) error {
+	var v uint16
+	if err := binary.Read(r, endian, &v); err != nil {
+		return err
+	}
+
+	if v == 0 {
+		return io.EOF
+	}
+
+	s.Type = BlockType(v & 0x3)
+	s.Count = int(v >> 2)
+	if s.Type != BlockCache && s.Type != BlockDelta {
+		return fmt.Errorf("unsupported block type %d", s.Type)
+	}
+	if s.Count == 0 {
+		return fmt.Errorf("block of zero samples")
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package encoding
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"math/bits"
+)
+
+// AppendDelta codes samples by differences with previous sample, first is relative to prev.
+//
+//	Shift uint8, trailing zero bits common to all differences
+//	Width uint8, bits of each value
+//	values, most significant bit first, padded by zeros to byte
+//
+// Value is zigzag of difference as int16, shifted right by Shift.
+func AppendDelta(b []byte, prev uint16, samples []uint16) []byte {
+	var all uint16
+	for i, v := range samples {
+		if i == 0 {
+			all |= v - prev
+		} else {
+			all |= v - samples[i-1]
+		}
+	}
+
+	shift := 0
+	if all != 0 {
+		shift = bits.TrailingZeros16(all)
+	}
+
+	values := make([]uint16, len(samples))
+	var maxValue uint16
+	for i, v := range samples {
+		values[i] = zigzag(int16(v-prev) >> shift)
+		maxValue = max(maxValue, values[i])
+		prev = v
+	}
+	width := bits.Len16(maxValue)
+
+	b = append(b, byte(shift), byte(width))
+
+	var acc uint64
+	n := 0
+	for _, v := range values {
+		acc = (acc << width) | uint64(v)
+		n += width
+		for n >= 8 {
+			b = append(b, byte(acc>>(n-8)))
+			n -= 8
+		}
+	}
+	if n > 0 {
+		b = append(b, byte(acc<<(8-n)))
+	}
+	return b
+}
+
+// QuantizeDelta is samples within maxError of samples, with differences of multiples of power of two, so that AppendDelta shifts them.
+// Difference is relative to previous quantized sample, first is relative to prev.
+// It returns false when quantized sample is out of bound of int16.
+func QuantizeDelta(prev uint16, samples []uint16, maxError int) ([]uint16, bool) {
+	step := 1
+	for step*2 <= 2*maxError && step < 1<<14 {
+		step *= 2
+	}
+
+	quantized := make([]uint16, len(samples))
+	p := int(int16(prev))
+	for i, v := range samples {
+		d := int(int16(v)) - p
+		q := d / step * step
+		if r := d - q; r > step/2 {
+			q += step
+		} else if r < -step/2 {
+			q -= step
+		}
+
+		p += q
+		if p < math.MinInt16 || p > math.MaxInt16 {
+			return nil, false
+		}
+		quantized[i] = uint16(int16(p))
+	}
+	return quantized, true
+}
+
+// DeltaSizeBytes is size of samples coded by AppendDelta with width.
+func DeltaSizeBytes(count, width int) int { return 2 + (count*width+7)/8 }
+
+// ReadDelta decodes len(samples) samples coded by AppendDelta.
+func ReadDelta(r io.Reader, prev uint16, samples []uint16) error {
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return err
+	}
+	shift, width := int(header[0]), int(header[1])
+	if shift > 15 || width > 16 {
+		return fmt.Errorf("delta of shift(%d) and width(%d) is out of bound", shift, width)
+	}
+
+	packed := make([]byte, DeltaSizeBytes(len(samples), width)-2)
+	if _, err := io.ReadFull(r, packed); err != nil {
+		return err
+	}
+
+	var acc uint64
+	n, j := 0, 0
+	for i := range samples {
+		for n < width {
+			acc = (acc << 8) | uint64(packed[j])
+			j++
+			n += 8
+		}
+		v := uint16(acc>>(n-width)) & uint16((1<<width)-1)
+		n -= width
+
+		prev += uint16(unzigzag(v) << shift)
+		samples[i] = prev
+	}
+	return nil
+}
+
+func zigzag(v int16) uint16 { return uint16((v << 1) ^ (v >> 15)) }
+
+func unzigzag(v uint16) int16 { return int16(v>>1) ^ -int16(v&1) }
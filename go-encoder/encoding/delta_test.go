@@ -0,0 +1,128 @@
+package encoding_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"math/rand/v2"
+	"slices"
+	"testing"
+
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/encoding"
+)
+
+func TestDelta(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+	noise := make([]uint16, 1000)
+	for i := range noise {
+		noise[i] = uint16(r.IntN(1 << 16))
+	}
+	drift := make([]uint16, 1000)
+	for i := range drift {
+		drift[i] = uint16(1000 + 64*(i/10) - 64*r.IntN(3))
+	}
+
+	tests := []struct {
+		name    string
+		prev    uint16
+		samples []uint16
+		size    int
+	}{
+		{name: "constant", prev: 7, samples: []uint16{7, 7, 7}, size: 2},
+		{name: "single", prev: 0, samples: []uint16{0xFFFF}, size: 3},
+		{name: "ramp", prev: 0, samples: []uint16{64, 128, 192, 256}, size: 3},
+		{name: "wraparound", prev: 0xFFFF, samples: []uint16{0, 0xFFFF, 0x8000, 0x7FFF}, size: 2 + 8},
+		{name: "noise", prev: 0, samples: noise},
+		{name: "drift", prev: 1000, samples: drift},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			b := encoding.AppendDelta(nil, tc.prev, tc.samples)
+			if tc.size > 0 && len(b) != tc.size {
+				t.Errorf("size(%d) != %d", len(b), tc.size)
+			}
+			if len(b) != encoding.DeltaSizeBytes(len(tc.samples), int(b[1])) {
+				t.Errorf("size(%d) != %d", len(b), encoding.DeltaSizeBytes(len(tc.samples), int(b[1])))
+			}
+
+			got := make([]uint16, len(tc.samples))
+			if err := encoding.ReadDelta(bytes.NewReader(b), tc.prev, got); err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tc.samples) {
+				t.Error(got, tc.samples)
+			}
+		})
+	}
+
+	t.Run("drift is smaller than raw", func(t *testing.T) {
+		if b := encoding.AppendDelta(nil, 1000, drift); len(b) >= len(drift)/2 {
+			t.Error(len(b))
+		}
+	})
+}
+
+func TestBlockMarker(t *testing.T) {
+	for _, m := range []encoding.BlockMarker{{Type: encoding.BlockCache, Count: 1}, {Type: encoding.BlockDelta, Count: 8191}} {
+		var b bytes.Buffer
+		if err := m.MarshalBinaryToWriter(&b, binary.LittleEndian); err != nil {
+			t.Fatal(err)
+		}
+		var got encoding.BlockMarker
+		if err := got.UnmarshalBinaryFromReader(&b, binary.LittleEndian); err != nil {
+			t.Fatal(err)
+		}
+		if got != m {
+			t.Error(got, m)
+		}
+	}
+
+	var got encoding.BlockMarker
+	if err := got.UnmarshalBinaryFromReader(bytes.NewReader([]byte{0, 0}), binary.LittleEndian); err != io.EOF {
+		t.Error(err)
+	}
+	if err := got.UnmarshalBinaryFromReader(bytes.NewReader([]byte{0b111, 0}), binary.LittleEndian); err == nil {
+		t.Error("expected error")
+	}
+	if err := (&encoding.BlockMarker{Type: encoding.BlockCache}).MarshalBinaryToWriter(io.Discard, binary.LittleEndian); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestQuantizeDelta(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+	samples := make([]uint16, 1000)
+	for i := range samples {
+		samples[i] = uint16(int16(r.IntN(2000) - 1000))
+	}
+
+	for _, maxError := range []int{0, 1, 2, 3, 10, 64, 1000} {
+		quantized, ok := encoding.QuantizeDelta(3, samples, maxError)
+		if !ok {
+			t.Fatal(maxError)
+		}
+		for i, v := range quantized {
+			if d := int(int16(v)) - int(int16(samples[i])); d < -maxError || d > maxError {
+				t.Fatalf("max error(%d): sample %d: error(%d)", maxError, i, d)
+			}
+		}
+
+		b := encoding.AppendDelta(nil, 3, quantized)
+		got := make([]uint16, len(quantized))
+		if err := encoding.ReadDelta(bytes.NewReader(b), 3, got); err != nil {
+			t.Fatal(err)
+		}
+		if !slices.Equal(got, quantized) {
+			t.Error(maxError, "wrong samples")
+		}
+		if maxError > 0 && len(b) >= len(encoding.AppendDelta(nil, 3, samples)) {
+			t.Error(maxError, "quantized is not smaller")
+		}
+	}
+}
+
+func TestQuantizeDelta_OutOfBound(t *testing.T) {
+	if _, ok := encoding.QuantizeDelta(0, []uint16{0x7FFF}, 100); ok {
+		t.Error("expected out of bound")
+	}
+}
@@ -69,6 +69,8 @@ func (s *Marker) UnmarshalBinaryFromReader(r io.Reader, endian binary.ByteOrder)
 		s.EncodingSize = 6
 	case 2:
 		s.EncodingSize = 7
+	default:
+		return fmt.Errorf("reserved encoding size marker %02b", encodingSizeMarker)
 	}
 
 	// restore two-s complement
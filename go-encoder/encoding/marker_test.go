@@ -81,3 +81,10 @@ func FuzzMarker(f *testing.F) {
 		}
 	})
 }
+
+func TestMarker_ReservedEncodingSize(t *testing.T) {
+	var marker encoding.Marker
+	if err := marker.UnmarshalBinaryFromReader(bytes.NewReader([]byte{0b00001011, 0}), binary.LittleEndian); err == nil {
+		t.Error("expected error")
+	}
+}
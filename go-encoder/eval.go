@@ -0,0 +1,174 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/cache"
+)
+
+type EvalConfig struct {
+	Path       string // zip archive with recordings, or directory of WAV
+	EncoderBin string // counted into compressed size, this executable if empty
+	DecoderBin string // counted into compressed size, this executable if empty
+}
+
+// truncate2 is ratio with 2 decimals as bc with scale=2 prints it.
+func truncate2(v float64) float64 { return math.Floor(v*100) / 100 }
+
+// percentile of sorted values with linear interpolation, p in [0, 1].
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	x := p * float64(len(sorted)-1)
+	i := int(x)
+	if i+1 >= len(sorted) {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[i] + (sorted[i+1]-sorted[i])*(x-float64(i))
+}
+
+func binSize(path string) (int64, error) {
+	if path == "" {
+		var err error
+		if path, err = os.Executable(); err != nil {
+			return 0, err
+		}
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	return info.Size(), nil
+}
+
+// eval round trips every file of archive as eval.sh of challenge does, and writes report.
+func eval(config EvalConfig, encoderConfig CacheSampleEncoderConfig, cacheConfig cache.Config, w io.Writer) error {
+	encoderSize, err := binSize(config.EncoderBin)
+	if err != nil {
+		return err
+	}
+	decoderSize, err := binSize(config.DecoderBin)
+	if err != nil {
+		return err
+	}
+
+	totalSizeRaw, totalSizeCompressed := int64(0), encoderSize+decoderSize
+	var ratios []float64
+
+	err = walkRecordings(config.Path, func(name string, original []byte) error {
+		fmt.Fprintf(w, "Processing %s\n", name)
+
+		encoded, err := encodeBytes(CacheCodec{}, encoderConfig, cacheConfig, original)
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		ratio := truncate2(float64(len(original)) / float64(len(encoded)))
+
+		// near-lossless decoded copy is within max error of original
+		if encoderConfig.MaxError > 0 {
+			result, err := verifyStream(encoderConfig.MaxError, encoderConfig, cacheConfig, InputConfig{Format: "wav"}, bytes.NewReader(original), bytes.NewReader(encoded))
+			if err != nil {
+				fmt.Fprintf(w, "ERROR: %s and its decoded copy are different by more than max error.\n", name)
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			fmt.Fprintf(w, "%s near-losslessly compressed from %d bytes to %d bytes, compression ratio(%.2f), max error(%d) rmse(%.3f)\n", name, len(original), len(encoded), ratio, result.MaxDiff, result.RMSE)
+		} else {
+			if err := verifyBytes(encoderConfig, cacheConfig, original, encoded); err != nil {
+				fmt.Fprintf(w, "ERROR: %s and its decoded copy are different.\n", name)
+				return fmt.Errorf("%s: %w", name, err)
+			}
+			fmt.Fprintf(w, "%s losslessly compressed from %d bytes to %d bytes, compression ratio(%.2f)\n", name, len(original), len(encoded), ratio)
+		}
+
+		totalSizeRaw += int64(len(original))
+		totalSizeCompressed += int64(len(encoded))
+		ratios = append(ratios, ratio)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintln(w, "All recordings successfully compressed.")
+	fmt.Fprintf(w, "Original size (bytes): %d\n", totalSizeRaw)
+	fmt.Fprintf(w, "Compressed size (bytes): %d\n", totalSizeCompressed)
+	fmt.Fprintf(w, "Compression ratio: %.2f\n", truncate2(float64(totalSizeRaw)/float64(totalSizeCompressed)))
+
+	slices.Sort(ratios)
+	fmt.Fprintf(w, "Files: %d\n", len(ratios))
+	for _, p := range []float64{0, 0.01, 0.1, 0.25, 0.5, 0.75, 0.9, 0.99, 1} {
+		fmt.Fprintf(w, "Ratio p%g: %.2f\n", p*100, percentile(ratios, p))
+	}
+	return nil
+}
+
+// walkRecordings calls f for every file of zip archive, or every WAV of directory, sorted by name, or for file itself.
+func walkRecordings(path string, f func(name string, data []byte) error) error {
+	if strings.EqualFold(filepath.Ext(path), ".zip") {
+		archive, err := zip.OpenReader(path)
+		if err != nil {
+			return err
+		}
+		defer archive.Close()
+
+		files := slices.Clone(archive.File)
+		files = slices.DeleteFunc(files, func(f *zip.File) bool { return f.FileInfo().IsDir() || strings.HasPrefix(f.Name, "__MACOSX/") })
+		slices.SortFunc(files, func(a, b *zip.File) int { return strings.Compare(a.Name, b.Name) })
+
+		for _, file := range files {
+			data, err := readZipFile(file)
+			if err != nil {
+				return err
+			}
+			if err := f(file.Name, data); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return f(filepath.Base(path), data)
+	}
+
+	return filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() || !strings.EqualFold(filepath.Ext(p), ".wav") {
+			return nil
+		}
+		name, err := filepath.Rel(path, p)
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		return f(filepath.ToSlash(name), data)
+	})
+}
+
+func readZipFile(f *zip.File) ([]byte, error) {
+	r, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	return io.ReadAll(r)
+}
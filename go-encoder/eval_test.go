@@ -0,0 +1,23 @@
+package main
+
+import "testing"
+
+func TestPercentile(t *testing.T) {
+	sorted := []float64{1, 2, 3, 4, 5}
+	for p, exp := range map[float64]float64{0: 1, 0.5: 3, 1: 5, 0.1: 1.4, 0.99: 4.96} {
+		if got := percentile(sorted, p); got-exp > 1e-9 || exp-got > 1e-9 {
+			t.Errorf("p%v: %v != %v", p, got, exp)
+		}
+	}
+	if got := percentile(nil, 0.5); got != 0 {
+		t.Error(got)
+	}
+}
+
+func TestTruncate2(t *testing.T) {
+	for v, exp := range map[float64]float64{3.339: 3.33, 1: 1, 2.999: 2.99} {
+		if got := truncate2(v); got != exp {
+			t.Errorf("%v: %v != %v", v, got, exp)
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/cache"
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/container"
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/spike"
+)
+
+// EventsConfig is detection of spikes and their output.
+type EventsConfig struct {
+	Spike      spike.Config
+	Refractory time.Duration // converted to samples by sample rate of input
+	Encoded    bool          // input is encoded stream, container is detected regardless
+	Format     string        // csv or json
+}
+
+// Events is spikes of input.
+type Events struct {
+	SampleRate float64       `json:"sample_rate"`
+	NumSamples int           `json:"num_samples"`
+	Events     []spike.Event `json:"events"`
+}
+
+// decodeSamples decodes samples of encoded stream in memory, with layout of original input.
+func decodeSamples(encoderConfig CacheSampleEncoderConfig, cacheConfig cache.Config, r *bufio.Reader) ([]uint16, StreamLayout, error) {
+	stream, err := openStream(encoderConfig, cacheConfig, r)
+	if err != nil {
+		return nil, StreamLayout{}, err
+	}
+	if stream.MTU > 0 {
+		return nil, StreamLayout{}, errors.New("stream of packets has to be decoded first")
+	}
+	layout, err := streamLayout(stream.Header)
+	if err != nil {
+		return nil, StreamLayout{}, err
+	}
+
+	var samples []uint16
+	for {
+		sample, err := stream.Decoder.Next()
+		if err == io.EOF {
+			return samples, layout, nil
+		}
+		if err != nil {
+			return nil, StreamLayout{}, err
+		}
+		samples = append(samples, sample)
+	}
+}
+
+// readEventSamples reads samples of input, which is decoded when it is encoded.
+func readEventSamples(config EventsConfig, encoderConfig CacheSampleEncoderConfig, cacheConfig cache.Config, inputConfig InputConfig, r *bufio.Reader) ([]uint16, StreamLayout, error) {
+	if b, _ := r.Peek(len(container.Magic)); config.Encoded || container.IsContainer(b) {
+		return decodeSamples(encoderConfig, cacheConfig, r)
+	}
+
+	sampleReader, _, err := newSampleReader(inputConfig, r)
+	if err != nil {
+		return nil, StreamLayout{}, err
+	}
+	layout := StreamLayout{NumSamples: -1}
+	layout.SampleRate, layout.NumChannels = sampleLayout(sampleReader)
+	samples, err := readAllSamples(sampleReader)
+	return samples, layout, err
+}
+
+// detectEvents writes spikes of single channel input as CSV or JSON.
+func detectEvents(config EventsConfig, encoderConfig CacheSampleEncoderConfig, cacheConfig cache.Config, inputConfig InputConfig, r *bufio.Reader, w io.Writer) error {
+	if config.Format != "csv" && config.Format != "json" {
+		return fmt.Errorf("unknown format of events: %s", config.Format)
+	}
+
+	samples, layout, err := readEventSamples(config, encoderConfig, cacheConfig, inputConfig, r)
+	if err != nil {
+		return err
+	}
+	if layout.NumChannels != 1 {
+		return fmt.Errorf("spikes require single channel, got %d", layout.NumChannels)
+	}
+	// times and refractory period are by sample rate
+	if layout.SampleRate == 0 {
+		return errors.New("spikes require sample rate of input")
+	}
+	sampleRate := layout.SampleRate
+
+	config.Spike.Refractory = int(config.Refractory.Seconds() * sampleRate)
+	events, err := spike.Events(config.Spike, sampleRate, samples)
+	if err != nil {
+		return err
+	}
+	slog.Info("spikes", "samples", len(samples), "events", len(events))
+
+	result := Events{SampleRate: sampleRate, NumSamples: len(samples), Events: events}
+	if config.Format == "json" {
+		return writeEventsJSON(result, w)
+	}
+	return writeEventsCSV(result, w)
+}
+
+func writeEventsJSON(events Events, w io.Writer) error {
+	if events.Events == nil {
+		events.Events = []spike.Event{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(events)
+}
+
+// writeEventsCSV writes event per row, waveform is space separated samples.
+func writeEventsCSV(events Events, w io.Writer) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"sample", "time", "peak", "amplitude", "waveform"})
+
+	var waveform []string
+	for _, e := range events.Events {
+		waveform = waveform[:0]
+		for _, v := range e.Waveform {
+			waveform = append(waveform, strconv.Itoa(int(v)))
+		}
+		cw.Write([]string{
+			strconv.Itoa(e.Sample),
+			strconv.FormatFloat(e.Time, 'f', 6, 64),
+			strconv.Itoa(e.Peak),
+			strconv.FormatFloat(e.Amplitude, 'f', 3, 64),
+			strings.Join(waveform, " "),
+		})
+	}
+
+	cw.Flush()
+	return cw.Error()
+}
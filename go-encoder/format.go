@@ -0,0 +1,497 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/container"
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/edf"
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/input"
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/npy"
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/pcm"
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/wav"
+)
+
+// SampleReader reads samples of input in any format.
+type SampleReader interface {
+	ReadSamples(p []uint16) (int, error)
+	Trailer() io.Reader
+}
+
+type SampleWriter interface {
+	WriteSamples(p []uint16) error
+}
+
+type InputConfig struct {
+	Format string
+	Path   string // for formats that are directories
+	PCM    pcm.Format
+	Lossy  bool // samples are encoded with error, which requires samples of signed 16 bit values
+}
+
+// sampleLayout is sample rate and number of interleaved channels of input, sample rate is zero if unknown.
+func sampleLayout(r SampleReader) (sampleRate float64, numChannels int) {
+	switch r := r.(type) {
+	case *wav.WAVReader:
+		return float64(r.Header.SampleRate), int(r.Header.NumChannels)
+	case *pcm.Reader:
+		return float64(r.Format.SampleRate), int(r.Format.NumChannels)
+	case *npy.Reader:
+		if !r.Header.FortranOrder && r.Header.ItemSize() == 2 {
+			return 0, r.Header.NumChannels()
+		}
+	case *input.OpenEphysReader:
+		if len(r.Structure.Continuous) == 1 {
+			return r.Structure.Continuous[0].SampleRate, r.Structure.Continuous[0].NumChannels
+		}
+	}
+	return 0, 1
+}
+
+// isInt16 is true when each sample of input is signed 16 bit value, so that error of sample is error of value.
+// Other inputs have words of values of other types, or of timestamps and annotations, error of which is not bound.
+func isInt16(r SampleReader) bool {
+	switch r := r.(type) {
+	case *wav.WAVReader, *input.OpenEphysReader:
+		return true
+	case *pcm.Reader:
+		return r.Format.BitsPerSample == 16
+	case *npy.Reader:
+		return r.Header.Kind() == "i2"
+	case *edf.Reader:
+		return !r.Header.IsBDF() && !slices.ContainsFunc(r.Header.Signals, edf.Signal.IsAnnotations)
+	}
+	return false
+}
+
+// StreamLayout is layout of samples of original input of encoded stream, as far as its metadata tells.
+type StreamLayout struct {
+	NumSamples  int     // 16 bit words of samples, -1 if unknown
+	SampleRate  float64 // 0 if unknown or different among channels
+	NumChannels int
+}
+
+// streamLayout is layout of samples of input by metadata in header of encoded stream.
+func streamLayout(header container.Header) (StreamLayout, error) {
+	layout := StreamLayout{NumSamples: -1, NumChannels: 1}
+	metadata, ok := header.Section(container.SectionMetadata)
+	if !ok {
+		return layout, fmt.Errorf("%s format requires metadata", header.Format)
+	}
+
+	switch header.Format {
+	case container.FormatWAV:
+		var wavHeader wav.WAVHeader
+		if err := wavHeader.UnmarshalBinary(bytes.NewReader(metadata)); err != nil {
+			return layout, err
+		}
+		layout.NumSamples = int(wavHeader.DataSize() / wav.SampleSize)
+		layout.SampleRate, layout.NumChannels = float64(wavHeader.SampleRate), int(wavHeader.NumChannels)
+	case container.FormatRaw:
+		var format pcm.Format
+		if err := format.UnmarshalBinary(metadata); err != nil {
+			return layout, err
+		}
+		layout.SampleRate, layout.NumChannels = float64(format.SampleRate), int(format.NumChannels)
+	case container.FormatNPY:
+		npyReader := npy.NewReader(bytes.NewReader(metadata))
+		if err := npyReader.ReadHeader(); err != nil {
+			return layout, err
+		}
+		layout.NumSamples, layout.NumChannels = int(npyReader.Header.DataSize()/2), npyReader.Header.NumChannels()
+	case container.FormatEDF:
+		edfReader := edf.NewReader(bytes.NewReader(metadata))
+		if err := edfReader.ReadHeader(); err != nil {
+			return layout, err
+		}
+		h := edfReader.Header
+		if h.NumRecords >= 0 && !h.IsBDF() {
+			layout.NumSamples = h.NumRecords * h.RecordSize() / 2
+		}
+		layout.NumChannels = len(h.Signals)
+		for i, q := range h.Signals {
+			if h.RecordDuration <= 0 {
+				break
+			}
+			if rate := float64(q.SamplesPerRecord) / h.RecordDuration; i == 0 || rate == layout.SampleRate {
+				layout.SampleRate = rate
+				continue
+			}
+			layout.SampleRate = 0
+			break
+		}
+	case container.FormatOpenEphys, container.FormatIntan:
+		var info input.Metadata
+		if err := json.Unmarshal(metadata, &info); err != nil {
+			return layout, err
+		}
+		if header.Format == container.FormatOpenEphys {
+			layout.NumSamples = 0
+			for _, f := range info.Files {
+				layout.NumSamples += int(f.Size / 2)
+			}
+		}
+		layout.NumChannels = len(info.Channels)
+		for i, c := range info.Channels {
+			if i == 0 || c.SampleRate == layout.SampleRate {
+				layout.SampleRate = c.SampleRate
+				continue
+			}
+			layout.SampleRate = 0
+			break
+		}
+	default:
+		return layout, fmt.Errorf("unsupported format: %s", header.Format)
+	}
+	return layout, nil
+}
+
+func inputMetadataHeader(format container.Format, metadata input.Metadata) (container.Header, error) {
+	b, err := json.Marshal(metadata)
+	if err != nil {
+		return container.Header{}, err
+	}
+
+	return container.Header{
+		Version:  container.Version,
+		Format:   format,
+		Sections: []container.Section{{Kind: container.SectionMetadata, Data: b}},
+	}, nil
+}
+
+// NewSampleReader reads header of input and writes header of encoded stream to w.
+// Sections are added to container, WAV is written in container if there are any.
+func NewSampleReader(config InputConfig, r io.Reader, w io.Writer, sections ...container.Section) (SampleReader, error) {
+	sampleReader, header, err := newSampleReader(config, r)
+	if err != nil {
+		return nil, err
+	}
+	return sampleReader, writeStreamHeader(header, w, sections...)
+}
+
+// writeStreamHeader writes header of encoded stream with sections added, WAV is written in container if there are any.
+func writeStreamHeader(header container.Header, w io.Writer, sections ...container.Section) error {
+	if header.Format == container.FormatWAV && len(sections) == 0 {
+		// original header as is
+		metadata, _ := header.Section(container.SectionMetadata)
+		_, err := w.Write(metadata)
+		return err
+	}
+
+	header.Sections = append(slices.Clone(header.Sections), sections...)
+	return header.MarshalBinary(w)
+}
+
+func newSampleReader(config InputConfig, r io.Reader) (SampleReader, container.Header, error) {
+	sampleReader, header, err := readInputHeader(config, r)
+	if err == nil && config.Lossy && !isInt16(sampleReader) {
+		err = fmt.Errorf("error of samples requires signed 16 bit samples, which %s input does not have", config.Format)
+	}
+	return sampleReader, header, err
+}
+
+func readInputHeader(config InputConfig, r io.Reader) (SampleReader, container.Header, error) {
+	switch config.Format {
+	case "wav":
+		wavReader := wav.NewWAVReader(r)
+		if err := wavReader.ReadHeader(); err != nil {
+			return nil, container.Header{}, err
+		}
+
+		slog.Info("wav info", "header", wavReader.Header, "PCM", wavReader.Header.IsPCM())
+
+		if err := ValidateWAVHeader(wavReader.Header); err != nil {
+			return nil, container.Header{}, err
+		}
+
+		var metadata bytes.Buffer
+		if err := wavReader.Header.MarshalBinary(&metadata); err != nil {
+			return nil, container.Header{}, err
+		}
+
+		header := container.Header{
+			Version:  container.Version,
+			Format:   container.FormatWAV,
+			Sections: []container.Section{{Kind: container.SectionMetadata, Data: metadata.Bytes()}},
+		}
+		return wavReader, header, nil
+	case "raw":
+		if err := config.PCM.Validate(); err != nil {
+			return nil, container.Header{}, err
+		}
+
+		slog.Info("raw info", "format", config.PCM)
+
+		metadata, err := config.PCM.MarshalBinary()
+		if err != nil {
+			return nil, container.Header{}, err
+		}
+
+		header := container.Header{
+			Version:  container.Version,
+			Format:   container.FormatRaw,
+			Sections: []container.Section{{Kind: container.SectionMetadata, Data: metadata}},
+		}
+		return pcm.NewReader(config.PCM, r), header, nil
+	case "npy":
+		npyReader := npy.NewReader(r)
+		if err := npyReader.ReadHeader(); err != nil {
+			return nil, container.Header{}, err
+		}
+
+		slog.Info("npy info", "header", npyReader.Header)
+
+		header := container.Header{
+			Version:  container.Version,
+			Format:   container.FormatNPY,
+			Sections: []container.Section{{Kind: container.SectionMetadata, Data: npyReader.RawHeader()}},
+		}
+		return npyReader, header, nil
+	case "edf":
+		edfReader := edf.NewReader(r)
+		if err := edfReader.ReadHeader(); err != nil {
+			return nil, container.Header{}, err
+		}
+
+		slog.Info("edf info", "header", edfReader.Header, "BDF", edfReader.Header.IsBDF())
+
+		header := container.Header{
+			Version:  container.Version,
+			Format:   container.FormatEDF,
+			Sections: []container.Section{{Kind: container.SectionMetadata, Data: edfReader.RawHeader()}},
+		}
+		return edfReader, header, nil
+	case "openephys":
+		openEphysReader, err := input.NewOpenEphysReader(config.Path)
+		if err != nil {
+			return nil, container.Header{}, err
+		}
+
+		slog.Info("open ephys info", "files", openEphysReader.Metadata.Files, "channels", openEphysReader.Metadata.Channels)
+
+		header, err := inputMetadataHeader(container.FormatOpenEphys, openEphysReader.Metadata)
+		return openEphysReader, header, err
+	case "intan":
+		intanReader := input.NewIntanReader(r)
+		if err := intanReader.ReadHeader(); err != nil {
+			return nil, container.Header{}, err
+		}
+
+		slog.Info("intan info", "header", intanReader.Header)
+
+		header, err := inputMetadataHeader(container.FormatIntan, intanReader.Metadata)
+		return intanReader, header, err
+	default:
+		return nil, container.Header{}, fmt.Errorf("unknown format: %s", config.Format)
+	}
+}
+
+// Output is where decoded stream is written.
+// It is single file, or directory for formats that have many files.
+type Output struct {
+	Path    string    // stdout if empty
+	Writer  io.Writer // instead of Path for single file
+	Stream  bool      // samples are flushed as soon as there is no more of input to decode them from
+	files   []*os.File
+	writers []*bufio.Writer
+}
+
+// Create makes file within output, empty name is output itself.
+func (s *Output) Create(name string) (*bufio.Writer, error) {
+	var f *os.File
+	switch {
+	case name == "" && s.Writer != nil:
+		w := bufio.NewWriter(s.Writer)
+		s.files = append(s.files, nil)
+		s.writers = append(s.writers, w)
+		return w, nil
+	case name == "" && s.Path == "":
+		f = os.Stdout
+	case name == "":
+		var err error
+		if f, err = os.Create(s.Path); err != nil {
+			return nil, err
+		}
+	case s.Path == "":
+		return nil, fmt.Errorf("can not write file(%s) to stdout, output directory required", name)
+	case !filepath.IsLocal(name):
+		return nil, fmt.Errorf("file(%s) is not within output directory", name)
+	default:
+		p := filepath.Join(s.Path, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			return nil, err
+		}
+		var err error
+		if f, err = os.Create(p); err != nil {
+			return nil, err
+		}
+	}
+
+	w := bufio.NewWriter(f)
+	s.files = append(s.files, f)
+	s.writers = append(s.writers, w)
+	return w, nil
+}
+
+// Flush writes buffered data to files of output.
+func (s *Output) Flush() error {
+	var errs []error
+	for _, w := range s.writers {
+		errs = append(errs, w.Flush())
+	}
+	return errors.Join(errs...)
+}
+
+func (s *Output) Close() error {
+	var errs []error
+	for i, w := range s.writers {
+		errs = append(errs, w.Flush())
+		if s.files[i] != nil && s.files[i] != os.Stdout {
+			errs = append(errs, s.files[i].Close())
+		}
+	}
+	s.files, s.writers = nil, nil
+	return errors.Join(errs...)
+}
+
+// ReadStreamHeader reads header of encoded stream.
+// Original WAV header is read into container of WAV format.
+func ReadStreamHeader(r *bufio.Reader) (container.Header, error) {
+	if b, _ := r.Peek(len(container.Magic)); !container.IsContainer(b) {
+		var header wav.WAVHeader
+		if err := header.UnmarshalBinary(r); err != nil {
+			return container.Header{}, err
+		}
+
+		var metadata bytes.Buffer
+		if err := header.MarshalBinary(&metadata); err != nil {
+			return container.Header{}, err
+		}
+
+		return container.Header{
+			Version:  container.Version,
+			Format:   container.FormatWAV,
+			Sections: []container.Section{{Kind: container.SectionMetadata, Data: metadata.Bytes()}},
+		}, nil
+	}
+
+	var header container.Header
+	if err := header.UnmarshalBinary(r); err != nil {
+		return container.Header{}, err
+	}
+
+	slog.Info("container info", "version", header.Version, "format", header.Format)
+	return header, nil
+}
+
+// NewSampleWriter writes header of output for header of encoded stream.
+// Trailer of input is written to returned writer, which is nil for formats without trailer.
+func NewSampleWriter(header container.Header, output *Output) (SampleWriter, io.Writer, error) {
+	metadata, ok := header.Section(container.SectionMetadata)
+	if !ok {
+		return nil, nil, fmt.Errorf("%s format requires metadata", header.Format)
+	}
+
+	switch header.Format {
+	case container.FormatWAV:
+		var wavHeader wav.WAVHeader
+		if err := wavHeader.UnmarshalBinary(bytes.NewReader(metadata)); err != nil {
+			return nil, nil, err
+		}
+
+		w, err := output.Create("")
+		if err != nil {
+			return nil, nil, err
+		}
+
+		wavWriter := wav.NewWAVWriter(wavHeader, w)
+		return wavWriter, w, wavWriter.WriteHeader()
+	case container.FormatRaw:
+		var format pcm.Format
+		if err := format.UnmarshalBinary(metadata); err != nil {
+			return nil, nil, err
+		}
+
+		slog.Info("raw info", "format", format)
+
+		w, err := output.Create("")
+		if err != nil {
+			return nil, nil, err
+		}
+		return pcm.NewWriter(format, w), w, nil
+	case container.FormatNPY:
+		npyReader := npy.NewReader(bytes.NewReader(metadata))
+		if err := npyReader.ReadHeader(); err != nil {
+			return nil, nil, err
+		}
+
+		slog.Info("npy info", "header", npyReader.Header)
+
+		w, err := output.Create("")
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// original header as is
+		if _, err := w.Write(metadata); err != nil {
+			return nil, nil, err
+		}
+		return npy.NewWriter(npyReader.Header, w), w, nil
+	case container.FormatEDF:
+		edfReader := edf.NewReader(bytes.NewReader(metadata))
+		if err := edfReader.ReadHeader(); err != nil {
+			return nil, nil, err
+		}
+
+		slog.Info("edf info", "header", edfReader.Header, "BDF", edfReader.Header.IsBDF())
+
+		w, err := output.Create("")
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// original header as is
+		if _, err := w.Write(metadata); err != nil {
+			return nil, nil, err
+		}
+		return edf.NewWriter(edfReader.Header, w), w, nil
+	case container.FormatOpenEphys:
+		var info input.Metadata
+		if err := json.Unmarshal(metadata, &info); err != nil {
+			return nil, nil, err
+		}
+
+		slog.Info("open ephys info", "files", info.Files, "channels", info.Channels)
+
+		openEphysWriter, err := input.NewOpenEphysWriter(info, func(name string) (io.Writer, error) { return output.Create(name) })
+		return openEphysWriter, nil, err
+	case container.FormatIntan:
+		var info input.Metadata
+		if err := json.Unmarshal(metadata, &info); err != nil {
+			return nil, nil, err
+		}
+
+		slog.Info("intan info", "channels", info.Channels)
+
+		w, err := output.Create("")
+		if err != nil {
+			return nil, nil, err
+		}
+
+		// original header as is
+		if _, err := w.Write(info.Header); err != nil {
+			return nil, nil, err
+		}
+		return pcm.NewWriter(pcm.Format{NumChannels: 1, BitsPerSample: 16}, w), w, nil
+	default:
+		return nil, nil, fmt.Errorf("unsupported format: %s", header.Format)
+	}
+}
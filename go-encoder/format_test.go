@@ -0,0 +1,26 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOutput_Create_NotLocal(t *testing.T) {
+	dir := t.TempDir()
+	output := &Output{Path: filepath.Join(dir, "out")}
+	defer output.Close()
+
+	for _, name := range []string{"../x", "../../x", "/x", "a/../../x"} {
+		if _, err := output.Create(name); err == nil {
+			t.Errorf("%s: expected error", name)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "x")); !os.IsNotExist(err) {
+		t.Errorf("file outside output: %v", err)
+	}
+
+	if _, err := output.Create(filepath.Join("a", "b")); err != nil {
+		t.Error(err)
+	}
+}
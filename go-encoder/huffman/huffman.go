@@ -0,0 +1,195 @@
+// Package huffman is canonical Huffman coding of bytes.
+//
+//	Length uint32, number of bytes
+//	code lengths of 256 symbols, 4 bits each, high bits first, absent if Length is zero
+//	codes, most significant bit first, padded by zeros to byte
+package huffman
+
+import (
+	"container/heap"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// MaxCodeLen fits into 4 bits.
+const MaxCodeLen = 15
+
+var ErrCorrupt = errors.New("corrupt huffman data")
+
+type node struct {
+	count       int
+	symbol      int // leaf if not negative
+	left, right *node
+}
+
+type nodes []*node
+
+func (s nodes) Len() int           { return len(s) }
+func (s nodes) Less(i, j int) bool { return s[i].count < s[j].count }
+func (s nodes) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
+func (s *nodes) Push(x any)        { *s = append(*s, x.(*node)) }
+func (s *nodes) Pop() any {
+	old := *s
+	v := old[len(old)-1]
+	*s = old[:len(old)-1]
+	return v
+}
+
+// CodeLengths of symbols by their counts, at most MaxCodeLen.
+func CodeLengths(counts [256]int) (lengths [256]uint8) {
+	for {
+		var h nodes
+		for symbol, count := range counts {
+			if count > 0 {
+				h = append(h, &node{count: count, symbol: symbol})
+			}
+		}
+		switch len(h) {
+		case 0:
+			return lengths
+		case 1:
+			lengths[h[0].symbol] = 1
+			return lengths
+		}
+
+		heap.Init(&h)
+		for h.Len() > 1 {
+			a, b := heap.Pop(&h).(*node), heap.Pop(&h).(*node)
+			heap.Push(&h, &node{count: a.count + b.count, symbol: -1, left: a, right: b})
+		}
+
+		maxLen := 0
+		var walk func(n *node, depth int)
+		walk = func(n *node, depth int) {
+			if n.symbol >= 0 {
+				lengths[n.symbol] = uint8(depth)
+				maxLen = max(maxLen, depth)
+				return
+			}
+			walk(n.left, depth+1)
+			walk(n.right, depth+1)
+		}
+		walk(h[0], 0)
+
+		if maxLen <= MaxCodeLen {
+			return lengths
+		}
+
+		// flatten counts until tree is shallow enough
+		for i := range counts {
+			if counts[i] > 0 {
+				counts[i] = (counts[i] + 1) / 2
+			}
+		}
+	}
+}
+
+// canonical symbols sorted by code length and then by value, with number of codes of each length.
+func canonical(lengths [256]uint8) (symbols []int, numCodes [MaxCodeLen + 1]int) {
+	for symbol, n := range lengths {
+		if n > 0 {
+			symbols = append(symbols, symbol)
+			numCodes[n]++
+		}
+	}
+	slices.SortStableFunc(symbols, func(a, b int) int { return int(lengths[a]) - int(lengths[b]) })
+	return symbols, numCodes
+}
+
+func Encode(data []byte) []byte {
+	b := binary.LittleEndian.AppendUint32(nil, uint32(len(data)))
+	if len(data) == 0 {
+		return b
+	}
+
+	var counts [256]int
+	for _, v := range data {
+		counts[v]++
+	}
+	lengths := CodeLengths(counts)
+	for i := 0; i < len(lengths); i += 2 {
+		b = append(b, lengths[i]<<4|lengths[i+1])
+	}
+
+	var codes [256]uint16
+	symbols, _ := canonical(lengths)
+	code, prevLen := uint16(0), uint8(0)
+	for _, symbol := range symbols {
+		code <<= lengths[symbol] - prevLen
+		codes[symbol] = code
+		code++
+		prevLen = lengths[symbol]
+	}
+
+	var acc uint64
+	n := 0
+	for _, v := range data {
+		acc = (acc << lengths[v]) | uint64(codes[v])
+		n += int(lengths[v])
+		for n >= 8 {
+			b = append(b, byte(acc>>(n-8)))
+			n -= 8
+		}
+	}
+	if n > 0 {
+		b = append(b, byte(acc<<(8-n)))
+	}
+	return b
+}
+
+func Decode(b []byte) ([]byte, error) {
+	if len(b) < 4 {
+		return nil, ErrCorrupt
+	}
+	size := int(binary.LittleEndian.Uint32(b))
+	if size == 0 {
+		return nil, nil
+	}
+	b = b[4:]
+	if len(b) < 128 {
+		return nil, ErrCorrupt
+	}
+
+	var lengths [256]uint8
+	for i, v := range b[:128] {
+		lengths[2*i], lengths[2*i+1] = v>>4, v&0xF
+	}
+	b = b[128:]
+
+	symbols, numCodes := canonical(lengths)
+	if len(symbols) == 0 {
+		return nil, ErrCorrupt
+	}
+	if size > len(b)*8 {
+		return nil, fmt.Errorf("%w: %d bytes do not fit into %d bytes of codes", ErrCorrupt, size, len(b))
+	}
+
+	data := make([]byte, 0, size)
+	pos := 0 // bit
+	for len(data) < size {
+		code, first, index := 0, 0, 0
+		found := false
+		for n := 1; n <= MaxCodeLen; n++ {
+			if pos >= len(b)*8 {
+				return nil, ErrCorrupt
+			}
+			code |= int(b[pos/8]>>(7-pos%8)) & 1
+			pos++
+
+			if count := numCodes[n]; code-first < count {
+				data = append(data, byte(symbols[index+code-first]))
+				found = true
+				break
+			}
+			index += numCodes[n]
+			first = (first + numCodes[n]) << 1
+			code <<= 1
+		}
+		if !found {
+			return nil, ErrCorrupt
+		}
+	}
+	return data, nil
+}
@@ -0,0 +1,81 @@
+package huffman_test
+
+import (
+	"bytes"
+	"math/rand/v2"
+	"testing"
+
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/huffman"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+
+	skewed := make([]byte, 10000)
+	for i := range skewed {
+		skewed[i] = byte(r.ExpFloat64() * 3)
+	}
+	uniform := make([]byte, 10000)
+	for i := range uniform {
+		uniform[i] = byte(r.IntN(256))
+	}
+	// fibonacci counts make deepest trees
+	var deep []byte
+	a, b := 1, 1
+	for symbol := range 30 {
+		deep = append(deep, bytes.Repeat([]byte{byte(symbol)}, a)...)
+		a, b = b, a+b
+	}
+
+	tests := map[string][]byte{
+		"empty":   nil,
+		"single":  {42},
+		"one":     bytes.Repeat([]byte{7}, 100),
+		"two":     []byte("abababababbbbbbb"),
+		"skewed":  skewed,
+		"uniform": uniform,
+		"deep":    deep,
+	}
+	for name, data := range tests {
+		t.Run(name, func(t *testing.T) {
+			encoded := huffman.Encode(data)
+			decoded, err := huffman.Decode(encoded)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(decoded, data) {
+				t.Error("decoded is different")
+			}
+			t.Logf("%d -> %d bytes", len(data), len(encoded))
+		})
+	}
+
+	t.Run("skewed is smaller", func(t *testing.T) {
+		if n := len(huffman.Encode(skewed)); n > len(skewed)/2 {
+			t.Error(n)
+		}
+	})
+}
+
+func TestCodeLengths_Limited(t *testing.T) {
+	var counts [256]int
+	a, b := 1, 1
+	for i := range 40 {
+		counts[i] = a
+		a, b = b, a+b
+	}
+	for symbol, n := range huffman.CodeLengths(counts) {
+		if n > huffman.MaxCodeLen || (counts[symbol] > 0 && n == 0) {
+			t.Errorf("symbol(%d) of length %d", symbol, n)
+		}
+	}
+}
+
+func TestDecode_Corrupt(t *testing.T) {
+	encoded := huffman.Encode([]byte("hello, world"))
+	for _, b := range [][]byte{nil, encoded[:3], encoded[:20], encoded[:len(encoded)-1]} {
+		if _, err := huffman.Decode(b); err == nil {
+			t.Errorf("expected error for %d bytes", len(b))
+		}
+	}
+}
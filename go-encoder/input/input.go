@@ -0,0 +1,32 @@
+// Package input reads recordings of acquisition systems other than WAV.
+package input
+
+import (
+	"bytes"
+	"io"
+)
+
+// Channel is metadata of recorded channel, physical value is Gain * (sample - Offset) in Units.
+type Channel struct {
+	Name       string  `json:"name"`
+	SampleRate float64 `json:"sample_rate"`
+	Gain       float64 `json:"gain"`
+	Offset     float64 `json:"offset,omitempty"`
+	Units      string  `json:"units,omitempty"`
+}
+
+// File is part of recording, samples of files are read one after another.
+type File struct {
+	Name string `json:"name"`
+	Size int64  `json:"size"`
+}
+
+// Metadata is everything besides samples that is needed to restore recording.
+type Metadata struct {
+	Header   []byte    `json:"header"`
+	Files    []File    `json:"files,omitempty"`
+	Channels []Channel `json:"channels"`
+}
+
+// emptyTrailer is for formats that have nothing after samples.
+func emptyTrailer() io.Reader { return bytes.NewReader(nil) }
@@ -0,0 +1,181 @@
+package input_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/input"
+)
+
+func readAll(t *testing.T, r interface {
+	ReadSamples(p []uint16) (int, error)
+}) []uint16 {
+	var all []uint16
+	p := make([]uint16, 7)
+	for {
+		n, err := r.ReadSamples(p)
+		all = append(all, p[:n]...)
+		if err == io.EOF {
+			return all
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestOpenEphysReaderWriter(t *testing.T) {
+	dir := filepath.Join("testdata", "openephys")
+
+	r, err := input.NewOpenEphysReader(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	if len(r.Metadata.Channels) != 2 || r.Metadata.Channels[1].Name != "CH2" || r.Metadata.Channels[1].Gain != 0.195 || r.Metadata.Channels[0].SampleRate != 30000 {
+		t.Errorf("wrong channels %#v", r.Metadata.Channels)
+	}
+
+	samples := readAll(t, r)
+	if len(samples) != 1200 {
+		t.Errorf("number of samples %d", len(samples))
+	}
+
+	out := t.TempDir()
+	w, err := input.NewOpenEphysWriter(r.Metadata, func(name string) (io.Writer, error) {
+		p := filepath.Join(out, name)
+		os.MkdirAll(filepath.Dir(p), 0755)
+		return os.Create(p)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteSamples(samples); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	for _, name := range []string{input.OpenEphysStructureFileName, r.Structure.Continuous[0].DataFileName()} {
+		exp, _ := os.ReadFile(filepath.Join(dir, name))
+		got, _ := os.ReadFile(filepath.Join(out, name))
+		if !bytes.Equal(exp, got) {
+			t.Errorf("%s is not the same", name)
+		}
+	}
+}
+
+func TestOpenEphysWriter_HostileName(t *testing.T) {
+	r, err := input.NewOpenEphysReader(filepath.Join("testdata", "openephys"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+
+	hostile := r.Metadata
+	hostile.Files = []input.File{{Name: "../../x", Size: hostile.Files[0].Size}}
+
+	// folder of stream in structure escapes output as well
+	escaping := r.Metadata
+	escaping.Header = bytes.Replace(r.Metadata.Header, []byte(`"folder_name": "`), []byte(`"folder_name": "../../`), 1)
+	escaping.Files = []input.File{{Name: filepath.Join("continuous", "../../"+r.Structure.Continuous[0].FolderName, "continuous.dat")}}
+
+	for _, metadata := range []input.Metadata{hostile, escaping} {
+		var created []string
+		_, err := input.NewOpenEphysWriter(metadata, func(name string) (io.Writer, error) {
+			created = append(created, name)
+			return io.Discard, nil
+		})
+		if err == nil || len(created) > 0 {
+			t.Errorf("%v: expected error, created(%v)", metadata.Files, created)
+		}
+	}
+}
+
+func TestIntanReader(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "recording.rhd"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	r := input.NewIntanReader(f)
+	if err := r.ReadHeader(); err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Header.SampleRate != 20000 || r.Header.Notes[0] != "note one" || len(r.Header.Channels) != 5 {
+		t.Errorf("wrong header %#v", r.Header)
+	}
+
+	channels := r.Metadata.Channels
+	if len(channels) != 5 {
+		t.Fatalf("wrong channels %#v", channels)
+	}
+	for i, exp := range []input.Channel{
+		{Name: "CH1", SampleRate: 20000, Gain: 0.195, Offset: 32768, Units: "uV"},
+		{Name: "CH2", SampleRate: 20000, Gain: 0.195, Offset: 32768, Units: "uV"},
+		{Name: "AUX1", SampleRate: 5000, Gain: 37.4e-6, Units: "V"},
+		{Name: "VDD1", SampleRate: 20000.0 / 60, Gain: 74.8e-6, Units: "V"},
+		{Name: "ADC-00", SampleRate: 20000, Gain: 50.354e-6, Units: "V"},
+	} {
+		if channels[i] != exp {
+			t.Errorf("channel %d: exp(%#v) != got(%#v)", i, exp, channels[i])
+		}
+	}
+
+	for i := range 3 {
+		block, err := r.ReadBlock()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if block.Timestamps[0] != int32(i*60) || len(block.Amplifier) != 2 || len(block.AuxInput[0]) != 15 || block.SupplyVoltage[0][0] != 44000 || block.BoardADC[0][4] != 1 {
+			t.Errorf("block %d: wrong %#v", i, block)
+		}
+	}
+	if _, err := r.ReadBlock(); err != io.EOF {
+		t.Error(err)
+	}
+}
+
+func TestIntanReader_HugeString(t *testing.T) {
+	b, _ := os.ReadFile(filepath.Join("testdata", "recording.rhd"))
+
+	// first note after magic, version, sample rate and settings
+	b = binary.LittleEndian.AppendUint32(b[:48:48], 0xFFFFFFFE)
+	b = append(b, 'a', 0, 'b')
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	err := input.NewIntanReader(bytes.NewReader(b)).ReadHeader()
+	runtime.ReadMemStats(&after)
+
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("expected unexpected EOF, got %v", err)
+	}
+	if n := after.TotalAlloc - before.TotalAlloc; n > 1<<20 {
+		t.Errorf("allocated %d bytes for string of 3 bytes", n)
+	}
+}
+
+func TestIntanReader_ReadSamples(t *testing.T) {
+	b, _ := os.ReadFile(filepath.Join("testdata", "recording.rhd"))
+
+	r := input.NewIntanReader(bytes.NewReader(b))
+	if err := r.ReadHeader(); err != nil {
+		t.Fatal(err)
+	}
+
+	samples := readAll(t, r)
+	if exp := 3 * r.Header.BlockSize() / 2; len(samples) != exp {
+		t.Errorf("exp(%d) != got(%d) words", exp, len(samples))
+	}
+	if got := len(r.Metadata.Header) + 2*len(samples); got != len(b) {
+		t.Errorf("exp(%d) != got(%d) bytes", len(b), got)
+	}
+}
@@ -0,0 +1,358 @@
+package input
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"unicode/utf16"
+)
+
+// IntanMagic starts Intan RHD2000 file.
+// https://intantech.com/files/Intan_RHD2000_data_file_formats.pdf
+const IntanMagic uint32 = 0xC6912702
+
+type IntanSignalType int16
+
+const (
+	IntanAmplifier IntanSignalType = iota
+	IntanAuxInput
+	IntanSupplyVoltage
+	IntanBoardADC
+	IntanBoardDigitalIn
+	IntanBoardDigitalOut
+)
+
+type IntanChannel struct {
+	NativeName  string
+	CustomName  string
+	NativeOrder int16
+	CustomOrder int16
+	SignalType  IntanSignalType
+	Enabled     bool
+	ChipChannel int16
+	BoardStream int16
+}
+
+type IntanHeader struct {
+	VersionMajor          int16
+	VersionMinor          int16
+	SampleRate            float32
+	NumTemperatureSensors int16
+	EvalBoardMode         int16
+	Notes                 [3]string
+	ReferenceChannel      string
+	Channels              []IntanChannel // enabled channels of enabled signal groups
+}
+
+// NumSamplesPerBlock is number of amplifier samples in data block.
+func (s IntanHeader) NumSamplesPerBlock() int {
+	if s.VersionMajor >= 3 {
+		return 128
+	}
+	return 60
+}
+
+func (s IntanHeader) NumChannels(t IntanSignalType) int {
+	n := 0
+	for _, q := range s.Channels {
+		if q.SignalType == t {
+			n++
+		}
+	}
+	return n
+}
+
+// BlockSize is size of data block in bytes.
+func (s IntanHeader) BlockSize() int {
+	n := s.NumSamplesPerBlock()
+	words := 2 * n // timestamps
+	words += n * s.NumChannels(IntanAmplifier)
+	words += (n / 4) * s.NumChannels(IntanAuxInput)
+	words += s.NumChannels(IntanSupplyVoltage)
+	words += int(s.NumTemperatureSensors)
+	words += n * s.NumChannels(IntanBoardADC)
+	if s.NumChannels(IntanBoardDigitalIn) > 0 {
+		words += n
+	}
+	if s.NumChannels(IntanBoardDigitalOut) > 0 {
+		words += n
+	}
+	return 2 * words
+}
+
+// InputChannels is metadata of channels with sample rates and gains of RHD2000 system.
+func (s IntanHeader) InputChannels() []Channel {
+	var channels []Channel
+
+	rate := float64(s.SampleRate)
+	blockRate := rate / float64(s.NumSamplesPerBlock())
+
+	adc := Channel{SampleRate: rate, Gain: 50.354e-6, Units: "V"}
+	switch s.EvalBoardMode {
+	case 1:
+		adc.Gain, adc.Offset = 152.59e-6, 32768
+	case 13:
+		adc.Gain, adc.Offset = 312.5e-6, 32768
+	}
+
+	for _, t := range []IntanSignalType{IntanAmplifier, IntanAuxInput, IntanSupplyVoltage} {
+		for _, q := range s.Channels {
+			if q.SignalType != t {
+				continue
+			}
+			switch t {
+			case IntanAmplifier:
+				channels = append(channels, Channel{Name: q.CustomName, SampleRate: rate, Gain: 0.195, Offset: 32768, Units: "uV"})
+			case IntanAuxInput:
+				channels = append(channels, Channel{Name: q.CustomName, SampleRate: rate / 4, Gain: 37.4e-6, Units: "V"})
+			case IntanSupplyVoltage:
+				channels = append(channels, Channel{Name: q.CustomName, SampleRate: blockRate, Gain: 74.8e-6, Units: "V"})
+			}
+		}
+	}
+
+	for i := range int(s.NumTemperatureSensors) {
+		channels = append(channels, Channel{Name: fmt.Sprintf("TEMP%d", i+1), SampleRate: blockRate, Gain: 0.01, Units: "C"})
+	}
+
+	for _, t := range []IntanSignalType{IntanBoardADC, IntanBoardDigitalIn, IntanBoardDigitalOut} {
+		for _, q := range s.Channels {
+			if q.SignalType != t {
+				continue
+			}
+			if t == IntanBoardADC {
+				c := adc
+				c.Name = q.CustomName
+				channels = append(channels, c)
+			} else {
+				channels = append(channels, Channel{Name: q.CustomName, SampleRate: rate, Gain: 1})
+			}
+		}
+	}
+
+	return channels
+}
+
+type intanReader struct {
+	r   io.Reader
+	err error
+}
+
+func (s *intanReader) read(v any) {
+	if s.err == nil {
+		s.err = binary.Read(s.r, binary.LittleEndian, v)
+	}
+}
+
+func (s *intanReader) readString() string {
+	var n uint32
+	if s.read(&n); s.err != nil || n == 0xFFFFFFFF {
+		return ""
+	}
+	if n%2 != 0 {
+		s.err = fmt.Errorf("invalid length of string(%d)", n)
+		return ""
+	}
+
+	// length is not trusted, so buffer grows only as string is read
+	var b bytes.Buffer
+	if _, err := io.CopyN(&b, s.r, int64(n)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		s.err = err
+		return ""
+	}
+	q := make([]uint16, n/2)
+	for i := range q {
+		q[i] = binary.LittleEndian.Uint16(b.Bytes()[2*i:])
+	}
+	return string(utf16.Decode(q))
+}
+
+func (s *IntanHeader) UnmarshalBinary(r io.Reader) error {
+	q := intanReader{r: r}
+
+	var magic uint32
+	if q.read(&magic); q.err == nil && magic != IntanMagic {
+		return errors.New("invalid magic, not Intan RHD2000")
+	}
+
+	q.read(&s.VersionMajor)
+	q.read(&s.VersionMinor)
+	q.read(&s.SampleRate)
+
+	// DSP, bandwidth, notch and impedance test settings
+	var settings struct {
+		DSPEnabled                    int16
+		ActualDSPCutoff               float32
+		ActualLowerBandwidth          float32
+		ActualUpperBandwidth          float32
+		DesiredDSPCutoff              float32
+		DesiredLowerBandwidth         float32
+		DesiredUpperBandwidth         float32
+		NotchFilterMode               int16
+		DesiredImpedanceTestFrequency float32
+		ActualImpedanceTestFrequency  float32
+	}
+	q.read(&settings)
+
+	for i := range s.Notes {
+		s.Notes[i] = q.readString()
+	}
+
+	if s.VersionMajor > 1 || (s.VersionMajor == 1 && s.VersionMinor >= 1) {
+		q.read(&s.NumTemperatureSensors)
+	}
+	if s.VersionMajor > 1 || (s.VersionMajor == 1 && s.VersionMinor >= 3) {
+		q.read(&s.EvalBoardMode)
+	}
+	if s.VersionMajor > 1 {
+		s.ReferenceChannel = q.readString()
+	}
+
+	var numGroups int16
+	q.read(&numGroups)
+
+	s.Channels = nil
+	for range numGroups {
+		q.readString() // name
+		q.readString() // prefix
+
+		var group struct {
+			Enabled              int16
+			NumChannels          int16
+			NumAmplifierChannels int16
+		}
+		q.read(&group)
+
+		for range group.NumChannels {
+			var c IntanChannel
+			c.NativeName = q.readString()
+			c.CustomName = q.readString()
+
+			var v struct {
+				NativeOrder                  int16
+				CustomOrder                  int16
+				SignalType                   IntanSignalType
+				Enabled                      int16
+				ChipChannel                  int16
+				BoardStream                  int16
+				SpikeScopeVoltageTriggerMode int16
+				SpikeScopeVoltageThreshold   int16
+				SpikeScopeDigitalTrigger     int16
+				SpikeScopeDigitalEdge        int16
+				ImpedanceMagnitude           float32
+				ImpedancePhase               float32
+			}
+			q.read(&v)
+
+			c.NativeOrder, c.CustomOrder, c.SignalType = v.NativeOrder, v.CustomOrder, v.SignalType
+			c.Enabled, c.ChipChannel, c.BoardStream = v.Enabled != 0, v.ChipChannel, v.BoardStream
+
+			if group.Enabled != 0 && c.Enabled {
+				s.Channels = append(s.Channels, c)
+			}
+		}
+	}
+
+	return q.err
+}
+
+// IntanBlock is data block, channels are in order of header.
+type IntanBlock struct {
+	Timestamps    []int32
+	Amplifier     [][]uint16
+	AuxInput      [][]uint16
+	SupplyVoltage [][]uint16
+	Temperature   []int16
+	BoardADC      [][]uint16
+	DigitalIn     []uint16
+	DigitalOut    []uint16
+}
+
+// IntanReader reads data blocks of RHD2000 file.
+type IntanReader struct {
+	Header   IntanHeader
+	Metadata Metadata
+	r        io.Reader
+	buf      []byte
+	trailer  []byte
+}
+
+func NewIntanReader(r io.Reader) *IntanReader { return &IntanReader{r: r} }
+
+func (s *IntanReader) ReadHeader() error {
+	var b bytes.Buffer
+	if err := s.Header.UnmarshalBinary(io.TeeReader(s.r, &b)); err != nil {
+		return err
+	}
+	s.Metadata = Metadata{Header: b.Bytes(), Channels: s.Header.InputChannels()}
+	return nil
+}
+
+func (s *IntanReader) ReadBlock() (IntanBlock, error) {
+	b := make([]byte, s.Header.BlockSize())
+	if _, err := io.ReadFull(s.r, b); err != nil {
+		return IntanBlock{}, err
+	}
+	q := intanReader{r: bytes.NewReader(b)}
+
+	n := s.Header.NumSamplesPerBlock()
+	readChannels := func(t IntanSignalType, n int) [][]uint16 {
+		vs := make([][]uint16, s.Header.NumChannels(t))
+		for i := range vs {
+			vs[i] = make([]uint16, n)
+			q.read(vs[i])
+		}
+		return vs
+	}
+
+	var block IntanBlock
+	block.Timestamps = make([]int32, n)
+	q.read(block.Timestamps)
+	block.Amplifier = readChannels(IntanAmplifier, n)
+	block.AuxInput = readChannels(IntanAuxInput, n/4)
+	block.SupplyVoltage = readChannels(IntanSupplyVoltage, 1)
+	block.Temperature = make([]int16, s.Header.NumTemperatureSensors)
+	q.read(block.Temperature)
+	block.BoardADC = readChannels(IntanBoardADC, n)
+	if s.Header.NumChannels(IntanBoardDigitalIn) > 0 {
+		block.DigitalIn = make([]uint16, n)
+		q.read(block.DigitalIn)
+	}
+	if s.Header.NumChannels(IntanBoardDigitalOut) > 0 {
+		block.DigitalOut = make([]uint16, n)
+		q.read(block.DigitalOut)
+	}
+	return block, q.err
+}
+
+// Trailer is partial word at end of file.
+// It is valid only after all samples have been read.
+func (s *IntanReader) Trailer() io.Reader { return bytes.NewReader(s.trailer) }
+
+// ReadSamples reads data blocks as 16 bit words in order of file, timestamp is low word then high word.
+func (s *IntanReader) ReadSamples(p []uint16) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	if cap(s.buf) < 2*len(p) {
+		s.buf = make([]byte, 2*len(p))
+	}
+	b := s.buf[:2*len(p)]
+
+	k, err := io.ReadFull(s.r, b)
+	if err == io.ErrUnexpectedEOF {
+		s.trailer = append(s.trailer, b[k-k%2:k]...)
+		err = nil
+	}
+
+	for i := range k / 2 {
+		p[i] = binary.LittleEndian.Uint16(b[2*i:])
+	}
+	return k / 2, err
+}
@@ -0,0 +1,193 @@
+package input
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/pcm"
+)
+
+// OpenEphysStructureFileName is JSON description of Open Ephys binary recording.
+// https://open-ephys.github.io/gui-docs/User-Manual/Recording-data/Binary-format.html
+const OpenEphysStructureFileName = "structure.oebin"
+
+type OpenEphysStructure struct {
+	GUIVersion string                `json:"GUI version"`
+	Continuous []OpenEphysContinuous `json:"continuous"`
+}
+
+type OpenEphysContinuous struct {
+	FolderName  string             `json:"folder_name"`
+	SampleRate  float64            `json:"sample_rate"`
+	NumChannels int                `json:"num_channels"`
+	Channels    []OpenEphysChannel `json:"channels"`
+}
+
+type OpenEphysChannel struct {
+	ChannelName string  `json:"channel_name"`
+	BitVolts    float64 `json:"bit_volts"`
+	Units       string  `json:"units"`
+}
+
+// DataFileName is file of interleaved int16 little endian samples of all channels.
+func (s OpenEphysContinuous) DataFileName() string {
+	return filepath.Join("continuous", s.FolderName, "continuous.dat")
+}
+
+// OpenEphysReader reads samples of continuous streams one after another.
+type OpenEphysReader struct {
+	Structure OpenEphysStructure
+	Metadata  Metadata
+	dir       string
+	file      *os.File
+	r         *pcm.Reader
+	next      int
+}
+
+func NewOpenEphysReader(dir string) (*OpenEphysReader, error) {
+	b, err := os.ReadFile(filepath.Join(dir, OpenEphysStructureFileName))
+	if err != nil {
+		return nil, err
+	}
+
+	s := OpenEphysReader{dir: dir, Metadata: Metadata{Header: b}}
+	if err := json.Unmarshal(b, &s.Structure); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", OpenEphysStructureFileName, err)
+	}
+
+	for _, q := range s.Structure.Continuous {
+		if len(q.Channels) != q.NumChannels {
+			return nil, fmt.Errorf("stream %s: number of channels(%d) does not match channels(%d)", q.FolderName, q.NumChannels, len(q.Channels))
+		}
+
+		info, err := os.Stat(filepath.Join(dir, q.DataFileName()))
+		if err != nil {
+			return nil, err
+		}
+		if info.Size()%2 != 0 {
+			return nil, fmt.Errorf("stream %s: partial sample at end of data file", q.FolderName)
+		}
+		s.Metadata.Files = append(s.Metadata.Files, File{Name: q.DataFileName(), Size: info.Size()})
+
+		for _, c := range q.Channels {
+			s.Metadata.Channels = append(s.Metadata.Channels, Channel{
+				Name:       c.ChannelName,
+				SampleRate: q.SampleRate,
+				Gain:       c.BitVolts,
+				Units:      c.Units,
+			})
+		}
+	}
+
+	return &s, nil
+}
+
+func (s *OpenEphysReader) Trailer() io.Reader { return emptyTrailer() }
+
+func (s *OpenEphysReader) ReadSamples(p []uint16) (int, error) {
+	for {
+		if s.r == nil {
+			if s.next >= len(s.Metadata.Files) {
+				return 0, io.EOF
+			}
+
+			f, err := os.Open(filepath.Join(s.dir, s.Metadata.Files[s.next].Name))
+			if err != nil {
+				return 0, err
+			}
+			s.file, s.next = f, s.next+1
+			s.r = pcm.NewReader(pcm.Format{NumChannels: 1, BitsPerSample: 16}, f)
+		}
+
+		n, err := s.r.ReadSamples(p)
+		if err == io.EOF {
+			err = s.Close()
+			s.r = nil
+		}
+		if n > 0 || err != nil {
+			return n, err
+		}
+	}
+}
+
+func (s *OpenEphysReader) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+// OpenEphysWriter writes samples into files of continuous streams one after another.
+type OpenEphysWriter struct {
+	Metadata Metadata
+	create   func(name string) (io.Writer, error)
+	w        *pcm.Writer
+	next     int
+	left     int64 // samples left in current file
+}
+
+// NewOpenEphysWriter writes structure file and prepares to write samples into files made by create.
+// Names of files are checked against structure, as metadata comes from encoded stream.
+func NewOpenEphysWriter(metadata Metadata, create func(name string) (io.Writer, error)) (*OpenEphysWriter, error) {
+	var structure OpenEphysStructure
+	if err := json.Unmarshal(metadata.Header, &structure); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", OpenEphysStructureFileName, err)
+	}
+	if len(metadata.Files) != len(structure.Continuous) {
+		return nil, fmt.Errorf("number of files(%d) does not match continuous streams(%d)", len(metadata.Files), len(structure.Continuous))
+	}
+	for i, f := range metadata.Files {
+		if name := structure.Continuous[i].DataFileName(); !filepath.IsLocal(f.Name) || f.Name != name {
+			return nil, fmt.Errorf("file(%s) is not data file(%s) of stream", f.Name, name)
+		}
+	}
+
+	w, err := create(OpenEphysStructureFileName)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(metadata.Header); err != nil {
+		return nil, err
+	}
+	return &OpenEphysWriter{Metadata: metadata, create: create}, nil
+}
+
+func (s *OpenEphysWriter) WriteSamples(p []uint16) error {
+	for len(p) > 0 {
+		for s.left == 0 {
+			if s.next >= len(s.Metadata.Files) {
+				return errors.New("more samples than in files of recording")
+			}
+
+			f := s.Metadata.Files[s.next]
+			w, err := s.create(f.Name)
+			if err != nil {
+				return err
+			}
+			s.w, s.next, s.left = pcm.NewWriter(pcm.Format{NumChannels: 1, BitsPerSample: 16}, w), s.next+1, f.Size/2
+		}
+
+		n := int(min(int64(len(p)), s.left))
+		if err := s.w.WriteSamples(p[:n]); err != nil {
+			return err
+		}
+		p, s.left = p[n:], s.left-int64(n)
+	}
+	return nil
+}
+
+// Close creates remaining files, which have no samples.
+func (s *OpenEphysWriter) Close() error {
+	for ; s.next < len(s.Metadata.Files); s.next++ {
+		if _, err := s.create(s.Metadata.Files[s.next].Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
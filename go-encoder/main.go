@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/binary"
 	"errors"
 	"flag"
@@ -10,9 +11,17 @@ import (
 	"log"
 	"log/slog"
 	"os"
+	"slices"
+	"time"
 
 	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/bits"
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/cache"
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/container"
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/dump"
 	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/encoding"
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/pcm"
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/spike"
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/substream"
 	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/wav"
 )
 
@@ -28,6 +37,9 @@ type CacheSampleEncoderStats struct {
 	NumForcedUnpacked               int
 	NumBytesForcedUnpacked          int
 	NumSamplesEncodedByEncodingSize map[int]int
+	NumBlocksByType                 map[encoding.BlockType]int
+	NumChangedSamples               int // by max error
+	NumFlushesByMaxError            int // of buffer with samples, when max error is changed
 }
 
 func (s *CacheSampleEncoderStats) AddEncodedAdvanced(advanced int) {
@@ -48,22 +60,51 @@ type CacheSampleEncoderConfig struct {
 	EncodedSeqMaxLen    int
 	NotEncodedSeqMaxLen int
 	ByteOrder           binary.ByteOrder
+	KeyframeInterval    int  // samples between cache resets, zero for none
+	Workers             int  // blocks between keyframes encoded and decoded concurrently
+	Adaptive            bool // each block is coded by cache or delta, whichever is smaller
+	MaxError            int  // of samples, near-lossless if above zero
+}
+
+// countingWriter counts bytes written, to know offsets of keyframes.
+type countingWriter struct {
+	w interface {
+		io.ByteWriter
+		io.Writer
+	}
+	n int64
+}
+
+func (s *countingWriter) Write(p []byte) (int, error) {
+	n, err := s.w.Write(p)
+	s.n += int64(n)
+	return n, err
+}
+
+func (s *countingWriter) WriteByte(c byte) error {
+	if err := s.w.WriteByte(c); err != nil {
+		return err
+	}
+	s.n++
+	return nil
 }
 
 type CacheSampleEncoder struct {
 	config CacheSampleEncoderConfig
 	stats  CacheSampleEncoderStats
-	cache  *Cache
+	cache  *cache.Cache
 	buffer []uint16
-	w      interface {
-		io.ByteWriter
-		io.Writer
-	}
+	index  container.Index
+	w      *countingWriter
+	prev   uint16 // last sample of previous block, for delta
+
+	maxError int      // of samples, 0 for lossless
+	original []uint16 // of buffer, before samples are changed within max error
 }
 
 func NewCacheSampleEncoder(
 	config CacheSampleEncoderConfig,
-	cache *Cache,
+	cache *cache.Cache,
 	w interface {
 		io.ByteWriter
 		io.Writer
@@ -73,13 +114,34 @@ func NewCacheSampleEncoder(
 		config: config,
 		stats: CacheSampleEncoderStats{
 			NumSamplesEncodedByEncodingSize: make(map[int]int),
+			NumBlocksByType:                 make(map[encoding.BlockType]int),
 		},
-		cache:  cache,
-		w:      w,
-		buffer: make([]uint16, 0, config.EncodedSeqMaxLen),
+		cache:    cache,
+		w:        &countingWriter{w: w},
+		buffer:   make([]uint16, 0, config.EncodedSeqMaxLen),
+		maxError: config.MaxError,
 	}
 }
 
+// SetMaxError of samples that are written next, 0 for lossless.
+// Samples written before it are flushed.
+func (s *CacheSampleEncoder) SetMaxError(maxError int) error {
+	if len(s.buffer) > 0 {
+		s.stats.NumFlushesByMaxError++
+	}
+	if err := s.FlushBuffer(); err != nil {
+		return err
+	}
+	s.maxError = maxError
+	return nil
+}
+
+// Size of output written so far.
+func (s *CacheSampleEncoder) Size() int64 { return s.w.n }
+
+// Index of keyframes written so far.
+func (s *CacheSampleEncoder) Index() container.Index { return s.index }
+
 func (s *CacheSampleEncoder) Stats() CacheSampleEncoderStats {
 	if s.stats.NumTotalSamples > 0 {
 		s.stats.RatioEncodedSamples = float32(s.stats.NumEncodedSamples) / float32(s.stats.NumTotalSamples)
@@ -88,12 +150,32 @@ func (s *CacheSampleEncoder) Stats() CacheSampleEncoderStats {
 }
 
 func (s *CacheSampleEncoder) Write(v uint16) error {
+	if s.config.KeyframeInterval > 0 && s.stats.NumTotalSamples%s.config.KeyframeInterval == 0 {
+		if err := s.FlushBuffer(); err != nil {
+			return err
+		}
+		s.cache.Reset()
+		s.prev = 0
+		s.index = append(s.index, container.IndexEntry{Sample: uint64(s.stats.NumTotalSamples), Offset: uint64(s.w.n)})
+	}
+
 	s.stats.NumTotalSamples++
 	if len(s.buffer) >= s.config.EncodedSeqMaxLen {
 		if err := s.FlushBuffer(); err != nil {
 			return err
 		}
 	}
+
+	// sample is replaced by most frequent key of cache within max error, so that it is hit of smaller index
+	if s.maxError > 0 {
+		if s.config.Adaptive {
+			s.original = append(s.original, v)
+		}
+		if i := s.cache.Find(v, s.maxError); i >= 0 && s.cache.At(i) != v {
+			v = s.cache.At(i)
+			s.stats.NumChangedSamples++
+		}
+	}
 	s.buffer = append(s.buffer, v)
 	return nil
 }
@@ -112,7 +194,60 @@ func (s *CacheSampleEncoder) FlushBuffer() error {
 	if len(s.buffer) == 0 {
 		return nil
 	}
+	if !s.config.Adaptive {
+		return s.flushBufferCache()
+	}
+
+	// cache is updated by every sample in order whichever coder wins,
+	// so coding with cache into side buffer keeps it same as in decoder.
+	// Near-lossless delta codes other samples than cache, then cache is updated by them instead.
+	var snapshot *cache.Cache
+	if s.maxError > 0 {
+		snapshot = s.cache.Clone()
+	}
+	w := s.w
+	var cached bytes.Buffer
+	s.w = &countingWriter{w: &cached}
+	buffer := slices.Clone(s.buffer)
+	err := s.flushBufferCache()
+	s.w = w
+	if err != nil {
+		return err
+	}
+
+	block := encoding.BlockMarker{Type: encoding.BlockCache, Count: len(buffer)}
+	payload := cached.Bytes()
+	if delta := encoding.AppendDelta(nil, s.prev, buffer); len(delta) < len(payload) {
+		block.Type, payload = encoding.BlockDelta, delta
+	}
+
+	// quantized out of bound of int16 is not within max error, block is coded by others then
+	if s.maxError > 0 {
+		quantized, ok := encoding.QuantizeDelta(s.prev, s.original, s.maxError)
+		s.original = s.original[:0]
+		if delta := encoding.AppendDelta(nil, s.prev, quantized); ok && len(delta) < len(payload) {
+			block.Type, payload = encoding.BlockDelta, delta
+			s.cache = snapshot
+			for _, v := range quantized {
+				s.cache.Add(v)
+			}
+			buffer = quantized
+		}
+	}
+	s.stats.NumBlocksByType[block.Type]++
+	s.stats.NumBytesAdditional += block.SizeBytes()
+
+	if err := block.MarshalBinaryToWriter(s.w, s.config.ByteOrder); err != nil {
+		return err
+	}
+	if _, err := s.w.Write(payload); err != nil {
+		return err
+	}
+	s.prev = buffer[len(buffer)-1]
+	return nil
+}
 
+func (s *CacheSampleEncoder) flushBufferCache() error {
 	for offset := 0; offset < len(s.buffer); {
 		packer, countHits := s.flushBufferHitsCount(offset)
 		countNotHits := s.flushBufferNotHitsCount(offset + countHits)
@@ -244,15 +379,22 @@ func (s *CacheSampleEncoder) flushBufferNotHits(offset int, count int) error {
 }
 
 type CacheSampleDecoder struct {
-	config CacheSampleEncoderConfig
-	cache  *Cache
-	r      io.Reader
-	buffer []uint16 // reverse order
+	config     CacheSampleEncoderConfig
+	cache      *cache.Cache
+	r          io.Reader
+	buffer     []uint16 // reverse order
+	numSamples int      // read from markers
+	prev       uint16   // last sample of previous block, for delta
+
+	// for seeking
+	seeker io.ReadSeeker
+	offset int64 // of markers
+	index  container.Index
 }
 
 func NewCacheSampleDecoder(
 	config CacheSampleEncoderConfig,
-	cache *Cache,
+	cache *cache.Cache,
 	r io.Reader,
 ) *CacheSampleDecoder {
 	return &CacheSampleDecoder{
@@ -263,6 +405,39 @@ func NewCacheSampleDecoder(
 	}
 }
 
+// SetIndex enables seeking within r, which has markers starting at offset.
+func (s *CacheSampleDecoder) SetIndex(r io.ReadSeeker, offset int64, index container.Index) {
+	s.seeker, s.offset, s.index = r, offset, index
+}
+
+// SeekSample makes n-th sample next, decoding only from keyframe before it.
+func (s *CacheSampleDecoder) SeekSample(n int) error {
+	if s.seeker == nil {
+		return errors.New("seek requires index")
+	}
+
+	keyframe, err := s.index.Find(uint64(n))
+	if err != nil {
+		return err
+	}
+	if _, err := s.seeker.Seek(s.offset+int64(keyframe.Offset), io.SeekStart); err != nil {
+		return err
+	}
+
+	s.r = bufio.NewReader(s.seeker)
+	s.cache.Reset()
+	s.buffer = s.buffer[:0]
+	s.numSamples = int(keyframe.Sample)
+	s.prev = 0
+
+	for i := int(keyframe.Sample); i < n; i++ {
+		if _, err := s.Next(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (s *CacheSampleDecoder) Next() (sample uint16, err error) {
 	if len(s.buffer) == 0 {
 		if err := s.readIntoBuffer(); err != nil {
@@ -275,11 +450,62 @@ func (s *CacheSampleDecoder) Next() (sample uint16, err error) {
 	return sample, nil
 }
 
+func (s *CacheSampleDecoder) Buffered() int { return len(s.buffer) }
+
 func (s *CacheSampleDecoder) readIntoBuffer() error {
+	if s.config.KeyframeInterval > 0 && s.numSamples%s.config.KeyframeInterval == 0 {
+		s.cache.Reset()
+		s.prev = 0
+	}
+	if s.config.Adaptive {
+		return s.readBlock()
+	}
+	return s.readMarker()
+}
+
+func (s *CacheSampleDecoder) readBlock() error {
+	var block encoding.BlockMarker
+	if err := block.UnmarshalBinaryFromReader(s.r, s.config.ByteOrder); err != nil {
+		return err
+	}
+
+	switch block.Type {
+	case encoding.BlockCache:
+		end := s.numSamples + block.Count
+		for s.numSamples < end {
+			if err := s.readMarker(); err != nil {
+				if err == io.EOF {
+					return io.ErrUnexpectedEOF
+				}
+				return err
+			}
+		}
+		if s.numSamples != end {
+			return fmt.Errorf("markers of %d samples do not fill block", block.Count)
+		}
+	case encoding.BlockDelta:
+		samples := make([]uint16, block.Count)
+		if err := encoding.ReadDelta(s.r, s.prev, samples); err != nil {
+			return err
+		}
+		for _, v := range samples {
+			s.cache.Add(v)
+		}
+		slices.Reverse(samples)
+		s.buffer = append(samples, s.buffer...)
+		s.numSamples += block.Count
+	}
+
+	s.prev = s.buffer[0]
+	return nil
+}
+
+func (s *CacheSampleDecoder) readMarker() error {
 	var marker encoding.Marker
 	if err := marker.UnmarshalBinaryFromReader(s.r, s.config.ByteOrder); err != nil {
 		return err
 	}
+	s.numSamples += marker.Count
 
 	if marker.IsEncoded {
 		return s.readEncoded(marker.Count, bits.Packers[marker.EncodingSize])
@@ -331,6 +557,425 @@ func ValidateWAVHeader(header wav.WAVHeader) error {
 	return nil
 }
 
+// writeTrailer copies bytes after samples of input after zero marker, which ends encoded samples.
+func writeTrailer(trailer io.Reader, byteOrder binary.ByteOrder, w io.Writer) error {
+	b, err := io.ReadAll(trailer)
+	if err != nil || len(b) == 0 {
+		return err
+	}
+	if err := (&encoding.Marker{}).MarshalBinaryToWriter(w, byteOrder); err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// streamSections are sections of encoded stream, stream of cache codec has no codec ID for compatibility.
+func streamSections(encoderConfig CacheSampleEncoderConfig, codec Codec) []container.Section {
+	var sections []container.Section
+	if codec.ID() != CodecIDCache {
+		sections = append(sections, container.CodecSection(codec.ID()))
+	}
+	if encoderConfig.KeyframeInterval > 0 {
+		sections = append(sections, container.KeyframesSection(encoderConfig.KeyframeInterval))
+	}
+	if encoderConfig.MaxError > 0 {
+		sections = append(sections, container.MaxErrorSection(encoderConfig.MaxError))
+	}
+	return sections
+}
+
+// streamCodec is codec of encoded stream by its ID.
+func streamCodec(header container.Header) (Codec, error) {
+	id, ok, err := header.Codec()
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		id = CodecIDCache
+	}
+	codec, ok := CodecByID(id)
+	if !ok {
+		return nil, fmt.Errorf("unknown codec ID(%d)", id)
+	}
+	return codec, nil
+}
+
+// supportsKeyframes checks that encoder of codec resets state at keyframes and makes index of them.
+func supportsKeyframes(codec Codec, encoderConfig CacheSampleEncoderConfig, cacheConfig cache.Config) bool {
+	_, ok := codec.NewEncoder(encoderConfig, cacheConfig, io.Discard).(interface{ Index() container.Index })
+	return ok
+}
+
+func encode(codec Codec, encoderConfig CacheSampleEncoderConfig, cacheConfig cache.Config, inputConfig InputConfig, r io.Reader, w *bufio.Writer) error {
+	if encoderConfig.KeyframeInterval > 0 && !supportsKeyframes(codec, encoderConfig, cacheConfig) {
+		return fmt.Errorf("codec %s does not support keyframes", codec.Name())
+	}
+
+	sampleReader, err := NewSampleReader(inputConfig, r, w, streamSections(encoderConfig, codec)...)
+	if err != nil {
+		return err
+	}
+
+	encoder := codec.NewEncoder(encoderConfig, cacheConfig, w)
+	if err := encodeSamples(sampleReader, encoder, encoderConfig.EncodedSeqMaxLen); err != nil {
+		return err
+	}
+	return finishEncode(encoderConfig, encoder, sampleReader.Trailer(), w)
+}
+
+// encodeSamples writes all samples of input to encoder.
+func encodeSamples(sampleReader SampleReader, encoder SampleEncoder, bufLen int) error {
+	samples := make([]uint16, bufLen)
+	for {
+		n, err := sampleReader.ReadSamples(samples)
+		for _, sample := range samples[:n] {
+			if err := encoder.Write(sample); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// encodeSplit encodes with cache codec, and then splits markers into streams, each compressed by backend, in sections of container.
+// Backend "best" is backend that makes smallest output for each stream.
+func encodeSplit(backendName string, encoderConfig CacheSampleEncoderConfig, cacheConfig cache.Config, inputConfig InputConfig, r io.Reader, w *bufio.Writer) error {
+	if encoderConfig.KeyframeInterval > 0 {
+		return errors.New("splitting into streams does not support keyframes")
+	}
+
+	best := backendName == "best"
+	var backend substream.Backend
+	if !best {
+		var err error
+		if backend, err = substream.ParseBackend(backendName); err != nil {
+			return err
+		}
+	}
+
+	sampleReader, header, err := newSampleReader(inputConfig, r)
+	if err != nil {
+		return err
+	}
+
+	var markers bytes.Buffer
+	encoder := CacheCodec{}.NewEncoder(encoderConfig, cacheConfig, &markers)
+	if err := encodeSamples(sampleReader, encoder, encoderConfig.EncodedSeqMaxLen); err != nil {
+		return err
+	}
+	if err := encoder.FlushBuffer(); err != nil {
+		return err
+	}
+
+	streams, err := substream.Split(&markers, encoderConfig.ByteOrder)
+	if err != nil {
+		return err
+	}
+	sections, err := substream.Sections(streams, backend, best)
+	if err != nil {
+		return err
+	}
+	for _, q := range sections {
+		slog.Info("substream", "stream", substream.Stream(q.Data[0]), "backend", substream.Backend(q.Data[1]), "size", len(streams[q.Data[0]]), "compressed", len(q.Data)-2)
+	}
+
+	if err := writeStreamHeader(header, w, append(streamSections(encoderConfig, CacheCodec{}), sections...)...); err != nil {
+		return err
+	}
+	return writeTrailer(sampleReader.Trailer(), encoderConfig.ByteOrder, w)
+}
+
+// finishEncode flushes samples and writes what is after them.
+func finishEncode(encoderConfig CacheSampleEncoderConfig, encoder SampleEncoder, trailer io.Reader, w io.Writer) error {
+	if err := encoder.FlushBuffer(); err != nil {
+		return err
+	}
+	if encoder, ok := encoder.(interface {
+		Stats() CacheSampleEncoderStats
+	}); ok {
+		slog.Info("done", "stats", encoder.Stats())
+	}
+
+	if encoderConfig.KeyframeInterval == 0 {
+		return writeTrailer(trailer, encoderConfig.ByteOrder, w)
+	}
+
+	// index is last, so zero marker is always there
+	if err := (&encoding.Marker{}).MarshalBinaryToWriter(w, encoderConfig.ByteOrder); err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, trailer); err != nil {
+		return err
+	}
+	return encoder.(interface{ Index() container.Index }).Index().MarshalBinary(w)
+}
+
+// encodeAuto encodes with codec that makes smallest output of first samples of input, or of all of them if prefix is zero.
+// Only first samples are in memory, rest of input is encoded as it is read.
+func encodeAuto(encoderConfig CacheSampleEncoderConfig, cacheConfig cache.Config, inputConfig InputConfig, prefix int, r io.Reader, w *bufio.Writer) error {
+	sampleReader, header, err := newSampleReader(inputConfig, r)
+	if err != nil {
+		return err
+	}
+
+	var trial []uint16
+	rest := false // samples after trial are left in input
+	if prefix > 0 {
+		trial = make([]uint16, prefix)
+		n, err := readFull(sampleReader, trial)
+		if err != nil && err != io.EOF {
+			return err
+		}
+		trial, rest = trial[:n], err == nil
+	} else if trial, err = readAllSamples(sampleReader); err != nil {
+		return err
+	}
+
+	var best Codec
+	bestSize := 0
+	for _, codec := range Codecs {
+		if encoderConfig.KeyframeInterval > 0 && !supportsKeyframes(codec, encoderConfig, cacheConfig) {
+			continue
+		}
+
+		var b bytes.Buffer
+		encoder := codec.NewEncoder(encoderConfig, cacheConfig, &b)
+		for _, sample := range trial {
+			if err := encoder.Write(sample); err != nil {
+				return err
+			}
+		}
+		if err := encoder.FlushBuffer(); err != nil {
+			return err
+		}
+
+		slog.Info("auto", "codec", codec.Name(), "samples", len(trial), "bytes", b.Len())
+		if best == nil || b.Len() < bestSize {
+			best, bestSize = codec, b.Len()
+		}
+	}
+	if best == nil {
+		return errors.New("no codec")
+	}
+	slog.Info("auto", "best", best.Name())
+
+	if err := writeStreamHeader(header, w, streamSections(encoderConfig, best)...); err != nil {
+		return err
+	}
+
+	encoder := best.NewEncoder(encoderConfig, cacheConfig, w)
+	for _, sample := range trial {
+		if err := encoder.Write(sample); err != nil {
+			return err
+		}
+	}
+	if rest {
+		if err := encodeSamples(sampleReader, encoder, encoderConfig.EncodedSeqMaxLen); err != nil {
+			return err
+		}
+	}
+	return finishEncode(encoderConfig, encoder, sampleReader.Trailer(), w)
+}
+
+// Stream is encoded stream after its header.
+type Stream struct {
+	Header        container.Header
+	EncoderConfig CacheSampleEncoderConfig // with keyframes of stream
+	MTU           int                      // of packets, 0 if stream is not in packets
+	Reader        *bufio.Reader            // markers, and trailer after them
+	Decoder       SampleDecoder            // nil if stream is in packets
+}
+
+// openStream reads header of encoded stream, and makes decoder of its samples by codec and sections of header.
+func openStream(encoderConfig CacheSampleEncoderConfig, cacheConfig cache.Config, r *bufio.Reader) (Stream, error) {
+	header, err := ReadStreamHeader(r)
+	if err != nil {
+		return Stream{}, err
+	}
+	if encoderConfig.KeyframeInterval, err = header.KeyframeInterval(); err != nil {
+		return Stream{}, err
+	}
+	s := Stream{Header: header, EncoderConfig: encoderConfig, Reader: r}
+
+	codec, err := streamCodec(header)
+	if err != nil {
+		return Stream{}, err
+	}
+
+	if s.MTU, err = header.PacketMTU(); err != nil || s.MTU > 0 {
+		return s, err
+	}
+
+	if s.Reader, err = joinSubstreams(header, encoderConfig.ByteOrder, r); err != nil {
+		return Stream{}, err
+	}
+	s.Decoder = codec.NewDecoder(encoderConfig, cacheConfig, s.Reader)
+	return s, nil
+}
+
+func decode(encoderConfig CacheSampleEncoderConfig, cacheConfig cache.Config, r *bufio.Reader, output *Output) error {
+	stream, err := openStream(encoderConfig, cacheConfig, r)
+	if err != nil {
+		return err
+	}
+	if stream.MTU > 0 {
+		return decodePackets(stream.Header, stream.MTU, stream.EncoderConfig, cacheConfig, stream.Reader, output)
+	}
+	encoderConfig, r, decoder := stream.EncoderConfig, stream.Reader, stream.Decoder
+
+	sampleWriter, trailer, err := NewSampleWriter(stream.Header, output)
+	if err != nil {
+		return err
+	}
+
+	samples := make([]uint16, 0, encoderConfig.EncodedSeqMaxLen)
+	for {
+		sample, err := decoder.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		samples = append(samples, sample)
+		if len(samples) == cap(samples) {
+			if err := sampleWriter.WriteSamples(samples); err != nil {
+				return err
+			}
+			samples = samples[:0]
+		}
+
+		// samples of streamed frame are written as soon as there is no more of input to decode
+		if output.Stream && len(samples) > 0 && r.Buffered() == 0 && decoder.Buffered() == 0 {
+			if err := sampleWriter.WriteSamples(samples); err != nil {
+				return err
+			}
+			if err := output.Flush(); err != nil {
+				return err
+			}
+			samples = samples[:0]
+		}
+	}
+	if err := sampleWriter.WriteSamples(samples); err != nil {
+		return err
+	}
+
+	if c, ok := sampleWriter.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			return err
+		}
+	}
+
+	return copyTrailer(r, encoderConfig.KeyframeInterval > 0, trailer)
+}
+
+// joinSubstreams is markers of sections followed by rest of stream, or stream as is if markers are not split.
+func joinSubstreams(header container.Header, byteOrder binary.ByteOrder, r *bufio.Reader) (*bufio.Reader, error) {
+	streams, ok, err := substream.FromHeader(header)
+	if err != nil || !ok {
+		return r, err
+	}
+	markers, err := substream.Join(streams, byteOrder)
+	if err != nil {
+		return nil, err
+	}
+	return bufio.NewReader(io.MultiReader(bytes.NewReader(markers), r)), nil
+}
+
+// copyTrailer copies trailer of input that is after zero marker, followed by index if there are keyframes.
+func copyTrailer(r *bufio.Reader, keyframes bool, trailer io.Writer) error {
+	if keyframes {
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		if _, b, err = container.ParseIndex(b); err != nil {
+			return err
+		}
+		r = bufio.NewReader(bytes.NewReader(b))
+	}
+
+	if _, err := r.Peek(1); err == io.EOF {
+		return nil
+	}
+	if trailer == nil {
+		return errors.New("unexpected bytes after samples")
+	}
+	_, err := io.Copy(trailer, r)
+	return err
+}
+
+// decodeRange decodes count samples from start of WAV stream with keyframes into WAV, all samples to the end if count is zero.
+func decodeRange(encoderConfig CacheSampleEncoderConfig, cacheConfig cache.Config, r io.ReadSeeker, start, count int, w io.Writer) error {
+	header, err := ReadStreamHeader(bufio.NewReader(r))
+	if err != nil {
+		return err
+	}
+	if encoderConfig.KeyframeInterval, err = header.KeyframeInterval(); err != nil {
+		return err
+	}
+	if encoderConfig.KeyframeInterval == 0 {
+		return errors.New("decoding range requires keyframes")
+	}
+	if header.Format != container.FormatWAV {
+		return fmt.Errorf("decoding range of %s is not supported", header.Format)
+	}
+	codec, err := streamCodec(header)
+	if err != nil {
+		return err
+	}
+	if codec.ID() != CodecIDCache && codec.ID() != CodecIDAdaptive {
+		return fmt.Errorf("decoding range of codec %s is not supported", codec.Name())
+	}
+	encoderConfig.Adaptive = codec.ID() == CodecIDAdaptive
+
+	metadata, _ := header.Section(container.SectionMetadata)
+	var wavHeader wav.WAVHeader
+	if err := wavHeader.UnmarshalBinary(bytes.NewReader(metadata)); err != nil {
+		return err
+	}
+
+	numSamples := int(wavHeader.DataSize() / wav.SampleSize)
+	if start > numSamples {
+		return fmt.Errorf("start(%d) is after last sample(%d)", start, numSamples)
+	}
+	if count == 0 || start+count > numSamples {
+		count = numSamples - start
+	}
+
+	index, err := container.ReadIndex(r)
+	if err != nil {
+		return err
+	}
+
+	decoder := NewCacheSampleDecoder(encoderConfig, cache.New(cacheConfig), r)
+	decoder.SetIndex(r, int64(header.Size()), index)
+	if err := decoder.SeekSample(start); err != nil {
+		return err
+	}
+
+	samples := make([]uint16, count)
+	for i := range samples {
+		if samples[i], err = decoder.Next(); err != nil {
+			return err
+		}
+	}
+
+	wavHeader.SetDataSize(uint64(count) * wav.SampleSize)
+	wavWriter := wav.NewWAVWriter(wavHeader, w)
+	if err := wavWriter.WriteHeader(); err != nil {
+		return err
+	}
+	return wavWriter.WriteSamples(samples)
+}
+
 func main() {
 	logLevel := slog.LevelInfo
 	if s := os.Getenv("LOG_LEVEL"); s != "" {
@@ -341,17 +986,104 @@ func main() {
 	slog.SetDefault(slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel})))
 
 	var (
-		mode        string
-		inFilename  string
-		outFilename string
+		mode           string
+		inFilename     string
+		outFilename    string
+		inputConfig    InputConfig
+		endian         string
+		sampleRate     uint
+		numChannels    uint
+		numBits        uint
+		dumpConfig     dump.Config
+		separator      string
+		timestamps     bool
+		keyframe       int
+		workers        int
+		verify         bool
+		evalConfig     EvalConfig
+		baselineConfig BaselineConfig
+		codecName      string
+		prefix         int
+		compareConfig  CompareConfig
+		split          string
+		streamConfig   StreamConfig
+		mtu            int
+		rateConfig     RateConfig
+		maxError       int
+		originalPath   string
+		spikeConfig    = spike.DefaultConfig
+		eventsConfig   EventsConfig
+		asJSON         bool
+		decodeStream   bool
+		start          int
+		count          int
 	)
-	flag.StringVar(&mode, "mode", "encode", "encode, decode, read (new-line delimited ASCII of binary of WAV samples)")
+	flag.StringVar(&mode, "mode", "encode", "encode, decode, read (new-line delimited ASCII of binary of WAV samples), dump (samples as CSV or TSV), load (CSV or TSV into WAV), batch (encode WAV files of directory into mirror directory, summary as CSV), eval (round trip files of zip archive as eval.sh), baseline (compare encoded sizes of zip archive or directory with baseline), auto (encode with codec that makes smallest output), stream (encode samples as they arrive with bounded latency, decoded as they arrive with -stream), verify (decode and compare samples with original within max error), packets (encode into packets of fixed size that can be lost, with resync at keyframes), compare (codecs and general purpose compressors on zip archive, directory or file), spikes (times and waveforms of spikes of input or of encoded stream without decoding it to file), analyze (entropy and statistics of cache of samples, with ideal ratio)")
 	flag.StringVar(&inFilename, "in", "", "filepath for input")
-	flag.StringVar(&outFilename, "out", "", "filepath for output")
+	flag.StringVar(&outFilename, "out", "", "filepath for output, directory for decoded openephys")
+	flag.StringVar(&inputConfig.Format, "format", "wav", "format of input to encode: wav, raw (headerless PCM), npy (NumPy array of int16, uint16, int32), edf (EDF, EDF+, BDF), openephys (directory of Open Ephys binary recording), intan (Intan RHD2000), decoded back to same format")
+	flag.UintVar(&sampleRate, "sample-rate", 19531, "raw, load: samples per second")
+	flag.UintVar(&numChannels, "channels", 1, "raw: number of interleaved channels")
+	flag.UintVar(&numBits, "bits", 16, "raw: bits per sample, 8 or 16")
+	flag.StringVar(&endian, "endian", "little", "raw: byte order of samples, little or big")
+	flag.StringVar(&separator, "separator", "csv", "dump, load: csv or tsv")
+	flag.IntVar(&dumpConfig.Radix, "radix", 10, "dump, load: 2, 10 or 16")
+	flag.BoolVar(&dumpConfig.Signed, "signed", true, "dump: decimal samples are int16")
+	flag.BoolVar(&dumpConfig.Header, "header", true, "dump, load: first row has names of columns")
+	flag.BoolVar(&timestamps, "timestamps", false, "dump, load: first column is time in seconds from sample rate of input")
+	flag.IntVar(&keyframe, "keyframe", 0, "encode: samples between cache resets, with block index at the end for seeking, 0 for none")
+	flag.IntVar(&workers, "workers", 1, "encode, decode: number of blocks between keyframes to encode or decode concurrently, encode requires keyframes; batch: number of files to encode concurrently")
+	flag.BoolVar(&verify, "verify", false, "batch: decode and compare with original")
+	flag.StringVar(&codecName, "codec", "cache", "encode: codec of samples, one of registered codecs")
+	flag.StringVar(&split, "split", "", "encode: split markers into streams compressed by backend in container sections, none, flate, huffman or best for each stream, empty to not split")
+	flag.IntVar(&streamConfig.MaxLatency, "latency", 0, "stream: max number of samples before they are flushed to output, 0 for max length of marker")
+	flag.DurationVar(&streamConfig.MaxLatencyTime, "latency-time", 0, "stream: max time samples wait before they are flushed to output, bounds number of samples by sample rate of input, 0 for none")
+	flag.Float64Var(&rateConfig.BitsPerSecond, "rate", 0, "encode: target bits per second of output, max error of samples up to -max-error is adapted to stay within it, 0 for none")
+	flag.DurationVar(&rateConfig.Window, "rate-window", 100*time.Millisecond, "encode: time after which output is measured against target rate")
+	flag.IntVar(&maxError, "max-error", 0, "encode: max error of decoded samples, near-lossless if above 0 for input of signed 16 bit samples, with -rate only when over target rate; verify: max error of samples, of stream if 0")
+	flag.Float64Var(&spikeConfig.Threshold, "spike-threshold", 0, "encode: samples in windows of spikes over threshold in deviations of noise are lossless, and others are within max error, 0 for no spikes; spikes: threshold of filtered samples, 0 for default")
+	flag.IntVar(&spikeConfig.Pre, "spike-pre", spikeConfig.Pre, "encode: samples of window of spike before threshold crossing; spikes: of waveform")
+	flag.IntVar(&spikeConfig.Post, "spike-post", spikeConfig.Post, "encode: samples of window of spike after threshold crossing; spikes: of waveform and of search of peak")
+	flag.Float64Var(&spikeConfig.LowCut, "low-cut", 300, "spikes: Hz of high-pass before detection, 0 for none")
+	flag.Float64Var(&spikeConfig.HighCut, "high-cut", 3000, "spikes: Hz of low-pass before detection, 0 for none")
+	flag.DurationVar(&eventsConfig.Refractory, "refractory", time.Millisecond, "spikes: time after spike in which there is no other spike")
+	flag.BoolVar(&eventsConfig.Encoded, "encoded", false, "spikes: input is encoded stream, encoded stream of formats other than WAV is detected regardless")
+	flag.StringVar(&eventsConfig.Format, "events", "csv", "spikes: csv or json")
+	flag.BoolVar(&asJSON, "json", false, "analyze: output JSON instead of text")
+	flag.StringVar(&originalPath, "original", "", "verify: input that was encoded, to compare decoded samples with")
+	flag.IntVar(&mtu, "mtu", 256, "packets: size of packet in bytes")
+	flag.IntVar(&prefix, "prefix", 0, "auto: number of first samples to choose codec by, 0 for all")
+	flag.StringVar(&compareConfig.CSVPath, "csv", "", "compare: file to write CSV of results to")
+	flag.StringVar(&baselineConfig.BaselinePath, "baseline", "baseline.json", "baseline: JSON file of encoded sizes of recordings")
+	flag.BoolVar(&baselineConfig.Update, "update", false, "baseline: write baseline instead of comparing with it")
+	flag.Float64Var(&baselineConfig.Tolerance, "tolerance", 0, "baseline: fraction encoded size of file can grow by")
+	flag.StringVar(&evalConfig.EncoderBin, "encoder-bin", "", "eval: encoder binary counted into compressed size, this executable if empty")
+	flag.StringVar(&evalConfig.DecoderBin, "decoder-bin", "", "eval: decoder binary counted into compressed size, this executable if empty")
+	flag.BoolVar(&decodeStream, "stream", false, "decode: write samples as soon as they are decoded, for input of stream mode")
+	flag.IntVar(&start, "start", 0, "decode: first sample of range to decode into WAV, requires keyframes")
+	flag.IntVar(&count, "count", 0, "decode: number of samples of range to decode into WAV, 0 to the end")
 	flag.Parse()
 
+	switch separator {
+	case "csv":
+		dumpConfig.Separator = ','
+	case "tsv":
+		dumpConfig.Separator = '\t'
+	default:
+		log.Fatalf("unknown separator: %s", separator)
+	}
+
+	if endian != "little" && endian != "big" {
+		log.Fatalf("unknown endian: %s", endian)
+	}
+	inputConfig.PCM = pcm.Format{
+		SampleRate:    uint32(sampleRate),
+		NumChannels:   uint16(numChannels),
+		BitsPerSample: uint16(numBits),
+		BigEndian:     endian == "big",
+	}
+
 	var in io.Reader = os.Stdin
-	var out io.Writer = os.Stdout
 
 	if inFilename != "" {
 		f, err := os.Open(inFilename)
@@ -361,73 +1093,302 @@ func main() {
 		defer f.Close()
 		in = f
 	}
+	inputConfig.Path = inFilename
 
-	if outFilename != "" {
-		f, err := os.Create(outFilename)
-		if err != nil {
+	r := bufio.NewReader(in)
+	output := &Output{Path: outFilename, Stream: decodeStream}
+
+	// all modes but decode and batch write single output file
+	var w *bufio.Writer
+	if mode != "decode" && mode != "batch" {
+		var err error
+		if w, err = output.Create(""); err != nil {
 			log.Fatal(err)
 		}
-		defer f.Close()
-		out = f
-	}
-
-	wavReader := wav.NewWAVReader(in)
-	if err := wavReader.ReadHeader(); err != nil {
-		log.Fatal(err)
 	}
 
-	slog.Info("wav info", "header", wavReader.Header, "PCM", wavReader.Header.IsPCM())
-
-	if err := ValidateWAVHeader(wavReader.Header); err != nil {
-		log.Fatal(err)
-	}
-
-	wavWriter := wav.NewWAVWriter(wavReader.Header, out)
-	wavWriter.WriteHeader()
-
-	byteWAVWriter := bufio.NewWriter(wavWriter)
-	defer byteWAVWriter.Flush()
-
 	encoderConfig := CacheSampleEncoderConfig{
 		EncodedSeqMaxLen:    (1 << 13) - 1,
 		NotEncodedSeqMaxLen: (1 << 7) - 1,
 		ByteOrder:           binary.LittleEndian,
+		KeyframeInterval:    keyframe,
+		Workers:             workers,
 	}
-	cacheConfig := CacheConfig{
+	cacheConfig := cache.Config{
 		Size: 1 << 10,
 	}
 
+	// with rate control, samples are within max error only when over target rate
+	if rateConfig.BitsPerSecond > 0 {
+		rateConfig.MaxError = maxError
+	} else {
+		encoderConfig.MaxError = maxError
+	}
+	switch mode {
+	case "encode", "auto", "stream", "packets":
+		inputConfig.Lossy = maxError > 0 || spikeConfig.Threshold > 0
+	}
+
 	switch mode {
 	case "read":
-		for sample, err := wavReader.Next(); err != io.EOF; sample, err = wavReader.Next() {
-			fmt.Printf("%016b\n", sample)
+		sampleReader, err := NewSampleReader(inputConfig, r, io.Discard)
+		if err != nil {
+			log.Fatal(err)
 		}
-	case "encode":
-		encoder := NewCacheSampleEncoder(encoderConfig, NewCache(cacheConfig), byteWAVWriter)
-		defer func() { slog.Info("done", "stats", encoder.Stats()) }()
-		defer encoder.FlushBuffer()
 
-		for sample, err := wavReader.Next(); err != io.EOF; sample, err = wavReader.Next() {
-			if err := encoder.Write(sample); err != nil {
+		samples := make([]uint16, encoderConfig.EncodedSeqMaxLen)
+		for {
+			n, err := sampleReader.ReadSamples(samples)
+			for _, sample := range samples[:n] {
+				fmt.Fprintf(w, "%016b\n", sample)
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+	case "dump":
+		sampleReader, err := NewSampleReader(inputConfig, r, io.Discard)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		sampleRate, numChannels := sampleLayout(sampleReader)
+		dumpConfig.NumChannels = numChannels
+		if timestamps {
+			dumpConfig.SampleRate = sampleRate
+		}
+		if err := dumpConfig.Validate(); err != nil {
+			log.Fatal(err)
+		}
+
+		dumpWriter := dump.NewWriter(dumpConfig, w)
+		if dumpConfig.Header {
+			if err := dumpWriter.WriteHeader(); err != nil {
 				log.Fatal(err)
 			}
 		}
-	case "decode":
-		decoder := NewCacheSampleDecoder(encoderConfig, NewCache(cacheConfig), wavReader)
 
-		for sample, err := decoder.Next(); err != io.EOF; sample, err = decoder.Next() {
-			if err := wavWriter.WriteSample(sample); err != nil {
+		samples := make([]uint16, encoderConfig.EncodedSeqMaxLen)
+		for {
+			n, err := sampleReader.ReadSamples(samples)
+			if err := dumpWriter.WriteSamples(samples[:n]); err != nil {
+				log.Fatal(err)
+			}
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
 				log.Fatal(err)
 			}
 		}
+		if err := dumpWriter.Flush(); err != nil {
+			log.Fatal(err)
+		}
+	case "load":
+		dumpConfig.NumChannels = 1
+		if timestamps {
+			dumpConfig.SampleRate = float64(sampleRate)
+		}
+		if err := dumpConfig.Validate(); err != nil {
+			log.Fatal(err)
+		}
+
+		dumpReader := dump.NewReader(dumpConfig, r)
+
+		var samples []uint16
+		buf := make([]uint16, encoderConfig.EncodedSeqMaxLen)
+		for {
+			n, err := dumpReader.ReadSamples(buf)
+			samples = append(samples, buf[:n]...)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		header := wav.NewWAVHeader(uint32(sampleRate), uint16(max(dumpReader.NumChannels, 1)))
+		header.SetDataSize(uint64(len(samples)) * wav.SampleSize)
+
+		wavWriter := wav.NewWAVWriter(header, w)
+		if err := wavWriter.WriteHeader(); err != nil {
+			log.Fatal(err)
+		}
+		if err := wavWriter.WriteSamples(samples); err != nil {
+			log.Fatal(err)
+		}
+	case "encode":
+		// each of parallel, split, spikes and rate encoding is separate path
+		if workers > 1 && (split != "" || rateConfig.BitsPerSecond > 0 || spikeConfig.Threshold > 0) {
+			log.Fatal("parallel encoding does not support split, rate or spikes")
+		}
+		if split != "" && (rateConfig.BitsPerSecond > 0 || spikeConfig.Threshold > 0) {
+			log.Fatal("splitting into streams does not support rate or spikes")
+		}
+		if spikeConfig.Threshold > 0 && rateConfig.BitsPerSecond > 0 {
+			log.Fatal("spikes do not support rate")
+		}
+		if workers > 1 {
+			if codecName != (CacheCodec{}).Name() {
+				log.Fatal("parallel encoding requires cache codec")
+			}
+			if err := encodeParallel(encoderConfig, cacheConfig, inputConfig, r, w); err != nil {
+				log.Fatal(err)
+			}
+			break
+		}
+		if split != "" {
+			if codecName != (CacheCodec{}).Name() {
+				log.Fatal("splitting into streams requires cache codec")
+			}
+			if err := encodeSplit(split, encoderConfig, cacheConfig, inputConfig, r, w); err != nil {
+				log.Fatal(err)
+			}
+			break
+		}
+		codec, ok := CodecByName(codecName)
+		if !ok {
+			log.Fatalf("unknown codec: %s", codecName)
+		}
+		if spikeConfig.Threshold > 0 {
+			if err := encodeSpikes(spikeConfig, codec, encoderConfig, cacheConfig, inputConfig, r, w); err != nil {
+				log.Fatal(err)
+			}
+			break
+		}
+		if rateConfig.BitsPerSecond > 0 {
+			if err := encodeRate(rateConfig, codec, encoderConfig, cacheConfig, inputConfig, r, w); err != nil {
+				log.Fatal(err)
+			}
+			break
+		}
+		if err := encode(codec, encoderConfig, cacheConfig, inputConfig, r, w); err != nil {
+			log.Fatal(err)
+		}
+	case "auto":
+		if err := encodeAuto(encoderConfig, cacheConfig, inputConfig, prefix, r, w); err != nil {
+			log.Fatal(err)
+		}
+	case "stream":
+		codec, ok := CodecByName(codecName)
+		if !ok {
+			log.Fatalf("unknown codec: %s", codecName)
+		}
+		if err := encodeStream(streamConfig, codec, encoderConfig, cacheConfig, inputConfig, r, w); err != nil {
+			log.Fatal(err)
+		}
+	case "verify":
+		original, err := os.Open(originalPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		result, err := verifyStream(maxError, encoderConfig, cacheConfig, inputConfig, original, r)
+		original.Close()
+		fmt.Fprintln(w, result)
+		if err := w.Flush(); err != nil {
+			log.Fatal(err)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "spikes":
+		// threshold of encode is off by default
+		eventsConfig.Spike = spikeConfig
+		if eventsConfig.Spike.Threshold == 0 {
+			eventsConfig.Spike.Threshold = spike.DefaultConfig.Threshold
+		}
+		if err := detectEvents(eventsConfig, encoderConfig, cacheConfig, inputConfig, r, w); err != nil {
+			w.Flush()
+			log.Fatal(err)
+		}
+	case "analyze":
+		if err := analyze(asJSON, encoderConfig, cacheConfig, inputConfig, r, w); err != nil {
+			w.Flush()
+			log.Fatal(err)
+		}
+	case "packets":
+		if err := encodePackets(mtu, encoderConfig, cacheConfig, inputConfig, r, w); err != nil {
+			log.Fatal(err)
+		}
+	case "decode":
+		if start > 0 || count > 0 {
+			f, ok := in.(*os.File)
+			if !ok || inFilename == "" {
+				log.Fatal("decoding range requires input file")
+			}
+			w, err := output.Create("")
+			if err != nil {
+				log.Fatal(err)
+			}
+			if err := decodeRange(encoderConfig, cacheConfig, f, start, count, w); err != nil {
+				log.Fatal(err)
+			}
+			break
+		}
+		if f, ok := in.(*os.File); ok && inFilename != "" && workers > 1 {
+			if err := decodeParallel(encoderConfig, cacheConfig, f, output); err != nil {
+				log.Fatal(err)
+			}
+			break
+		}
+		if err := decode(encoderConfig, cacheConfig, r, output); err != nil {
+			log.Fatal(err)
+		}
+	case "batch":
+		w := bufio.NewWriter(os.Stdout)
+		err := batch(BatchConfig{InDir: inFilename, OutDir: outFilename, Workers: workers, Verify: verify}, encoderConfig, cacheConfig, w)
+		if err := w.Flush(); err != nil {
+			log.Fatal(err)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+	case "eval":
+		evalConfig.Path = inFilename
+		if err := eval(evalConfig, encoderConfig, cacheConfig, w); err != nil {
+			w.Flush()
+			log.Fatal(err)
+		}
+	case "baseline":
+		baselineConfig.Path = inFilename
+		if err := compareBaseline(baselineConfig, encoderConfig, cacheConfig, w); err != nil {
+			w.Flush()
+			log.Fatal(err)
+		}
+	case "compare":
+		compareConfig.Path = inFilename
+		if err := compare(compareConfig, encoderConfig, cacheConfig, w); err != nil {
+			w.Flush()
+			log.Fatal(err)
+		}
 	case "encode_graph_transitions":
+		wavReader := wav.NewWAVReader(r)
+		if err := wavReader.ReadHeader(); err != nil {
+			log.Fatal(err)
+		}
+
 		// TODO: only stats for now
 		encoder := NewGraphTransitionEncoder()
 		defer func() { slog.Error("done", "stats", encoder.Stats()) }()
-		for sample, err := wavReader.Next(); err != io.EOF; sample, err = wavReader.Next() {
+
+		sample, err := wavReader.Next()
+		for ; err == nil; sample, err = wavReader.Next() {
 			if err := encoder.Write(sample); err != nil {
 				log.Fatal(err)
 			}
 		}
+		if err != io.EOF {
+			log.Fatal(err)
+		}
+	default:
+		log.Fatalf("unknown mode: %s", mode)
+	}
+
+	if err := output.Close(); err != nil {
+		log.Fatal(err)
 	}
 }
@@ -1,16 +1,40 @@
 package main_test
 
 import (
+	"archive/zip"
 	"bytes"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand/v2"
 	"os"
 	"os/exec"
 	"path"
+	"slices"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/container"
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/edf"
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/npy"
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/spike"
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/wav"
 )
 
-func TestCLIEncoder(t *testing.T) {
+func buildCLI(t *testing.T) string {
 	testbin := path.Join(t.TempDir(), "go-encoder")
-	exec.Command("go", "build", "-o", testbin, ".").Run()
+	if out, err := exec.Command("go", "build", "-o", testbin, ".").CombinedOutput(); err != nil {
+		t.Fatal(err, string(out))
+	}
+	return testbin
+}
+
+func TestCLIEncoder(t *testing.T) {
+	testbin := buildCLI(t)
 
 	fnames := []string{
 		"0052503c-2849-4f41-ab51-db382103690c.wav",
@@ -42,3 +66,1077 @@ func TestCLIEncoder(t *testing.T) {
 		})
 	}
 }
+
+func roundtripCLI(t *testing.T, testbin string, fa []byte, args ...string) (encoded []byte) {
+	dir := t.TempDir()
+	i := path.Join(dir, "in")
+	e := path.Join(dir, "in.encoded")
+	d := path.Join(dir, "in.decoded")
+	os.WriteFile(i, fa, 0644)
+
+	if out, err := exec.Command(testbin, append([]string{"-mode", "encode", "-in", i, "-out", e}, args...)...).CombinedOutput(); err != nil {
+		t.Fatal(err, string(out))
+	}
+	if out, err := exec.Command(testbin, "-mode", "decode", "-in", e, "-out", d).CombinedOutput(); err != nil {
+		t.Fatal(err, string(out))
+	}
+
+	fb, _ := os.ReadFile(d)
+	if !bytes.Equal(fa, fb) {
+		t.Errorf("files are different")
+	}
+
+	encoded, _ = os.ReadFile(e)
+	return encoded
+}
+
+func TestCLIEncoder_WAVTrailer(t *testing.T) {
+	fa, _ := os.ReadFile(path.Join("testdata", "0052503c-2849-4f41-ab51-db382103690c.wav"))
+	fa = append(fa, []byte("LIST\x04\x00\x00\x00INFO")...)
+	roundtripCLI(t, buildCLI(t), fa)
+}
+
+func TestCLIEncoder_RF64(t *testing.T) {
+	f, _ := os.Open(path.Join("testdata", "0052503c-2849-4f41-ab51-db382103690c.wav"))
+	defer f.Close()
+
+	r := wav.NewWAVReader(f)
+	if err := r.ReadHeader(); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(r)
+
+	header := r.Header
+	header.ChunkID = [4]byte{'R', 'F', '6', '4'}
+	header.SetDataSize(uint64(len(data)))
+
+	var b bytes.Buffer
+	header.MarshalBinary(&b)
+	b.Write(data)
+
+	roundtripCLI(t, buildCLI(t), b.Bytes())
+}
+
+func TestCLIEncoder_Raw(t *testing.T) {
+	f, _ := os.Open(path.Join("testdata", "ff970660-0ffd-461f-93de-379e95cd784a.wav"))
+	defer f.Close()
+
+	r := wav.NewWAVReader(f)
+	if err := r.ReadHeader(); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(r)
+
+	// big endian, with partial last sample
+	for i := 0; i+1 < len(data); i += 2 {
+		data[i], data[i+1] = data[i+1], data[i]
+	}
+	data = append(data, 0xAB)
+
+	encoded := roundtripCLI(t, buildCLI(t), data, "-format", "raw", "-endian", "big", "-channels", "2", "-sample-rate", "30000")
+	if !container.IsContainer(encoded) {
+		t.Error("expected container")
+	}
+	t.Logf("compression ratio: %.2f", float64(len(data))/float64(len(encoded)))
+}
+
+func TestCLIEncoder_NPY(t *testing.T) {
+	f, _ := os.Open(path.Join("testdata", "ff970660-0ffd-461f-93de-379e95cd784a.wav"))
+	defer f.Close()
+
+	r := wav.NewWAVReader(f)
+	if err := r.ReadHeader(); err != nil {
+		t.Fatal(err)
+	}
+	samples := make([]int16, r.Remaining()/2)
+	n, _ := r.ReadInt16Samples(samples)
+	samples = samples[:n-(n%4)]
+
+	for _, header := range []npy.Header{
+		{Descr: "<i2", Shape: []int{len(samples)}},
+		{Descr: "<i2", Shape: []int{len(samples) / 4, 4}},
+		{Descr: "<i4", Shape: []int{len(samples) / 4, 4}, FortranOrder: true},
+	} {
+		t.Run(header.Descr, func(t *testing.T) {
+			var b bytes.Buffer
+			w := npy.NewWriter(header, &b)
+			w.WriteHeader()
+
+			channels := make([][]int32, header.NumChannels())
+			for i, v := range samples {
+				c := i % header.NumChannels()
+				channels[c] = append(channels[c], int32(v))
+			}
+			if err := w.WriteChannels(channels); err != nil {
+				t.Fatal(err)
+			}
+
+			encoded := roundtripCLI(t, buildCLI(t), b.Bytes(), "-format", "npy")
+			t.Logf("compression ratio: %.2f", float64(b.Len())/float64(len(encoded)))
+		})
+	}
+}
+
+func TestCLIEncoder_EDF(t *testing.T) {
+	f, _ := os.Open(path.Join("testdata", "ff970660-0ffd-461f-93de-379e95cd784a.wav"))
+	defer f.Close()
+
+	r := wav.NewWAVReader(f)
+	if err := r.ReadHeader(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, version := range []string{"0", edf.BDFVersion} {
+		header := edf.Header{
+			Version:        version,
+			Patient:        "X X X X",
+			Recording:      "Startdate X X X X",
+			StartDate:      "19.10.26",
+			StartTime:      "10.00.00",
+			Reserved:       "EDF+C",
+			NumRecords:     0,
+			RecordDuration: 1,
+			Signals: []edf.Signal{
+				{Label: "EEG", PhysicalMin: -1, PhysicalMax: 1, DigitalMin: -32768, DigitalMax: 32767, SamplesPerRecord: int(r.Header.SampleRate)},
+				{Label: "EDF Annotations", PhysicalMin: -1, PhysicalMax: 1, DigitalMin: -32768, DigitalMax: 32767, SamplesPerRecord: 30},
+			},
+		}
+
+		var records []edf.Record
+		samples := make([]int16, header.Signals[0].SamplesPerRecord)
+		for {
+			n, _ := r.ReadInt16Samples(samples)
+			if n < len(samples) {
+				break
+			}
+
+			tals, err := header.MarshalAnnotations([]edf.Annotation{{Onset: float64(len(records)), Texts: []string{""}}}, header.Signals[1].SamplesPerRecord)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			record := edf.Record{Signals: [][]int32{nil, tals}}
+			for _, v := range samples {
+				record.Signals[0] = append(record.Signals[0], int32(v))
+			}
+			records = append(records, record)
+		}
+		header.NumRecords = len(records)
+
+		var b bytes.Buffer
+		w := edf.NewWriter(header, &b)
+		w.WriteHeader()
+		for _, record := range records {
+			if err := w.WriteRecord(record); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		encoded := roundtripCLI(t, buildCLI(t), b.Bytes(), "-format", "edf")
+		t.Logf("compression ratio: %.2f", float64(b.Len())/float64(len(encoded)))
+	}
+}
+
+func TestCLIEncoder_Intan(t *testing.T) {
+	fa, _ := os.ReadFile(path.Join("input", "testdata", "recording.rhd"))
+	fa = append(fa, 0x01)
+	roundtripCLI(t, buildCLI(t), fa, "-format", "intan")
+}
+
+func TestCLIEncoder_OpenEphys(t *testing.T) {
+	testbin := buildCLI(t)
+	i := path.Join("input", "testdata", "openephys")
+	e := path.Join(t.TempDir(), "recording.encoded")
+	d := path.Join(t.TempDir(), "recording")
+
+	if out, err := exec.Command(testbin, "-mode", "encode", "-format", "openephys", "-in", i, "-out", e).CombinedOutput(); err != nil {
+		t.Fatal(err, string(out))
+	}
+	if out, err := exec.Command(testbin, "-mode", "decode", "-in", e, "-out", d).CombinedOutput(); err != nil {
+		t.Fatal(err, string(out))
+	}
+
+	for _, name := range []string{"structure.oebin", path.Join("continuous", "Rhythm_FPGA-100.0", "continuous.dat")} {
+		fa, _ := os.ReadFile(path.Join(i, name))
+		fb, _ := os.ReadFile(path.Join(d, name))
+		if len(fa) == 0 || !bytes.Equal(fa, fb) {
+			t.Errorf("%s is different", name)
+		}
+	}
+}
+
+func TestCLIDumpLoad(t *testing.T) {
+	testbin := buildCLI(t)
+	i := path.Join("testdata", "ff970660-0ffd-461f-93de-379e95cd784a.wav")
+
+	for _, args := range [][]string{
+		{"-radix", "10", "-separator", "csv", "-timestamps"},
+		{"-radix", "16", "-separator", "tsv", "-header=false"},
+		{"-radix", "2", "-separator", "csv"},
+	} {
+		d := path.Join(t.TempDir(), "samples.txt")
+		l := path.Join(t.TempDir(), "loaded.wav")
+
+		if out, err := exec.Command(testbin, append([]string{"-mode", "dump", "-in", i, "-out", d}, args...)...).CombinedOutput(); err != nil {
+			t.Fatal(err, string(out))
+		}
+		if out, err := exec.Command(testbin, append([]string{"-mode", "load", "-in", d, "-out", l}, args...)...).CombinedOutput(); err != nil {
+			t.Fatal(err, string(out))
+		}
+
+		fa, _ := os.ReadFile(i)
+		fb, _ := os.ReadFile(l)
+		if !bytes.Equal(fa, fb) {
+			t.Errorf("%v: files are different", args)
+		}
+	}
+}
+
+func TestCLIEncoder_Keyframes(t *testing.T) {
+	testbin := buildCLI(t)
+
+	fa, _ := os.ReadFile(path.Join("testdata", "0052503c-2849-4f41-ab51-db382103690c.wav"))
+	fa = append(fa, []byte("LIST\x04\x00\x00\x00INFO")...)
+	encoded := roundtripCLI(t, testbin, fa, "-keyframe", "1000")
+	if !container.IsContainer(encoded) {
+		t.Error("expected container")
+	}
+
+	r := wav.NewWAVReader(bytes.NewReader(fa))
+	if err := r.ReadHeader(); err != nil {
+		t.Fatal(err)
+	}
+	samples := make([]uint16, r.Remaining()/2)
+	if _, err := r.ReadSamples(samples); err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	e := path.Join(dir, "in.encoded")
+	os.WriteFile(e, encoded, 0644)
+
+	tests := []struct {
+		start, count int
+		expected     []uint16
+	}{
+		{start: 12345, count: 3000, expected: samples[12345 : 12345+3000]},
+		{start: 2000, count: 1, expected: samples[2000:2001]},
+		{start: len(samples) - 10, expected: samples[len(samples)-10:]},
+		{start: 1, count: 2 * len(samples), expected: samples[1:]},
+	}
+	for _, tc := range tests {
+		t.Run(fmt.Sprintf("%d_%d", tc.start, tc.count), func(t *testing.T) {
+			d := path.Join(dir, "range.wav")
+			if out, err := exec.Command(testbin, "-mode", "decode", "-in", e, "-out", d, "-start", strconv.Itoa(tc.start), "-count", strconv.Itoa(tc.count)).CombinedOutput(); err != nil {
+				t.Fatal(err, string(out))
+			}
+
+			f, _ := os.Open(d)
+			defer f.Close()
+
+			r := wav.NewWAVReader(f)
+			if err := r.ReadHeader(); err != nil {
+				t.Fatal(err)
+			}
+			got := make([]uint16, r.Remaining()/2)
+			if _, err := r.ReadSamples(got); err != nil && err != io.EOF {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tc.expected) {
+				t.Errorf("decoded %d samples, expected %d", len(got), len(tc.expected))
+			}
+		})
+	}
+}
+
+func TestCLIEncoder_Workers(t *testing.T) {
+	testbin := buildCLI(t)
+
+	fa, _ := os.ReadFile(path.Join("testdata", "0052503c-2849-4f41-ab51-db382103690c.wav"))
+	fa = append(fa, []byte("LIST\x04\x00\x00\x00INFO")...)
+
+	sequential := roundtripCLI(t, testbin, fa, "-keyframe", "5000")
+	parallel := roundtripCLI(t, testbin, fa, "-keyframe", "5000", "-workers", "4")
+	if !bytes.Equal(sequential, parallel) {
+		t.Error("parallel encoding is different from sequential")
+	}
+
+	dir := t.TempDir()
+	e := path.Join(dir, "in.encoded")
+	d := path.Join(dir, "in.decoded")
+	os.WriteFile(e, parallel, 0644)
+	if out, err := exec.Command(testbin, "-mode", "decode", "-in", e, "-out", d, "-workers", "4").CombinedOutput(); err != nil {
+		t.Fatal(err, string(out))
+	}
+	if fb, _ := os.ReadFile(d); !bytes.Equal(fa, fb) {
+		t.Error("files are different")
+	}
+}
+
+func TestCLIEncoder_FlagConflicts(t *testing.T) {
+	testbin := buildCLI(t)
+
+	in := path.Join("testdata", "ff970660-0ffd-461f-93de-379e95cd784a.wav")
+	for _, args := range [][]string{
+		{"-keyframe", "5000", "-workers", "4", "-split", "best"},
+		{"-keyframe", "5000", "-workers", "4", "-rate", "50000", "-max-error", "64"},
+		{"-keyframe", "5000", "-workers", "4", "-max-error", "64", "-spike-threshold", "4"},
+		{"-split", "best", "-rate", "50000"},
+		{"-max-error", "64", "-spike-threshold", "4", "-rate", "50000"},
+	} {
+		out, err := exec.Command(testbin, append([]string{"-in", in, "-out", path.Join(t.TempDir(), "encoded")}, args...)...).CombinedOutput()
+		if err == nil || !strings.Contains(string(out), "not support") {
+			t.Errorf("%v: expected error of flags: %s", args, out)
+		}
+	}
+}
+
+func TestCLIBatch(t *testing.T) {
+	testbin := buildCLI(t)
+
+	in, out := t.TempDir(), t.TempDir()
+	fa, _ := os.ReadFile(path.Join("testdata", "0052503c-2849-4f41-ab51-db382103690c.wav"))
+	fb, _ := os.ReadFile(path.Join("testdata", "ff970660-0ffd-461f-93de-379e95cd784a.wav"))
+	os.MkdirAll(path.Join(in, "nested"), 0755)
+	os.WriteFile(path.Join(in, "a.wav"), fa, 0644)
+	os.WriteFile(path.Join(in, "nested", "b.wav"), fb, 0644)
+	os.WriteFile(path.Join(in, "notes.txt"), []byte("not a recording"), 0644)
+
+	t.Run("ok", func(t *testing.T) {
+		summary, err := exec.Command(testbin, "-mode", "batch", "-in", in, "-out", out, "-workers", "2", "-verify").Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rows, err := csv.NewReader(bytes.NewReader(summary)).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rows) != 4 || rows[1][0] != "a.wav" || rows[2][0] != path.Join("nested", "b.wav") || rows[3][0] != "total" {
+			t.Fatalf("wrong summary: %v", rows)
+		}
+		for _, row := range rows[1:] {
+			if row[4] != "true" || row[5] != "" {
+				t.Errorf("not verified: %v", row)
+			}
+		}
+
+		encoded, err := os.ReadFile(path.Join(out, "nested", "b.wav.brainwire"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if rows[2][2] != strconv.Itoa(len(encoded)) {
+			t.Errorf("encoded size(%s) != %d", rows[2][2], len(encoded))
+		}
+	})
+
+	t.Run("failure", func(t *testing.T) {
+		os.WriteFile(path.Join(in, "broken.wav"), []byte("RIFF"), 0644)
+
+		summary, err := exec.Command(testbin, "-mode", "batch", "-in", in, "-out", out, "-workers", "2").Output()
+		if err == nil {
+			t.Fatal("expected error")
+		}
+
+		rows, err := csv.NewReader(bytes.NewReader(summary)).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(rows) != 5 || rows[2][0] != "broken.wav" || rows[2][5] == "" || rows[4][5] != "1 of 3 files failed" {
+			t.Errorf("wrong summary: %v", rows)
+		}
+	})
+}
+
+func TestCLIEval(t *testing.T) {
+	testbin := buildCLI(t)
+
+	dir := t.TempDir()
+	archive := path.Join(dir, "data.zip")
+	writeZip := func(extra map[string][]byte) {
+		f, _ := os.Create(archive)
+		defer f.Close()
+		zw := zip.NewWriter(f)
+		zw.Create("data/")
+		for _, name := range []string{"0052503c-2849-4f41-ab51-db382103690c.wav", "ff970660-0ffd-461f-93de-379e95cd784a.wav"} {
+			b, _ := os.ReadFile(path.Join("testdata", name))
+			w, _ := zw.Create("data/" + name)
+			w.Write(b)
+		}
+		for name, b := range extra {
+			w, _ := zw.Create(name)
+			w.Write(b)
+		}
+		if err := zw.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("ok", func(t *testing.T) {
+		writeZip(nil)
+		out, err := exec.Command(testbin, "-mode", "eval", "-in", archive, "-encoder-bin", testbin, "-decoder-bin", testbin).Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		info, _ := os.Stat(testbin)
+		report := string(out)
+		for _, s := range []string{
+			"Processing data/0052503c-2849-4f41-ab51-db382103690c.wav\n",
+			"data/ff970660-0ffd-461f-93de-379e95cd784a.wav losslessly compressed from ",
+			"All recordings successfully compressed.\n",
+			"Compression ratio: ",
+			"Files: 2\n",
+			"Ratio p50: ",
+		} {
+			if !strings.Contains(report, s) {
+				t.Errorf("no %q in report:\n%s", s, report)
+			}
+		}
+
+		var raw, compressed int64
+		for _, line := range strings.Split(report, "\n") {
+			fmt.Sscanf(line, "Original size (bytes): %d", &raw)
+			fmt.Sscanf(line, "Compressed size (bytes): %d", &compressed)
+		}
+		if raw == 0 || compressed <= 2*info.Size() {
+			t.Errorf("wrong totals %d %d", raw, compressed)
+		}
+	})
+
+	t.Run("max error", func(t *testing.T) {
+		writeZip(nil)
+		out, err := exec.Command(testbin, "-mode", "eval", "-in", archive, "-max-error", "4").Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if report := string(out); strings.Contains(report, " losslessly compressed") || !strings.Contains(report, "near-losslessly compressed") || !strings.Contains(report, "rmse(") {
+			t.Errorf("report of max error:\n%s", report)
+		}
+	})
+
+	t.Run("broken file", func(t *testing.T) {
+		writeZip(map[string][]byte{"data/broken.wav": []byte("RIFF")})
+		if out, err := exec.Command(testbin, "-mode", "eval", "-in", archive).CombinedOutput(); err == nil {
+			t.Error("expected error", string(out))
+		}
+	})
+}
+
+func TestCLIBaseline(t *testing.T) {
+	testbin := buildCLI(t)
+
+	t.Run("no regression against testdata baseline", func(t *testing.T) {
+		if out, err := exec.Command(testbin, "-mode", "baseline", "-in", "testdata", "-baseline", path.Join("testdata", "baseline.json")).CombinedOutput(); err != nil {
+			t.Fatal(err, string(out))
+		}
+	})
+
+	t.Run("regression", func(t *testing.T) {
+		baseline := path.Join(t.TempDir(), "baseline.json")
+		if out, err := exec.Command(testbin, "-mode", "baseline", "-in", "testdata", "-baseline", baseline, "-update").CombinedOutput(); err != nil {
+			t.Fatal(err, string(out))
+		}
+
+		b, _ := os.ReadFile(baseline)
+		var v struct {
+			Files map[string]int64 `json:"files"`
+		}
+		json.Unmarshal(b, &v)
+		v.Files["0052503c-2849-4f41-ab51-db382103690c.wav"] -= 100
+		v.Files["removed.wav"] = 1
+		b, _ = json.Marshal(v)
+		os.WriteFile(baseline, b, 0644)
+
+		out, err := exec.Command(testbin, "-mode", "baseline", "-in", "testdata", "-baseline", baseline, "-tolerance", "0.0001").Output()
+		if err == nil {
+			t.Error("expected error")
+		}
+		if s := string(out); !strings.Contains(s, "REGRESSION 0052503c-2849-4f41-ab51-db382103690c.wav") || !strings.Contains(s, "MISSING removed.wav") {
+			t.Error(s)
+		}
+
+		delete(v.Files, "removed.wav")
+		b, _ = json.Marshal(v)
+		os.WriteFile(baseline, b, 0644)
+		if out, err := exec.Command(testbin, "-mode", "baseline", "-in", "testdata", "-baseline", baseline, "-tolerance", "0.01").CombinedOutput(); err != nil {
+			t.Error(err, string(out))
+		}
+	})
+}
+
+func TestCLIEncoder_Codec(t *testing.T) {
+	testbin := buildCLI(t)
+
+	fa, _ := os.ReadFile(path.Join("testdata", "0052503c-2849-4f41-ab51-db382103690c.wav"))
+	fa = append(fa, []byte("LIST\x04\x00\x00\x00INFO")...)
+
+	t.Run("raw", func(t *testing.T) {
+		encoded := roundtripCLI(t, testbin, fa, "-codec", "raw")
+		if !container.IsContainer(encoded) {
+			t.Error("expected container")
+		}
+	})
+
+	t.Run("adaptive with keyframes", func(t *testing.T) {
+		encoded := roundtripCLI(t, testbin, fa, "-codec", "adaptive", "-keyframe", "10000")
+
+		dir := t.TempDir()
+		e, d := path.Join(dir, "encoded"), path.Join(dir, "range.wav")
+		os.WriteFile(e, encoded, 0644)
+		if out, err := exec.Command(testbin, "-mode", "decode", "-in", e, "-out", d, "-start", "25000", "-count", "100").CombinedOutput(); err != nil {
+			t.Fatal(err, string(out))
+		}
+		got, _ := os.ReadFile(d)
+		if len(got) != 44+200 || !bytes.Equal(got[44:], fa[44+2*25000:44+2*25100]) {
+			t.Error("wrong range")
+		}
+	})
+
+	t.Run("auto picks cache and keeps legacy stream", func(t *testing.T) {
+		dir := t.TempDir()
+		i, e, a := path.Join(dir, "in"), path.Join(dir, "cache"), path.Join(dir, "auto")
+		os.WriteFile(i, fa, 0644)
+		exec.Command(testbin, "-mode", "encode", "-in", i, "-out", e).Run()
+		fe, _ := os.ReadFile(e)
+		// prefix of part of input, and of more than all of it
+		for _, prefix := range []string{"10000", "1000000"} {
+			if out, err := exec.Command(testbin, "-mode", "auto", "-in", i, "-out", a, "-prefix", prefix).CombinedOutput(); err != nil {
+				t.Fatal(err, string(out))
+			}
+			if fb, _ := os.ReadFile(a); !bytes.Equal(fe, fb) {
+				t.Errorf("prefix %s: auto is different from cache", prefix)
+			}
+		}
+	})
+
+	t.Run("auto picks raw for noise", func(t *testing.T) {
+		r := rand.New(rand.NewPCG(1, 2))
+		data := make([]byte, 40000)
+		for i := range data {
+			data[i] = byte(r.IntN(256))
+		}
+		header := wav.NewWAVHeader(19531, 1)
+		header.SetDataSize(uint64(len(data)))
+		var b bytes.Buffer
+		header.MarshalBinary(&b)
+		b.Write(data)
+
+		encoded := roundtripCLI(t, testbin, b.Bytes(), "-codec", "cache")
+		dir := t.TempDir()
+		i, a := path.Join(dir, "in"), path.Join(dir, "auto")
+		os.WriteFile(i, b.Bytes(), 0644)
+		if out, err := exec.Command(testbin, "-mode", "auto", "-in", i, "-out", a).CombinedOutput(); err != nil {
+			t.Fatal(err, string(out))
+		}
+		auto, _ := os.ReadFile(a)
+		if !container.IsContainer(auto) || len(auto) >= len(encoded) {
+			t.Errorf("auto(%d bytes) is not smaller than cache(%d bytes)", len(auto), len(encoded))
+		}
+
+		d := path.Join(dir, "decoded")
+		if out, err := exec.Command(testbin, "-mode", "decode", "-in", a, "-out", d).CombinedOutput(); err != nil {
+			t.Fatal(err, string(out))
+		}
+		if decoded, _ := os.ReadFile(d); !bytes.Equal(decoded, b.Bytes()) {
+			t.Error("files are different")
+		}
+	})
+}
+
+func TestCLIEncoder_Split(t *testing.T) {
+	testbin := buildCLI(t)
+
+	fa, _ := os.ReadFile(path.Join("testdata", "0052503c-2849-4f41-ab51-db382103690c.wav"))
+	fa = append(fa, []byte("LIST\x04\x00\x00\x00INFO")...)
+
+	plain := roundtripCLI(t, testbin, fa)
+	for _, backend := range []string{"none", "flate", "huffman", "best"} {
+		t.Run(backend, func(t *testing.T) {
+			encoded := roundtripCLI(t, testbin, fa, "-split", backend)
+			if !container.IsContainer(encoded) {
+				t.Error("expected container")
+			}
+			if backend == "best" && len(encoded) >= len(plain) {
+				t.Errorf("split(%d) >= cache(%d)", len(encoded), len(plain))
+			}
+		})
+	}
+}
+
+func TestCLIStream(t *testing.T) {
+	testbin := buildCLI(t)
+
+	fa, _ := os.ReadFile(path.Join("testdata", "0052503c-2849-4f41-ab51-db382103690c.wav"))
+
+	for _, args := range [][]string{{"-latency", "100"}, {"-latency-time", "10ms", "-codec", "adaptive"}, {"-latency", "100", "-codec", "raw"}} {
+		t.Run(strings.Join(args, " "), func(t *testing.T) {
+			encoder := exec.Command(testbin, append([]string{"-mode", "stream"}, args...)...)
+			decoder := exec.Command(testbin, "-mode", "decode", "-stream")
+			in, _ := encoder.StdinPipe()
+			decoder.Stdin, _ = encoder.StdoutPipe()
+			out, _ := decoder.StdoutPipe()
+			if err := encoder.Start(); err != nil {
+				t.Fatal(err)
+			}
+			if err := decoder.Start(); err != nil {
+				t.Fatal(err)
+			}
+
+			// first samples are decoded while input is still open
+			in.Write(fa[:44+2*1000])
+			first := make([]byte, 44+2*900)
+			done := make(chan error, 1)
+			go func() {
+				_, err := io.ReadFull(out, first)
+				done <- err
+			}()
+			select {
+			case err := <-done:
+				if err != nil {
+					t.Fatal(err)
+				}
+			case <-time.After(10 * time.Second):
+				t.Fatal("no samples decoded before end of input")
+			}
+
+			var rest []byte
+			go func() {
+				var err error
+				rest, err = io.ReadAll(out)
+				done <- err
+			}()
+			in.Write(fa[44+2*1000:])
+			in.Close()
+			if err := <-done; err != nil {
+				t.Fatal(err)
+			}
+			if err := encoder.Wait(); err != nil {
+				t.Fatal(err)
+			}
+			if err := decoder.Wait(); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(append(first, rest...), fa) {
+				t.Error("files are different")
+			}
+		})
+	}
+}
+
+func TestCLIPackets(t *testing.T) {
+	testbin := buildCLI(t)
+
+	fa, _ := os.ReadFile(path.Join("testdata", "0052503c-2849-4f41-ab51-db382103690c.wav"))
+	const mtu, keyframe = 200, 5000
+
+	dir := t.TempDir()
+	p, d := path.Join(dir, "packets"), path.Join(dir, "decoded.wav")
+	if out, err := exec.Command(testbin, "-mode", "packets", "-in", path.Join("testdata", "0052503c-2849-4f41-ab51-db382103690c.wav"), "-out", p, "-mtu", strconv.Itoa(mtu), "-keyframe", strconv.Itoa(keyframe)).CombinedOutput(); err != nil {
+		t.Fatal(err, string(out))
+	}
+	encoded, _ := os.ReadFile(p)
+
+	var header container.Header
+	if err := header.UnmarshalBinary(bytes.NewReader(encoded)); err != nil {
+		t.Fatal(err)
+	}
+	if (len(encoded)-header.Size())%mtu != 0 {
+		t.Fatalf("packets of %d bytes are not of mtu %d", len(encoded)-header.Size(), mtu)
+	}
+
+	// drop two packets in middle of stream
+	lost := header.Size() + 100*mtu
+	dropped := slices.Concat(encoded[:lost], encoded[lost+2*mtu:])
+	os.WriteFile(p, dropped, 0644)
+
+	out, err := exec.Command(testbin, "-mode", "decode", "-in", p, "-out", d).CombinedOutput()
+	if err != nil {
+		t.Fatal(err, string(out))
+	}
+	if !strings.Contains(string(out), "gap") {
+		t.Error("no gap reported")
+	}
+
+	fb, _ := os.ReadFile(d)
+	if len(fb) != len(fa) {
+		t.Fatalf("decoded(%d) != %d", len(fb), len(fa))
+	}
+	// samples are either as they were or zero up to next keyframe
+	numLost := 0
+	for i := 44; i < len(fa); i += 2 {
+		if fa[i] == fb[i] && fa[i+1] == fb[i+1] {
+			continue
+		}
+		if fb[i] != 0 || fb[i+1] != 0 {
+			t.Fatalf("sample %d is wrong", (i-44)/2)
+		}
+		numLost++
+	}
+	if numLost == 0 || numLost > 2*keyframe {
+		t.Errorf("lost %d samples", numLost)
+	}
+
+	// drop last packet, its samples are zeros up to size of input
+	os.WriteFile(p, encoded[:len(encoded)-mtu], 0644)
+	out, err = exec.Command(testbin, "-mode", "decode", "-in", p, "-out", d).CombinedOutput()
+	if err != nil {
+		t.Fatal(err, string(out))
+	}
+	if !strings.Contains(string(out), "tail=true") {
+		t.Error("no gap of tail reported")
+	}
+	if fb, _ := os.ReadFile(d); len(fb) != len(fa) || !bytes.Equal(fb[len(fb)-2:], []byte{0, 0}) {
+		t.Errorf("decoded(%d) != %d", len(fb), len(fa))
+	}
+
+	// corrupted sample of last packet is not gap of billions of samples
+	corrupted := slices.Clone(encoded)
+	binary.LittleEndian.PutUint32(corrupted[len(corrupted)-mtu+8:], 0xFFFFFF00)
+	os.WriteFile(p, corrupted, 0644)
+	out, err = exec.Command(testbin, "-mode", "decode", "-in", p, "-out", d).CombinedOutput()
+	if err == nil || !strings.Contains(string(out), "after last sample") {
+		t.Errorf("expected error of sample of packet: %s", out)
+	}
+}
+
+func TestCLIEncoder_Rate(t *testing.T) {
+	testbin := buildCLI(t)
+
+	in := path.Join("testdata", "ff970660-0ffd-461f-93de-379e95cd784a.wav")
+	fa, _ := os.ReadFile(in)
+	lossless := roundtripCLI(t, testbin, fa)
+
+	// lossless output can not be adapted
+	if out, err := exec.Command(testbin, "-in", in, "-out", path.Join(t.TempDir(), "encoded"), "-rate", "50000").CombinedOutput(); err == nil || !strings.Contains(string(out), "requires max error") {
+		t.Errorf("expected error of rate without max error: %s", out)
+	}
+
+	for _, maxError := range []int{64, 200} {
+		t.Run(strconv.Itoa(maxError), func(t *testing.T) {
+			dir := t.TempDir()
+			e, d := path.Join(dir, "encoded"), path.Join(dir, "decoded.wav")
+			out, err := exec.Command(testbin, "-in", in, "-out", e, "-rate", "50000", "-max-error", strconv.Itoa(maxError)).CombinedOutput()
+			if err != nil {
+				t.Fatal(err, string(out))
+			}
+			if !strings.Contains(string(out), "NumWindowsOverBudget") {
+				t.Error("no stats of rate")
+			}
+			if out, err := exec.Command(testbin, "-mode", "decode", "-in", e, "-out", d).CombinedOutput(); err != nil {
+				t.Fatal(err, string(out))
+			}
+
+			fb, _ := os.ReadFile(d)
+			if len(fb) != len(fa) || !bytes.Equal(fa[:44], fb[:44]) {
+				t.Fatal("wrong decoded file")
+			}
+			for i := 44; i < len(fa); i += 2 {
+				a, b := int16(binary.LittleEndian.Uint16(fa[i:])), int16(binary.LittleEndian.Uint16(fb[i:]))
+				if d := int(a) - int(b); d < -maxError || d > maxError {
+					t.Fatalf("sample %d: error(%d) > %d", (i-44)/2, d, maxError)
+				}
+			}
+
+			encoded, _ := os.ReadFile(e)
+			if len(encoded) >= len(lossless) {
+				t.Errorf("encoded(%d) >= lossless(%d)", len(encoded), len(lossless))
+			}
+		})
+	}
+}
+
+func TestCLIEncoder_MaxError(t *testing.T) {
+	testbin := buildCLI(t)
+
+	in := path.Join("testdata", "ff970660-0ffd-461f-93de-379e95cd784a.wav")
+	fa, _ := os.ReadFile(in)
+	lossless := roundtripCLI(t, testbin, fa, "-codec", "adaptive")
+
+	for _, args := range [][]string{{"-codec", "cache"}, {"-codec", "adaptive"}, {"-codec", "adaptive", "-keyframe", "10000"}} {
+		t.Run(strings.Join(args, " "), func(t *testing.T) {
+			e := path.Join(t.TempDir(), "encoded")
+			if out, err := exec.Command(testbin, append([]string{"-in", in, "-out", e, "-max-error", "64"}, args...)...).CombinedOutput(); err != nil {
+				t.Fatal(err, string(out))
+			}
+			encoded, _ := os.ReadFile(e)
+			if len(encoded) >= len(lossless) {
+				t.Errorf("encoded(%d) >= lossless(%d)", len(encoded), len(lossless))
+			}
+
+			// bound is of stream
+			out, err := exec.Command(testbin, "-mode", "verify", "-in", e, "-original", in).Output()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.Contains(string(out), "bound 64") {
+				t.Error(string(out))
+			}
+
+			if err := exec.Command(testbin, "-mode", "verify", "-in", e, "-original", in, "-max-error", "1").Run(); err == nil {
+				t.Error("expected error over max error")
+			}
+		})
+	}
+}
+
+func TestCLIEncoder_MaxErrorFormats(t *testing.T) {
+	testbin := buildCLI(t)
+	dir := t.TempDir()
+
+	// words of uint16 and int32 are not values that are bound by max error
+	for _, descr := range []string{"<u2", "<i4", "<i2"} {
+		header := npy.Header{Descr: descr, Shape: []int{3000}}
+		var b bytes.Buffer
+		w := npy.NewWriter(header, &b)
+		w.WriteHeader()
+		values := make([]int32, 3000)
+		for i := range values {
+			values[i] = int32(i % 7)
+		}
+		if err := w.WriteChannels([][]int32{values}); err != nil {
+			t.Fatal(err)
+		}
+		in, e := path.Join(dir, "in.npy"), path.Join(dir, "encoded")
+		os.WriteFile(in, b.Bytes(), 0644)
+
+		for _, args := range [][]string{{"-max-error", "1"}, {"-max-error", "2", "-rate", "1000"}, {"-max-error", "2", "-spike-threshold", "4"}} {
+			// rate of <i2 fails for other reason, as npy has no sample rate
+			out, err := exec.Command(testbin, append([]string{"-format", "npy", "-in", in, "-out", e}, args...)...).CombinedOutput()
+			if rejected := err != nil && strings.Contains(string(out), "signed 16 bit"); rejected != (descr != "<i2") {
+				t.Errorf("%s %v: rejected(%v) of type: %s", descr, args, rejected, out)
+			}
+		}
+
+		// verifier compares words as signed 16 bit values too
+		if out, err := exec.Command(testbin, "-format", "npy", "-in", in, "-out", e).CombinedOutput(); err != nil {
+			t.Fatal(err, string(out))
+		}
+		out, err := exec.Command(testbin, "-mode", "verify", "-format", "npy", "-in", e, "-original", in, "-max-error", "1").CombinedOutput()
+		if descr == "<i2" && err != nil {
+			t.Errorf("%s: %v %s", descr, err, out)
+		}
+		if descr != "<i2" && (err == nil || !strings.Contains(string(out), "signed 16 bit")) {
+			t.Errorf("%s: expected error of verify: %s", descr, out)
+		}
+	}
+}
+
+func TestCLIEncoder_Spikes(t *testing.T) {
+	testbin := buildCLI(t)
+
+	in := path.Join("testdata", "ff970660-0ffd-461f-93de-379e95cd784a.wav")
+	fa, _ := os.ReadFile(in)
+
+	dir := t.TempDir()
+	e, d := path.Join(dir, "encoded"), path.Join(dir, "decoded.wav")
+	out, err := exec.Command(testbin, "-in", in, "-out", e, "-codec", "adaptive", "-max-error", "128", "-spike-threshold", "4").CombinedOutput()
+	if err != nil {
+		t.Fatal(err, string(out))
+	}
+	for _, segment := range []string{"segment=spike", "segment=baseline", "extra_markers="} {
+		if !strings.Contains(string(out), segment) {
+			t.Errorf("no distortion of %s", segment)
+		}
+	}
+
+	// windows of interleaved channels would be mixed
+	raw := path.Join(dir, "raw")
+	os.WriteFile(raw, fa[44:], 0644)
+	if out, err := exec.Command(testbin, "-format", "raw", "-channels", "2", "-in", raw, "-out", path.Join(dir, "stereo"), "-max-error", "128", "-spike-threshold", "4").CombinedOutput(); err == nil || !strings.Contains(string(out), "single channel") {
+		t.Errorf("expected error of channels: %s", out)
+	}
+	if out, err := exec.Command(testbin, "-mode", "decode", "-in", e, "-out", d).CombinedOutput(); err != nil {
+		t.Fatal(err, string(out))
+	}
+
+	encoded, _ := os.ReadFile(e)
+	var header container.Header
+	if err := header.UnmarshalBinary(bytes.NewReader(encoded)); err != nil {
+		t.Fatal(err)
+	}
+	data, ok := header.Section(container.SectionSpikes)
+	if !ok {
+		t.Fatal("no spikes")
+	}
+	windows, err := spike.ParseWindows(data)
+	if err != nil || len(windows) == 0 {
+		t.Fatal(windows, err)
+	}
+
+	fb, _ := os.ReadFile(d)
+	if len(fb) != len(fa) {
+		t.Fatalf("decoded(%d) != %d", len(fb), len(fa))
+	}
+	sample := func(b []byte, i int) int { return int(int16(binary.LittleEndian.Uint16(b[44+2*i:]))) }
+	for _, w := range windows {
+		for i := w.Start; i < w.End(); i++ {
+			if sample(fa, i) != sample(fb, i) {
+				t.Fatalf("sample %d of spike is not lossless", i)
+			}
+		}
+	}
+	for i := range (len(fa) - 44) / 2 {
+		if d := sample(fa, i) - sample(fb, i); d < -128 || d > 128 {
+			t.Fatalf("sample %d: error(%d) > 128", i, d)
+		}
+	}
+	if len(encoded) >= len(fa)/3 {
+		t.Errorf("encoded(%d) is not smaller than third of input(%d)", len(encoded), len(fa))
+	}
+}
+
+func TestCLISpikes(t *testing.T) {
+	testbin := buildCLI(t)
+
+	in := path.Join("testdata", "ff970660-0ffd-461f-93de-379e95cd784a.wav")
+	dir := t.TempDir()
+
+	e, c := path.Join(dir, "encoded"), path.Join(dir, "container")
+	if out, err := exec.Command(testbin, "-in", in, "-out", e).CombinedOutput(); err != nil {
+		t.Fatal(err, string(out))
+	}
+	if out, err := exec.Command(testbin, "-in", in, "-out", c, "-split", "best").CombinedOutput(); err != nil {
+		t.Fatal(err, string(out))
+	}
+
+	spikes := func(args ...string) []byte {
+		out, err := exec.Command(testbin, append([]string{"-mode", "spikes"}, args...)...).Output()
+		if err != nil {
+			t.Fatal(err, args)
+		}
+		return out
+	}
+
+	exp := spikes("-in", in)
+	rows, err := csv.NewReader(bytes.NewReader(exp)).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) < 2 || !slices.Equal(rows[0], []string{"sample", "time", "peak", "amplitude", "waveform"}) {
+		t.Fatal(rows)
+	}
+	if n := len(strings.Fields(rows[1][4])); n != 16+32+1 {
+		t.Errorf("waveform(%d) != %d", n, 16+32+1)
+	}
+
+	if got := spikes("-in", e, "-encoded"); !bytes.Equal(got, exp) {
+		t.Errorf("spikes of encoded stream are different from spikes of input")
+	}
+	if got := spikes("-in", c); !bytes.Equal(got, exp) {
+		t.Errorf("spikes of container are different from spikes of input")
+	}
+
+	var events struct {
+		SampleRate float64       `json:"sample_rate"`
+		Events     []spike.Event `json:"events"`
+	}
+	if err := json.Unmarshal(spikes("-in", c, "-events", "json"), &events); err != nil {
+		t.Fatal(err)
+	}
+	if len(events.Events) != len(rows)-1 || events.SampleRate != 19531 {
+		t.Errorf("events(%d) sample rate(%v)", len(events.Events), events.SampleRate)
+	}
+
+	// layout of encoded input of other formats is by its metadata
+	fa, _ := os.ReadFile(in)
+	raw, stereo := path.Join(dir, "raw"), path.Join(dir, "stereo")
+	os.WriteFile(raw, fa[44:], 0644)
+	if out, err := exec.Command(testbin, "-format", "raw", "-channels", "2", "-in", raw, "-out", stereo).CombinedOutput(); err != nil {
+		t.Fatal(err, string(out))
+	}
+	out, err := exec.Command(testbin, "-mode", "spikes", "-in", stereo).CombinedOutput()
+	if err == nil || !strings.Contains(string(out), "single channel") {
+		t.Errorf("expected error of channels: %s", out)
+	}
+}
+
+func TestCLIAnalyze(t *testing.T) {
+	testbin := buildCLI(t)
+
+	in := path.Join("testdata", "ff970660-0ffd-461f-93de-379e95cd784a.wav")
+	out, err := exec.Command(testbin, "-mode", "analyze", "-in", in).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{"entropy order 2", "cache ranks", "runs of cache hits", "ideal"} {
+		if !strings.Contains(string(out), s) {
+			t.Errorf("no %s in %s", s, out)
+		}
+	}
+
+	out, err = exec.Command(testbin, "-mode", "analyze", "-json", "-in", in).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stats struct {
+		NumSamples  int
+		EncodedSize int
+		IdealSize   int
+	}
+	if err := json.Unmarshal(out, &stats); err != nil {
+		t.Fatal(err)
+	}
+	if stats.NumSamples != 98689 || stats.IdealSize == 0 || stats.IdealSize >= stats.EncodedSize {
+		t.Errorf("stats(%+v)", stats)
+	}
+
+	// entropy of orders longer than input is zero
+	header := wav.NewWAVHeader(19531, 1)
+	header.SetDataSize(2)
+	var b bytes.Buffer
+	header.MarshalBinary(&b)
+	b.Write([]byte{0x34, 0x12})
+	single := path.Join(t.TempDir(), "single.wav")
+	os.WriteFile(single, b.Bytes(), 0644)
+
+	out, err = exec.Command(testbin, "-mode", "analyze", "-in", single).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(out), "NaN") || !strings.Contains(string(out), "entropy order 2: 0.000 bits") {
+		t.Errorf("entropy of single sample: %s", out)
+	}
+	out, err = exec.Command(testbin, "-mode", "analyze", "-json", "-in", single).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(out, &stats); err != nil || stats.NumSamples != 1 {
+		t.Errorf("stats(%+v) %v", stats, err)
+	}
+}
+
+func TestCLICompare(t *testing.T) {
+	testbin := buildCLI(t)
+
+	c := path.Join(t.TempDir(), "compare.csv")
+	table, err := exec.Command(testbin, "-mode", "compare", "-in", path.Join("testdata", "ff970660-0ffd-461f-93de-379e95cd784a.wav"), "-csv", c).Output()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, _ := os.Open(c)
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	methods := map[string]bool{}
+	for _, row := range rows[1:] {
+		if row[0] == "total" {
+			methods[row[1]] = true
+		}
+	}
+	for _, method := range []string{"cache", "adaptive", "flate-huffman", "flate-9", "gzip-1", "zlib-5", "lzw-msb", "cache+flate-9", "cache+lzw-lsb"} {
+		if !methods[method] {
+			t.Errorf("no %s", method)
+		}
+	}
+	if len(rows) != 1+2*len(methods) {
+		t.Errorf("rows(%d) != %d", len(rows), 1+2*len(methods))
+	}
+	if lines := strings.Split(strings.TrimSpace(string(table)), "\n"); len(lines) != len(rows) {
+		t.Errorf("table of %d lines, CSV of %d rows", len(lines), len(rows))
+	}
+}
@@ -0,0 +1,432 @@
+// Package npy reads and writes NumPy .npy arrays of int16, uint16 and int32.
+// https://numpy.org/doc/stable/reference/generated/numpy.lib.format.html
+package npy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+var Magic = [6]byte{0x93, 'N', 'U', 'M', 'P', 'Y'}
+
+const headerAlign = 64
+
+var (
+	descrRe        = regexp.MustCompile(`['"]descr['"]\s*:\s*['"]([^'"]*)['"]`)
+	fortranOrderRe = regexp.MustCompile(`['"]fortran_order['"]\s*:\s*(True|False)`)
+	shapeRe        = regexp.MustCompile(`['"]shape['"]\s*:\s*\(([^)]*)\)`)
+)
+
+// Header of array, arrays of 1 dimension are single channel, arrays of 2 dimensions are [samples x channels].
+type Header struct {
+	Major        uint8
+	Minor        uint8
+	Descr        string
+	FortranOrder bool
+	Shape        []int
+}
+
+// ByteOrder from type description, single byte types and native order are little endian.
+func (s Header) ByteOrder() binary.ByteOrder {
+	if strings.HasPrefix(s.Descr, ">") {
+		return binary.BigEndian
+	}
+	return binary.LittleEndian
+}
+
+// Kind is type description without byte order, such as i2.
+func (s Header) Kind() string { return strings.TrimLeft(s.Descr, "<>|=") }
+
+// ItemSize is number of bytes in single value.
+func (s Header) ItemSize() int {
+	switch s.Kind() {
+	case "i2", "u2":
+		return 2
+	case "i4":
+		return 4
+	default:
+		return 0
+	}
+}
+
+func (s Header) NumSamples() int {
+	if len(s.Shape) == 0 {
+		return 1
+	}
+	return s.Shape[0]
+}
+
+func (s Header) NumChannels() int {
+	if len(s.Shape) < 2 {
+		return 1
+	}
+	return s.Shape[1]
+}
+
+func (s Header) NumValues() int {
+	n := 1
+	for _, v := range s.Shape {
+		n *= v
+	}
+	return n
+}
+
+// DataSize is size of array data in bytes.
+func (s Header) DataSize() int64 { return int64(s.NumValues()) * int64(s.ItemSize()) }
+
+func (s Header) Validate() error {
+	if s.ItemSize() == 0 {
+		return fmt.Errorf("unsupported type(%s), expected int16, uint16, int32", s.Descr)
+	}
+	if len(s.Shape) > 2 {
+		return fmt.Errorf("unsupported shape(%v), expected 1 or 2 dimensions", s.Shape)
+	}
+	for _, v := range s.Shape {
+		if v < 0 {
+			return fmt.Errorf("invalid shape(%v)", s.Shape)
+		}
+	}
+	// size of data fits into int64, unless array is empty
+	if !slices.Contains(s.Shape, 0) {
+		n := int64(s.ItemSize())
+		for _, v := range s.Shape {
+			if n > math.MaxInt64/int64(v) {
+				return fmt.Errorf("shape(%v) is too large", s.Shape)
+			}
+			n *= int64(v)
+		}
+	}
+	return nil
+}
+
+func (s Header) dict() string {
+	shape := make([]string, len(s.Shape))
+	for i, v := range s.Shape {
+		shape[i] = strconv.Itoa(v)
+	}
+	if len(shape) == 1 {
+		shape = append(shape, "")
+	}
+
+	fortranOrder := "False"
+	if s.FortranOrder {
+		fortranOrder = "True"
+	}
+
+	return fmt.Sprintf("{'descr': '%s', 'fortran_order': %s, 'shape': (%s), }", s.Descr, fortranOrder, strings.Join(shape, ", "))
+}
+
+func (s *Header) MarshalBinary(w io.Writer) error {
+	major := s.Major
+	if major == 0 {
+		major = 1
+	}
+
+	dict := s.dict()
+	prefixSize := len(Magic) + 2 + 2
+	if major > 1 {
+		prefixSize += 2
+	}
+	if major == 1 && prefixSize+len(dict)+1 > 1<<16 {
+		major, prefixSize = 2, prefixSize+2
+	}
+	padding := (headerAlign - (prefixSize+len(dict)+1)%headerAlign) % headerAlign
+	dict += strings.Repeat(" ", padding) + "\n"
+
+	var b bytes.Buffer
+	b.Write(Magic[:])
+	b.Write([]byte{major, s.Minor})
+	if major == 1 {
+		binary.Write(&b, binary.LittleEndian, uint16(len(dict)))
+	} else {
+		binary.Write(&b, binary.LittleEndian, uint32(len(dict)))
+	}
+	b.WriteString(dict)
+
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+func (s *Header) UnmarshalBinary(r io.Reader) error {
+	var magic [6]byte
+	if _, err := io.ReadFull(r, magic[:]); err != nil {
+		return err
+	}
+	if magic != Magic {
+		return errors.New("invalid magic, not npy")
+	}
+
+	var version [2]byte
+	if _, err := io.ReadFull(r, version[:]); err != nil {
+		return err
+	}
+	s.Major, s.Minor = version[0], version[1]
+
+	var size uint32
+	switch s.Major {
+	case 1:
+		var v uint16
+		if err := binary.Read(r, binary.LittleEndian, &v); err != nil {
+			return err
+		}
+		size = uint32(v)
+	case 2, 3:
+		if err := binary.Read(r, binary.LittleEndian, &size); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported version %d.%d", s.Major, s.Minor)
+	}
+
+	// size is not trusted, so buffer grows only as header is read
+	var b bytes.Buffer
+	if _, err := io.CopyN(&b, r, int64(size)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	dict := b.Bytes()
+
+	m := descrRe.FindSubmatch(dict)
+	if m == nil {
+		return errors.New("missing descr")
+	}
+	s.Descr = string(m[1])
+
+	m = fortranOrderRe.FindSubmatch(dict)
+	if m == nil {
+		return errors.New("missing fortran_order")
+	}
+	s.FortranOrder = string(m[1]) == "True"
+
+	m = shapeRe.FindSubmatch(dict)
+	if m == nil {
+		return errors.New("missing shape")
+	}
+	s.Shape = nil
+	for _, q := range strings.Split(string(m[1]), ",") {
+		if q = strings.TrimSpace(q); q == "" {
+			continue
+		}
+		v, err := strconv.Atoi(q)
+		if err != nil {
+			return fmt.Errorf("invalid shape: %w", err)
+		}
+		s.Shape = append(s.Shape, v)
+	}
+
+	return s.Validate()
+}
+
+// Reader reads array values as 16 bit words in order of file, int32 value is low word then high word.
+// Reading stops at end of array data, bytes after it are available in Trailer.
+type Reader struct {
+	Header    Header
+	r         io.Reader
+	rawHeader []byte
+	remaining int64
+	buf       []byte
+}
+
+func NewReader(r io.Reader) *Reader { return &Reader{r: r} }
+
+func (s *Reader) ReadHeader() error {
+	var b bytes.Buffer
+	if err := s.Header.UnmarshalBinary(io.TeeReader(s.r, &b)); err != nil {
+		return err
+	}
+	s.rawHeader = b.Bytes()
+	s.remaining = s.Header.DataSize()
+	return nil
+}
+
+// RawHeader is header bytes as they were read, including magic.
+func (s *Reader) RawHeader() []byte { return s.rawHeader }
+
+// Trailer is everything after array data.
+// It is valid only after all samples have been read.
+func (s *Reader) Trailer() io.Reader { return s.r }
+
+// ReadSamples reads up to len(p) words.
+func (s *Reader) ReadSamples(p []uint16) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if s.remaining == 0 {
+		return 0, io.EOF
+	}
+
+	n := int64(len(p)) * 2
+	if n > s.remaining {
+		n = s.remaining
+	}
+	// whole values only
+	n -= n % int64(s.Header.ItemSize())
+	if n == 0 {
+		n = int64(s.Header.ItemSize())
+		if n/2 > int64(len(p)) {
+			return 0, io.ErrShortBuffer
+		}
+	}
+
+	if int64(cap(s.buf)) < n {
+		s.buf = make([]byte, n)
+	}
+	b := s.buf[:n]
+
+	k, err := io.ReadFull(s.r, b)
+	s.remaining -= int64(k)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+
+	order := s.Header.ByteOrder()
+	size := s.Header.ItemSize()
+	numValues := k / size
+	for i := range numValues {
+		switch size {
+		case 2:
+			p[i] = order.Uint16(b[i*size:])
+		case 4:
+			v := order.Uint32(b[i*size:])
+			p[2*i], p[2*i+1] = uint16(v), uint16(v>>16)
+		}
+	}
+	return numValues * size / 2, err
+}
+
+// ReadChannels reads all values as [channels][samples].
+func (s *Reader) ReadChannels() ([][]int32, error) {
+	numSamples, numChannels := s.Header.NumSamples(), s.Header.NumChannels()
+
+	words := make([]uint16, s.remaining/2)
+	for n := 0; n < len(words); {
+		k, err := s.ReadSamples(words[n:])
+		n += k
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	values := s.Header.wordsToValues(words)
+
+	channels := make([][]int32, numChannels)
+	for c := range channels {
+		channels[c] = make([]int32, numSamples)
+		for i := range numSamples {
+			channels[c][i] = values[s.Header.index(i, c)]
+		}
+	}
+	return channels, nil
+}
+
+// index of value of sample and channel in file.
+func (s Header) index(sample, channel int) int {
+	if s.FortranOrder {
+		return channel*s.NumSamples() + sample
+	}
+	return sample*s.NumChannels() + channel
+}
+
+func (s Header) wordsToValues(words []uint16) []int32 {
+	switch s.Kind() {
+	case "i2":
+		values := make([]int32, len(words))
+		for i, v := range words {
+			values[i] = int32(int16(v))
+		}
+		return values
+	case "u2":
+		values := make([]int32, len(words))
+		for i, v := range words {
+			values[i] = int32(v)
+		}
+		return values
+	default:
+		values := make([]int32, len(words)/2)
+		for i := range values {
+			values[i] = int32(uint32(words[2*i]) | uint32(words[2*i+1])<<16)
+		}
+		return values
+	}
+}
+
+type Writer struct {
+	Header  Header
+	w       io.Writer
+	buf     []byte
+	pending []uint16 // low word of int32 value, which high word is not written yet
+}
+
+func NewWriter(header Header, w io.Writer) *Writer { return &Writer{Header: header, w: w} }
+
+func (s *Writer) WriteHeader() error { return s.Header.MarshalBinary(s.w) }
+
+// WriteSamples writes 16 bit words in order of file, int32 value is low word then high word.
+func (s *Writer) WriteSamples(p []uint16) error {
+	size := s.Header.ItemSize()
+
+	if len(s.pending) > 0 {
+		p = append(s.pending, p...)
+		s.pending = nil
+	}
+	if k := (len(p) * 2) % size; k != 0 {
+		s.pending = slices.Clone(p[len(p)-k/2:])
+		p = p[:len(p)-k/2]
+	}
+
+	if cap(s.buf) < len(p)*2 {
+		s.buf = make([]byte, len(p)*2)
+	}
+	b := s.buf[:len(p)*2]
+
+	order := s.Header.ByteOrder()
+	for i := range len(b) / size {
+		switch size {
+		case 2:
+			order.PutUint16(b[i*size:], p[i])
+		case 4:
+			order.PutUint32(b[i*size:], uint32(p[2*i])|uint32(p[2*i+1])<<16)
+		}
+	}
+
+	_, err := s.w.Write(b)
+	return err
+}
+
+// WriteChannels writes values given as [channels][samples].
+func (s *Writer) WriteChannels(channels [][]int32) error {
+	numSamples, numChannels := s.Header.NumSamples(), s.Header.NumChannels()
+	if len(channels) != numChannels {
+		return fmt.Errorf("number of channels(%d) does not match shape(%v)", len(channels), s.Header.Shape)
+	}
+
+	values := make([]int32, numSamples*numChannels)
+	for c, vs := range channels {
+		if len(vs) != numSamples {
+			return fmt.Errorf("number of samples(%d) does not match shape(%v)", len(vs), s.Header.Shape)
+		}
+		for i, v := range vs {
+			values[s.Header.index(i, c)] = v
+		}
+	}
+
+	words := make([]uint16, 0, len(values)*s.Header.ItemSize()/2)
+	for _, v := range values {
+		if s.Header.ItemSize() == 4 {
+			words = append(words, uint16(v), uint16(uint32(v)>>16))
+		} else {
+			words = append(words, uint16(v))
+		}
+	}
+	return s.WriteSamples(words)
+}
@@ -0,0 +1,173 @@
+package npy_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/npy"
+)
+
+// numpy.save of numpy.array([[1, -2], [3, 4], [5, 6]], dtype=numpy.int16)
+func numpyInt16() []byte {
+	dict := "{'descr': '<i2', 'fortran_order': False, 'shape': (3, 2), }"
+	dict += strings.Repeat(" ", 128-10-len(dict)-1) + "\n"
+
+	var b bytes.Buffer
+	b.Write([]byte("\x93NUMPY\x01\x00"))
+	binary.Write(&b, binary.LittleEndian, uint16(len(dict)))
+	b.WriteString(dict)
+	binary.Write(&b, binary.LittleEndian, []int16{1, -2, 3, 4, 5, 6})
+	return b.Bytes()
+}
+
+func TestReader(t *testing.T) {
+	r := npy.NewReader(bytes.NewReader(numpyInt16()))
+	if err := r.ReadHeader(); err != nil {
+		t.Fatal(err)
+	}
+
+	if r.Header.Descr != "<i2" || r.Header.FortranOrder || !slices.Equal(r.Header.Shape, []int{3, 2}) {
+		t.Errorf("wrong header %#v", r.Header)
+	}
+
+	channels, err := r.ReadChannels()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(channels[0], []int32{1, 3, 5}) || !slices.Equal(channels[1], []int32{-2, 4, 6}) {
+		t.Errorf("wrong channels %v", channels)
+	}
+}
+
+func TestHeader_MarshalBinary(t *testing.T) {
+	header := npy.Header{Descr: "<i2", Shape: []int{3, 2}}
+
+	var b bytes.Buffer
+	if err := header.MarshalBinary(&b); err != nil {
+		t.Fatal(err)
+	}
+
+	if exp := numpyInt16()[:128]; !bytes.Equal(exp, b.Bytes()) {
+		t.Errorf("exp(%q) != got(%q)", exp, b.Bytes())
+	}
+}
+
+func TestHeader_HugeShape(t *testing.T) {
+	for _, shape := range [][]int{{1 << 62}, {1 << 31, 1 << 31}, {4611686018427387905}} {
+		header := npy.Header{Descr: "<i4", Shape: shape}
+
+		var b bytes.Buffer
+		header.MarshalBinary(&b)
+		if err := npy.NewReader(&b).ReadHeader(); err == nil {
+			t.Errorf("shape %v: expected error", shape)
+		}
+	}
+
+	header := npy.Header{Descr: "<i2", Shape: []int{0, 1 << 62}}
+	if err := header.Validate(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestHeader_HugeDict(t *testing.T) {
+	b := []byte("\x93NUMPY\x02\x00")
+	b = binary.LittleEndian.AppendUint32(b, 0xFFFFFFFF)
+	b = append(b, "{'de"...)
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	var header npy.Header
+	err := header.UnmarshalBinary(bytes.NewReader(b))
+	runtime.ReadMemStats(&after)
+
+	if err != io.ErrUnexpectedEOF {
+		t.Errorf("expected unexpected EOF, got %v", err)
+	}
+	if n := after.TotalAlloc - before.TotalAlloc; n > 1<<20 {
+		t.Errorf("allocated %d bytes for header of 4 bytes", n)
+	}
+}
+
+func TestReaderWriter(t *testing.T) {
+	tests := []npy.Header{
+		{Descr: "<i2", Shape: []int{5}},
+		{Descr: ">u2", Shape: []int{3, 2}},
+		{Descr: "<i4", Shape: []int{3, 2}, FortranOrder: true},
+		{Descr: ">i4", Shape: []int{2, 3}, Major: 2},
+	}
+	for _, header := range tests {
+		t.Run(header.Descr, func(t *testing.T) {
+			channels := make([][]int32, header.NumChannels())
+			for c := range channels {
+				for i := range header.NumSamples() {
+					v := int32(c*100 + i)
+					if header.Kind() != "u2" {
+						v = -v
+					}
+					if header.Kind() == "i4" {
+						v *= 100000
+					}
+					channels[c] = append(channels[c], v)
+				}
+			}
+
+			var b bytes.Buffer
+			w := npy.NewWriter(header, &b)
+			if err := w.WriteHeader(); err != nil {
+				t.Fatal(err)
+			}
+			if err := w.WriteChannels(channels); err != nil {
+				t.Fatal(err)
+			}
+			if (int64(b.Len())-header.DataSize())%64 != 0 {
+				t.Errorf("header is not aligned: %d", b.Len())
+			}
+			encoded := bytes.Clone(b.Bytes())
+
+			r := npy.NewReader(&b)
+			if err := r.ReadHeader(); err != nil {
+				t.Fatal(err)
+			}
+
+			// words are read as they are in file
+			words := make([]uint16, 3)
+			var all []uint16
+			for {
+				n, err := r.ReadSamples(words)
+				all = append(all, words[:n]...)
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var out bytes.Buffer
+			out.Write(r.RawHeader())
+			if err := npy.NewWriter(r.Header, &out).WriteSamples(all); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(encoded, out.Bytes()) {
+				t.Error("output is not the same")
+			}
+
+			r = npy.NewReader(bytes.NewReader(encoded))
+			r.ReadHeader()
+			got, err := r.ReadChannels()
+			if err != nil {
+				t.Fatal(err)
+			}
+			for c := range channels {
+				if !slices.Equal(channels[c], got[c]) {
+					t.Errorf("channel %d: exp(%v) != got(%v)", c, channels[c], got[c])
+				}
+			}
+		})
+	}
+}
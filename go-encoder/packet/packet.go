@@ -0,0 +1,299 @@
+// Package packet puts markers of cache codec into packets of fixed size, for link that drops packets.
+//
+// Packet is header, whole markers and zero padding up to MTU.
+//
+//	Sequence uint32 // of packet, increments by one
+//	Epoch uint32    // of cache state, Sample / Interval
+//	Sample uint32   // number of samples before packet
+//	Count uint32    // of samples in packet
+//	Length uint16   // of markers in bytes
+//	Flags uint8     // FlagResync if cache is reset before packet
+//	markers [Length]byte
+//	padding [MTU - HeaderSize - Length]byte
+//
+// Cache is reset every Interval samples, which starts packet of new epoch.
+// When packets are lost, decoding resumes at next packet with FlagResync.
+package packet
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/bits"
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/encoding"
+)
+
+const HeaderSize = 19
+
+// MinMTU fits marker of forced not encoded samples of encoder.
+const MinMTU = HeaderSize + 16
+
+const FlagResync uint8 = 1
+
+type Header struct {
+	Sequence uint32
+	Epoch    uint32
+	Sample   uint32
+	Count    uint32
+	Length   uint16
+	Flags    uint8
+}
+
+func (s Header) AppendBinary(b []byte) []byte {
+	b = binary.LittleEndian.AppendUint32(b, s.Sequence)
+	b = binary.LittleEndian.AppendUint32(b, s.Epoch)
+	b = binary.LittleEndian.AppendUint32(b, s.Sample)
+	b = binary.LittleEndian.AppendUint32(b, s.Count)
+	b = binary.LittleEndian.AppendUint16(b, s.Length)
+	return append(b, s.Flags)
+}
+
+func (s *Header) UnmarshalBinary(b []byte) error {
+	if len(b) < HeaderSize {
+		return io.ErrUnexpectedEOF
+	}
+	s.Sequence = binary.LittleEndian.Uint32(b)
+	s.Epoch = binary.LittleEndian.Uint32(b[4:])
+	s.Sample = binary.LittleEndian.Uint32(b[8:])
+	s.Count = binary.LittleEndian.Uint32(b[12:])
+	s.Length = binary.LittleEndian.Uint16(b[16:])
+	s.Flags = b[18]
+	return nil
+}
+
+type Config struct {
+	MTU       int
+	Interval  int // samples between resyncs
+	ByteOrder binary.ByteOrder
+}
+
+func (s Config) Validate() error {
+	if s.MTU < MinMTU || s.MTU > HeaderSize+0xFFFF {
+		return fmt.Errorf("mtu(%d) is out of bound, expected [%d, %d]", s.MTU, MinMTU, HeaderSize+0xFFFF)
+	}
+	if s.Interval <= 0 {
+		return errors.New("resync interval is required")
+	}
+	return nil
+}
+
+// MaxMarkerSamples are max number of encoded and not encoded samples of marker that fits in packet.
+func (s Config) MaxMarkerSamples() (encoded, notEncoded int) {
+	payload := s.MTU - HeaderSize - (&encoding.Marker{}).SizeBytes()
+	return (payload / 7) * 8, payload / 2
+}
+
+// Packetizer writes markers into packets, as they are written to it.
+type Packetizer struct {
+	config  Config
+	w       io.Writer
+	header  Header
+	packet  []byte // header and markers
+	marker  []byte // not complete marker
+	size    int    // of not complete marker, 0 if not known yet
+	count   int    // of samples of not complete marker
+	sample  int    // of samples in packets
+	packets int
+}
+
+func NewPacketizer(config Config, w io.Writer) *Packetizer {
+	return &Packetizer{config: config, w: w, packet: make([]byte, HeaderSize, config.MTU)}
+}
+
+// NumPackets written so far.
+func (s *Packetizer) NumPackets() int { return s.packets }
+
+func (s *Packetizer) WriteByte(c byte) error {
+	_, err := s.Write([]byte{c})
+	return err
+}
+
+func (s *Packetizer) Write(b []byte) (int, error) {
+	for n := 0; n < len(b); {
+		if s.size == 0 {
+			k := min(len(b)-n, 2-len(s.marker))
+			s.marker = append(s.marker, b[n:n+k]...)
+			n += k
+			if len(s.marker) < 2 {
+				break
+			}
+			if err := s.readMarker(); err != nil {
+				return n, err
+			}
+		}
+
+		k := min(len(b)-n, s.size-len(s.marker))
+		s.marker = append(s.marker, b[n:n+k]...)
+		n += k
+		if len(s.marker) == s.size {
+			if err := s.add(s.marker, s.count); err != nil {
+				return n, err
+			}
+			s.marker, s.size, s.count = s.marker[:0], 0, 0
+		}
+	}
+	return len(b), nil
+}
+
+func (s *Packetizer) readMarker() error {
+	var marker encoding.Marker
+	if err := marker.UnmarshalBinaryFromReader(bytes.NewReader(s.marker), s.config.ByteOrder); err != nil {
+		if err == io.EOF {
+			return errors.New("zero marker is not sent in packets")
+		}
+		return err
+	}
+
+	s.size, s.count = marker.SizeBytes()+marker.Count*2, marker.Count
+	if marker.IsEncoded {
+		packer := bits.Packers[marker.EncodingSize]
+		s.size = marker.SizeBytes() + (marker.Count/packer.UnpackedLen())*packer.PackedLen()
+	}
+	if s.size > s.config.MTU-HeaderSize {
+		return fmt.Errorf("marker of %d bytes does not fit in packet of %d bytes", s.size, s.config.MTU)
+	}
+	return nil
+}
+
+func (s *Packetizer) add(marker []byte, count int) error {
+	resync := s.sample%s.config.Interval == 0
+	if resync || len(s.packet)+len(marker) > s.config.MTU {
+		if err := s.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if len(s.packet) == HeaderSize {
+		s.header = Header{Sequence: uint32(s.packets), Epoch: uint32(s.sample / s.config.Interval), Sample: uint32(s.sample)}
+		if resync {
+			s.header.Flags |= FlagResync
+		}
+	}
+
+	s.packet = append(s.packet, marker...)
+	s.header.Count += uint32(count)
+	s.sample += count
+	return nil
+}
+
+// Flush writes packet of markers written so far, if there are any.
+func (s *Packetizer) Flush() error {
+	if len(s.packet) == HeaderSize {
+		return nil
+	}
+
+	s.header.Length = uint16(len(s.packet) - HeaderSize)
+	s.header.AppendBinary(s.packet[:0])
+	s.packet = s.packet[:s.config.MTU]
+	clear(s.packet[HeaderSize+int(s.header.Length):])
+
+	if _, err := s.w.Write(s.packet); err != nil {
+		return err
+	}
+	s.packets++
+	s.packet = s.packet[:HeaderSize]
+	return nil
+}
+
+// Close writes last packet.
+func (s *Packetizer) Close() error {
+	if len(s.marker) > 0 {
+		return fmt.Errorf("marker is not complete: %w", io.ErrUnexpectedEOF)
+	}
+	return s.Flush()
+}
+
+// Packet is header and markers of packet.
+type Packet struct {
+	Header
+	Markers []byte
+}
+
+// Gap is samples of packets that are lost or can not be decoded.
+type Gap struct {
+	Sample  int
+	Count   int
+	Packets int
+}
+
+// Depacketizer reads packets in order of sequence, some of which can be lost.
+type Depacketizer struct {
+	mtu     int
+	r       io.Reader
+	buf     []byte
+	started bool
+	synced  bool
+	seq     uint32 // expected
+	epoch   uint32
+	sample  int // expected
+	skipped int // packets since last that is decoded
+}
+
+func NewDepacketizer(mtu int, r io.Reader) *Depacketizer {
+	return &Depacketizer{mtu: mtu, r: r, buf: make([]byte, mtu)}
+}
+
+// Next is packet that can be decoded, with gap of samples before it.
+// Packets after lost one are skipped up to packet with FlagResync.
+// It returns io.EOF when there are no more packets.
+func (s *Depacketizer) Next() (Packet, Gap, error) {
+	for {
+		if _, err := io.ReadFull(s.r, s.buf); err != nil {
+			return Packet{}, Gap{}, err
+		}
+
+		var header Header
+		if err := header.UnmarshalBinary(s.buf); err != nil {
+			return Packet{}, Gap{}, err
+		}
+		if int(header.Length) > s.mtu-HeaderSize {
+			return Packet{}, Gap{}, fmt.Errorf("packet %d: length(%d) is out of bound", header.Sequence, header.Length)
+		}
+
+		switch {
+		case !s.started:
+			s.synced = false
+			s.skipped += int(header.Sequence)
+		case header.Sequence < s.seq:
+			return Packet{}, Gap{}, fmt.Errorf("packet %d: duplicate or out of order, expected %d", header.Sequence, s.seq)
+		case header.Sequence > s.seq:
+			s.synced = false
+			s.skipped += int(header.Sequence - s.seq)
+		}
+		s.started = true
+		s.seq = header.Sequence + 1
+
+		if !s.synced {
+			if header.Flags&FlagResync == 0 {
+				s.skipped++
+				continue
+			}
+			s.synced = true
+		} else if header.Flags&FlagResync == 0 && header.Epoch != s.epoch {
+			return Packet{}, Gap{}, fmt.Errorf("packet %d: epoch(%d) != %d without resync", header.Sequence, header.Epoch, s.epoch)
+		}
+
+		if int(header.Sample) < s.sample {
+			return Packet{}, Gap{}, fmt.Errorf("packet %d: sample(%d) < %d", header.Sequence, header.Sample, s.sample)
+		}
+		gap := Gap{Sample: s.sample, Count: int(header.Sample) - s.sample, Packets: s.skipped}
+
+		s.epoch = header.Epoch
+		s.sample = int(header.Sample + header.Count)
+		s.skipped = 0
+
+		return Packet{Header: header, Markers: s.buf[HeaderSize : HeaderSize+int(header.Length)]}, gap, nil
+	}
+}
+
+// Tail is gap of samples after last packet that is decoded, up to total number of samples of stream.
+// Packets are of those that are skipped, and lost ones after them are not known.
+func (s *Depacketizer) Tail(numSamples int) Gap {
+	if numSamples <= s.sample {
+		return Gap{Sample: s.sample}
+	}
+	return Gap{Sample: s.sample, Count: numSamples - s.sample, Packets: s.skipped}
+}
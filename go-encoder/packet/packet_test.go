@@ -0,0 +1,184 @@
+package packet_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"slices"
+	"testing"
+
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/encoding"
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/packet"
+)
+
+// markers of 4 not encoded samples each, samples are their numbers
+func markers(t *testing.T, numMarkers int) []byte {
+	var b bytes.Buffer
+	for i := range numMarkers {
+		if err := (&encoding.Marker{Count: 4}).MarshalBinaryToWriter(&b, binary.LittleEndian); err != nil {
+			t.Fatal(err)
+		}
+		for j := range 4 {
+			binary.Write(&b, binary.LittleEndian, uint16(i*4+j))
+		}
+	}
+	return b.Bytes()
+}
+
+func packets(t *testing.T, config packet.Config, b []byte) [][]byte {
+	var out bytes.Buffer
+	p := packet.NewPacketizer(config, &out)
+	// byte by byte as encoder does
+	for _, c := range b {
+		if err := p.WriteByte(c); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var ps [][]byte
+	for out.Len() > 0 {
+		ps = append(ps, out.Next(config.MTU))
+	}
+	if len(ps) != p.NumPackets() || len(ps[len(ps)-1]) != config.MTU {
+		t.Fatalf("packets(%d) != %d of %d bytes", len(ps), p.NumPackets(), config.MTU)
+	}
+	return ps
+}
+
+func TestPacketizer(t *testing.T) {
+	b := markers(t, 100)
+	config := packet.Config{MTU: 100, Interval: 80, ByteOrder: binary.LittleEndian}
+
+	depacketizer := packet.NewDepacketizer(config.MTU, bytes.NewReader(bytes.Join(packets(t, config, b), nil)))
+
+	var got []byte
+	sample := 0
+	for {
+		p, gap, err := depacketizer.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if gap != (packet.Gap{Sample: sample}) {
+			t.Error(gap)
+		}
+		if int(p.Sample) != sample || int(p.Epoch) != sample/config.Interval {
+			t.Error(p.Header)
+		}
+		if resync := p.Flags&packet.FlagResync != 0; resync != (sample%config.Interval == 0) {
+			t.Error(p.Header)
+		}
+		if n := len(p.Markers) / 10; p.Count != uint32(4*n) {
+			t.Error(p.Header)
+		}
+		got = append(got, p.Markers...)
+		sample += int(p.Count)
+	}
+	if !bytes.Equal(got, b) {
+		t.Error("markers are different")
+	}
+}
+
+func TestDepacketizer_Lost(t *testing.T) {
+	// packet of one marker, resync every two of them
+	config := packet.Config{MTU: packet.MinMTU, Interval: 8, ByteOrder: binary.LittleEndian}
+	ps := packets(t, config, markers(t, 8))
+
+	tests := []struct {
+		name    string
+		lost    []int
+		samples []int
+		gaps    []packet.Gap
+		tail    packet.Gap
+	}{
+		{name: "none", samples: []int{0, 4, 8, 12, 16, 20, 24, 28}, tail: packet.Gap{Sample: 32}},
+		{name: "before resync", lost: []int{1}, samples: []int{0, 8, 12, 16, 20, 24, 28}, gaps: []packet.Gap{{Sample: 4, Count: 4, Packets: 1}}, tail: packet.Gap{Sample: 32}},
+		{name: "resync", lost: []int{2}, samples: []int{0, 4, 16, 20, 24, 28}, gaps: []packet.Gap{{Sample: 8, Count: 8, Packets: 2}}, tail: packet.Gap{Sample: 32}},
+		{name: "first", lost: []int{0}, samples: []int{8, 12, 16, 20, 24, 28}, gaps: []packet.Gap{{Count: 8, Packets: 2}}, tail: packet.Gap{Sample: 32}},
+		{name: "many", lost: []int{3, 4, 5}, samples: []int{0, 4, 8, 24, 28}, gaps: []packet.Gap{{Sample: 12, Count: 12, Packets: 3}}, tail: packet.Gap{Sample: 32}},
+		{name: "last", lost: []int{7}, samples: []int{0, 4, 8, 12, 16, 20, 24}, tail: packet.Gap{Sample: 28, Count: 4}},
+		{name: "resync before last", lost: []int{6}, samples: []int{0, 4, 8, 12, 16, 20}, tail: packet.Gap{Sample: 24, Count: 8, Packets: 2}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var b []byte
+			for i, p := range ps {
+				if !slices.Contains(tc.lost, i) {
+					b = append(b, p...)
+				}
+			}
+
+			depacketizer := packet.NewDepacketizer(config.MTU, bytes.NewReader(b))
+			var samples []int
+			var gaps []packet.Gap
+			for {
+				p, gap, err := depacketizer.Next()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				samples = append(samples, int(p.Sample))
+				if gap.Count > 0 || gap.Packets > 0 {
+					gaps = append(gaps, gap)
+				}
+			}
+			if !slices.Equal(samples, tc.samples) {
+				t.Errorf("samples(%v) != %v", samples, tc.samples)
+			}
+			if !slices.Equal(gaps, tc.gaps) {
+				t.Errorf("gaps(%v) != %v", gaps, tc.gaps)
+			}
+			if tail := depacketizer.Tail(32); tail != tc.tail {
+				t.Errorf("tail(%v) != %v", tail, tc.tail)
+			}
+		})
+	}
+}
+
+func TestDepacketizer_Duplicate(t *testing.T) {
+	config := packet.Config{MTU: packet.MinMTU, Interval: 8, ByteOrder: binary.LittleEndian}
+	ps := packets(t, config, markers(t, 8))
+
+	for name, order := range map[string][]int{"duplicate": {0, 1, 1, 2}, "reordered": {0, 2, 1, 3}} {
+		t.Run(name, func(t *testing.T) {
+			var b []byte
+			for _, i := range order {
+				b = append(b, ps[i]...)
+			}
+
+			depacketizer := packet.NewDepacketizer(config.MTU, bytes.NewReader(b))
+			var err error
+			for err == nil {
+				_, _, err = depacketizer.Next()
+			}
+			if err == io.EOF {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestPacketizer_MarkerDoesNotFit(t *testing.T) {
+	config := packet.Config{MTU: packet.MinMTU, Interval: 8, ByteOrder: binary.LittleEndian}
+	var b bytes.Buffer
+	(&encoding.Marker{Count: 100}).MarshalBinaryToWriter(&b, binary.LittleEndian)
+	if _, err := packet.NewPacketizer(config, io.Discard).Write(b.Bytes()); err == nil {
+		t.Error("expected error")
+	}
+	if _, err := packet.NewPacketizer(config, io.Discard).Write([]byte{0, 0}); err == nil {
+		t.Error("expected error for zero marker")
+	}
+	p := packet.NewPacketizer(config, io.Discard)
+	p.Write([]byte{0})
+	if err := p.Close(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Error(err)
+	}
+}
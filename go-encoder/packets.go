@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/cache"
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/container"
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/packet"
+)
+
+// encodePackets encodes samples with cache codec into packets of mtu bytes, after header of stream.
+// Cache is reset at keyframes, which are resync points of packets.
+func encodePackets(mtu int, encoderConfig CacheSampleEncoderConfig, cacheConfig cache.Config, inputConfig InputConfig, r io.Reader, w *bufio.Writer) error {
+	config := packet.Config{MTU: mtu, Interval: encoderConfig.KeyframeInterval, ByteOrder: encoderConfig.ByteOrder}
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
+	// markers fit in packet
+	encoded, notEncoded := config.MaxMarkerSamples()
+	encoderConfig.EncodedSeqMaxLen = min(encoderConfig.EncodedSeqMaxLen, encoded)
+	encoderConfig.NotEncodedSeqMaxLen = min(encoderConfig.NotEncodedSeqMaxLen, notEncoded)
+
+	sampleReader, header, err := newSampleReader(inputConfig, r)
+	if err != nil {
+		return err
+	}
+	if err := writeStreamHeader(header, w, append(streamSections(encoderConfig, CacheCodec{}), container.PacketsSection(mtu))...); err != nil {
+		return err
+	}
+
+	packetizer := packet.NewPacketizer(config, w)
+	encoder := NewCacheSampleEncoder(encoderConfig, cache.New(cacheConfig), packetizer)
+	if err := encodeSamples(sampleReader, encoder, encoderConfig.EncodedSeqMaxLen); err != nil {
+		return err
+	}
+	if err := encoder.FlushBuffer(); err != nil {
+		return err
+	}
+	if err := packetizer.Close(); err != nil {
+		return err
+	}
+
+	trailer, err := io.ReadAll(sampleReader.Trailer())
+	if err != nil {
+		return err
+	}
+	if len(trailer) > 0 {
+		return fmt.Errorf("trailer of input of %d bytes is not sent in packets", len(trailer))
+	}
+
+	slog.Info("done", "packets", packetizer.NumPackets(), "stats", encoder.Stats())
+	return nil
+}
+
+// decodePackets decodes packets that are left after lost ones.
+// Samples of lost packets, and of packets up to next resync, are zeros.
+// Lost packets at the end are filled up to number of samples of input, when its format tells it.
+func decodePackets(header container.Header, mtu int, encoderConfig CacheSampleEncoderConfig, cacheConfig cache.Config, r io.Reader, output *Output) error {
+	layout, err := streamLayout(header)
+	if err != nil {
+		return err
+	}
+	sampleWriter, _, err := NewSampleWriter(header, output)
+	if err != nil {
+		return err
+	}
+
+	// cache is reset by packets
+	encoderConfig.KeyframeInterval = 0
+	c := cache.New(cacheConfig)
+
+	var numPackets, numLostPackets, numLostSamples int
+	depacketizer := packet.NewDepacketizer(mtu, r)
+	samples := make([]uint16, 0, encoderConfig.EncodedSeqMaxLen)
+	for {
+		p, gap, err := depacketizer.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		// samples of header are not trusted, gap is bound by samples of input when its format tells it
+		if end := int(p.Sample) + int(p.Count); layout.NumSamples >= 0 && end > layout.NumSamples {
+			return fmt.Errorf("packet %d: samples up to %d are after last sample(%d)", p.Sequence, end, layout.NumSamples)
+		}
+		if gap.Packets > 0 || gap.Count > 0 {
+			slog.Warn("gap", "sample", gap.Sample, "count", gap.Count, "packets", gap.Packets, "resync_packet", p.Sequence)
+			numLostPackets += gap.Packets
+			numLostSamples += gap.Count
+			if err := writeZeros(sampleWriter, gap.Count); err != nil {
+				return err
+			}
+		}
+
+		if p.Flags&packet.FlagResync != 0 {
+			c.Reset()
+		}
+		decoder := NewCacheSampleDecoder(encoderConfig, c, bytes.NewReader(p.Markers))
+		samples = samples[:0]
+		for range p.Count {
+			sample, err := decoder.Next()
+			if err != nil {
+				if err == io.EOF {
+					err = io.ErrUnexpectedEOF
+				}
+				return fmt.Errorf("packet %d: %w", p.Sequence, err)
+			}
+			samples = append(samples, sample)
+		}
+		if decoder.Buffered() > 0 {
+			return fmt.Errorf("packet %d: more samples than in header", p.Sequence)
+		}
+
+		if err := sampleWriter.WriteSamples(samples); err != nil {
+			return err
+		}
+		numPackets++
+	}
+
+	if gap := depacketizer.Tail(layout.NumSamples); gap.Count > 0 {
+		slog.Warn("gap", "sample", gap.Sample, "count", gap.Count, "packets", gap.Packets, "tail", true)
+		numLostPackets += gap.Packets
+		numLostSamples += gap.Count
+		if err := writeZeros(sampleWriter, gap.Count); err != nil {
+			return err
+		}
+	}
+
+	if c, ok := sampleWriter.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			return err
+		}
+	}
+
+	slog.Info("packets", "decoded", numPackets, "lost", numLostPackets, "lost_samples", numLostSamples)
+	return nil
+}
+
+// writeZeros writes n zero samples in chunks.
+func writeZeros(w SampleWriter, n int) error {
+	zeros := make([]uint16, min(n, 1<<12))
+	for n > 0 {
+		k := min(n, len(zeros))
+		if err := w.WriteSamples(zeros[:k]); err != nil {
+			return err
+		}
+		n -= k
+	}
+	return nil
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/cache"
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/container"
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/encoding"
+)
+
+// block is samples between keyframes, encoded or decoded by worker.
+type block struct {
+	samples []uint16
+	encoded []byte
+	rest    []byte // after zero marker, of last block
+	err     error
+}
+
+// inFlight bounds blocks that are read and not yet written to workers, and stops reader once writer returns.
+type inFlight struct {
+	sem  chan struct{}
+	done chan struct{}
+}
+
+func newInFlight(workers int) inFlight {
+	return inFlight{sem: make(chan struct{}, max(1, workers)), done: make(chan struct{})}
+}
+
+// acquire waits for block to be written, it is false if writer returned.
+func (s inFlight) acquire() bool {
+	select {
+	case s.sem <- struct{}{}:
+		return true
+	case <-s.done:
+		return false
+	}
+}
+
+func (s inFlight) release() { <-s.sem }
+
+func (s inFlight) stop() { close(s.done) }
+
+// readFull reads samples until p is full or there is no more of them.
+func readFull(r SampleReader, p []uint16) (int, error) {
+	n := 0
+	for n < len(p) {
+		k, err := r.ReadSamples(p[n:])
+		n += k
+		if err != nil {
+			return n, err
+		}
+	}
+	return n, nil
+}
+
+// encodeParallel encodes blocks between keyframes concurrently, each with its own cache.
+// Output is same as of sequential encoding with keyframes.
+func encodeParallel(encoderConfig CacheSampleEncoderConfig, cacheConfig cache.Config, inputConfig InputConfig, r io.Reader, w *bufio.Writer) error {
+	if encoderConfig.KeyframeInterval <= 0 {
+		return errors.New("parallel encoding requires keyframes")
+	}
+
+	sampleReader, err := NewSampleReader(inputConfig, r, w, streamSections(encoderConfig, CacheCodec{})...)
+	if err != nil {
+		return err
+	}
+
+	// blocks in order, at most workers of them in flight
+	flight := newInFlight(encoderConfig.Workers)
+	defer flight.stop()
+	blocks := make(chan chan block, cap(flight.sem))
+	go func() {
+		defer close(blocks)
+		for flight.acquire() {
+			samples := make([]uint16, encoderConfig.KeyframeInterval)
+			n, err := readFull(sampleReader, samples)
+			if err != nil && err != io.EOF {
+				c := make(chan block, 1)
+				c <- block{err: err}
+				blocks <- c
+				return
+			}
+			if n == 0 {
+				return
+			}
+
+			c := make(chan block, 1)
+			blocks <- c
+			go func() { c <- encodeBlock(encoderConfig, cacheConfig, samples[:n]) }()
+
+			if err == io.EOF {
+				return
+			}
+		}
+	}()
+
+	var index container.Index
+	var offset, numSamples int
+	for c := range blocks {
+		b := <-c
+		flight.release()
+		if b.err != nil {
+			return b.err
+		}
+
+		index = append(index, container.IndexEntry{Sample: uint64(numSamples), Offset: uint64(offset)})
+		if _, err := w.Write(b.encoded); err != nil {
+			return err
+		}
+		offset += len(b.encoded)
+		numSamples += len(b.samples)
+	}
+	slog.Info("done", "blocks", len(index), "samples", numSamples, "bytes", offset)
+
+	// index is last, so zero marker is always there
+	if err := (&encoding.Marker{}).MarshalBinaryToWriter(w, encoderConfig.ByteOrder); err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, sampleReader.Trailer()); err != nil {
+		return err
+	}
+	return index.MarshalBinary(w)
+}
+
+func encodeBlock(encoderConfig CacheSampleEncoderConfig, cacheConfig cache.Config, samples []uint16) block {
+	var b bytes.Buffer
+	encoder := NewCacheSampleEncoder(encoderConfig, cache.New(cacheConfig), &b)
+	for _, sample := range samples {
+		if err := encoder.Write(sample); err != nil {
+			return block{err: err}
+		}
+	}
+	if err := encoder.FlushBuffer(); err != nil {
+		return block{err: err}
+	}
+	return block{samples: samples, encoded: b.Bytes()}
+}
+
+// decodeParallel decodes blocks between keyframes concurrently, using index at the end of stream.
+// Stream without keyframes, or of other codec than cache, is decoded sequentially.
+func decodeParallel(encoderConfig CacheSampleEncoderConfig, cacheConfig cache.Config, r io.ReadSeeker, output *Output) error {
+	header, err := ReadStreamHeader(bufio.NewReader(r))
+	if err != nil {
+		return err
+	}
+	if encoderConfig.KeyframeInterval, err = header.KeyframeInterval(); err != nil {
+		return err
+	}
+	codec, err := streamCodec(header)
+	if err != nil {
+		return err
+	}
+	if encoderConfig.KeyframeInterval == 0 || codec.ID() != CodecIDCache {
+		if _, err := r.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		return decode(encoderConfig, cacheConfig, bufio.NewReader(r), output)
+	}
+
+	index, err := container.ReadIndex(r)
+	if err != nil {
+		return err
+	}
+	// offsets are of markers, which are between header and index
+	end, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+	markersSize := max(0, end-int64(header.Size())-int64(index.Size()))
+	if n := len(index); n > 0 && index[n-1].Offset > uint64(markersSize) {
+		return fmt.Errorf("offset of keyframe(%d) is after markers of %d bytes", index[n-1].Offset, markersSize)
+	}
+	if _, err := r.Seek(int64(header.Size()), io.SeekStart); err != nil {
+		return err
+	}
+
+	sampleWriter, trailer, err := NewSampleWriter(header, output)
+	if err != nil {
+		return err
+	}
+
+	// blocks in order, at most workers of them in flight
+	flight := newInFlight(encoderConfig.Workers)
+	defer flight.stop()
+	blocks := make(chan chan block, cap(flight.sem))
+	go func() {
+		defer close(blocks)
+		for i := range index {
+			if !flight.acquire() {
+				return
+			}
+			var encoded []byte
+			var err error
+			if i+1 < len(index) {
+				encoded = make([]byte, index[i+1].Offset-index[i].Offset)
+				_, err = io.ReadFull(r, encoded)
+			} else {
+				encoded, err = io.ReadAll(r)
+			}
+
+			c := make(chan block, 1)
+			blocks <- c
+			if err != nil {
+				c <- block{err: err}
+				return
+			}
+			go func() { c <- decodeBlock(encoderConfig, cacheConfig, encoded) }()
+		}
+	}()
+
+	var rest []byte
+	for c := range blocks {
+		b := <-c
+		flight.release()
+		if b.err != nil {
+			return b.err
+		}
+		if err := sampleWriter.WriteSamples(b.samples); err != nil {
+			return err
+		}
+		rest = b.rest
+	}
+
+	if c, ok := sampleWriter.(io.Closer); ok {
+		if err := c.Close(); err != nil {
+			return err
+		}
+	}
+
+	if len(index) == 0 {
+		// no samples, stream is zero marker, trailer and index
+		if rest, err = io.ReadAll(r); err != nil {
+			return err
+		}
+		rest = rest[min(len(rest), 2):]
+	}
+	return copyTrailer(bufio.NewReader(bytes.NewReader(rest)), true, trailer)
+}
+
+func decodeBlock(encoderConfig CacheSampleEncoderConfig, cacheConfig cache.Config, encoded []byte) block {
+	r := bytes.NewReader(encoded)
+	decoder := NewCacheSampleDecoder(encoderConfig, cache.New(cacheConfig), r)
+
+	var samples []uint16
+	for {
+		sample, err := decoder.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return block{err: err}
+		}
+		samples = append(samples, sample)
+	}
+
+	rest, _ := io.ReadAll(r)
+	return block{samples: samples, rest: rest}
+}
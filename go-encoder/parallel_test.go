@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/cache"
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/wav"
+)
+
+// benchmarkWAV is testdata repeated to be long enough for many blocks.
+func benchmarkWAV(b *testing.B) []byte {
+	f, err := os.Open(filepath.Join("testdata", "0052503c-2849-4f41-ab51-db382103690c.wav"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer f.Close()
+
+	r := wav.NewWAVReader(f)
+	if err := r.ReadHeader(); err != nil {
+		b.Fatal(err)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		b.Fatal(err)
+	}
+	data = bytes.Repeat(data, 8)
+
+	header := r.Header
+	header.SetDataSize(uint64(len(data)))
+
+	var out bytes.Buffer
+	header.MarshalBinary(&out)
+	out.Write(data)
+	return out.Bytes()
+}
+
+func discardLogs() { slog.SetDefault(slog.New(slog.NewTextHandler(io.Discard, nil))) }
+
+func benchmarkConfig(workers int) CacheSampleEncoderConfig {
+	return CacheSampleEncoderConfig{
+		EncodedSeqMaxLen:    (1 << 13) - 1,
+		NotEncodedSeqMaxLen: (1 << 7) - 1,
+		ByteOrder:           binary.LittleEndian,
+		KeyframeInterval:    1 << 15,
+		Workers:             workers,
+	}
+}
+
+func BenchmarkEncodeParallel(b *testing.B) {
+	discardLogs()
+	in := benchmarkWAV(b)
+
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers_%d", workers), func(b *testing.B) {
+			b.SetBytes(int64(len(in)))
+			for range b.N {
+				w := bufio.NewWriter(io.Discard)
+				if err := encodeParallel(benchmarkConfig(workers), cache.Config{Size: 1 << 10}, InputConfig{Format: "wav"}, bytes.NewReader(in), w); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkDecodeParallel(b *testing.B) {
+	discardLogs()
+	var encoded bytes.Buffer
+	w := bufio.NewWriter(&encoded)
+	if err := encodeParallel(benchmarkConfig(1), cache.Config{Size: 1 << 10}, InputConfig{Format: "wav"}, bytes.NewReader(benchmarkWAV(b)), w); err != nil {
+		b.Fatal(err)
+	}
+	w.Flush()
+
+	for _, workers := range []int{1, 2, 4, 8} {
+		b.Run(fmt.Sprintf("workers_%d", workers), func(b *testing.B) {
+			b.SetBytes(int64(encoded.Len()))
+			for range b.N {
+				output := &Output{Path: filepath.Join(b.TempDir(), "out.wav")}
+				if err := decodeParallel(benchmarkConfig(workers), cache.Config{Size: 1 << 10}, bytes.NewReader(encoded.Bytes()), output); err != nil {
+					b.Fatal(err)
+				}
+				output.Close()
+			}
+		})
+	}
+}
+
+// failingWriter fails once n bytes are written, so that headers are written and blocks are not.
+type failingWriter struct{ n int }
+
+func (s *failingWriter) Write(b []byte) (int, error) {
+	if len(b) > s.n {
+		k := s.n
+		s.n = 0
+		return k, io.ErrClosedPipe
+	}
+	s.n -= len(b)
+	return len(b), nil
+}
+
+// TestParallel_WriteError checks that reader of blocks stops once writer fails.
+func TestParallel_WriteError(t *testing.T) {
+	discardLogs()
+	in, err := os.ReadFile(filepath.Join("testdata", "0052503c-2849-4f41-ab51-db382103690c.wav"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := benchmarkConfig(2)
+	config.KeyframeInterval = 1000
+	cacheConfig := cache.Config{Size: 1 << 10}
+
+	var encoded bytes.Buffer
+	w := bufio.NewWriter(&encoded)
+	if err := encodeParallel(config, cacheConfig, InputConfig{Format: "wav"}, bytes.NewReader(in), w); err != nil {
+		t.Fatal(err)
+	}
+	w.Flush()
+
+	numGoroutines := runtime.NumGoroutine()
+
+	const n = 1 << 10
+	if encoded.Len() < 8*n || len(in) < 8*n {
+		t.Fatalf("encoded(%d) and input(%d) are too short for failing writer", encoded.Len(), len(in))
+	}
+
+	w = bufio.NewWriterSize(&failingWriter{n: n}, 16)
+	if err := encodeParallel(config, cacheConfig, InputConfig{Format: "wav"}, bytes.NewReader(in), w); err != io.ErrClosedPipe {
+		t.Errorf("expected error of encode, got %v", err)
+	}
+
+	f, err := os.Create(filepath.Join(t.TempDir(), "encoded"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	f.Write(encoded.Bytes())
+	f.Seek(0, io.SeekStart)
+	if err := decodeParallel(config, cacheConfig, f, &Output{Writer: &failingWriter{n: n}}); err != io.ErrClosedPipe {
+		t.Errorf("expected error of decode, got %v", err)
+	}
+
+	for range 100 {
+		if runtime.NumGoroutine() <= numGoroutines {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Errorf("goroutines(%d) > %d", runtime.NumGoroutine(), numGoroutines)
+}
+
+// TestDecodeParallel_HugeOffset checks that offsets of index are within stream.
+func TestDecodeParallel_HugeOffset(t *testing.T) {
+	discardLogs()
+	in, err := os.ReadFile(filepath.Join("testdata", "0052503c-2849-4f41-ab51-db382103690c.wav"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := benchmarkConfig(2)
+	config.KeyframeInterval = 1000
+	cacheConfig := cache.Config{Size: 1 << 10}
+
+	var encoded bytes.Buffer
+	w := bufio.NewWriter(&encoded)
+	if err := encodeParallel(config, cacheConfig, InputConfig{Format: "wav"}, bytes.NewReader(in), w); err != nil {
+		t.Fatal(err)
+	}
+	w.Flush()
+
+	// offset of last keyframe, before number of entries
+	b := encoded.Bytes()
+	binary.LittleEndian.PutUint64(b[len(b)-16:], 1<<62)
+
+	if err := decodeParallel(config, cacheConfig, bytes.NewReader(b), &Output{Writer: io.Discard}); err == nil || !strings.Contains(err.Error(), "offset") {
+		t.Errorf("expected error of offset, got %v", err)
+	}
+}
@@ -0,0 +1,141 @@
+package pcm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Format of raw headerless PCM samples.
+type Format struct {
+	SampleRate    uint32
+	NumChannels   uint16
+	BitsPerSample uint16
+	BigEndian     bool
+}
+
+func (s Format) ByteOrder() binary.ByteOrder {
+	if s.BigEndian {
+		return binary.BigEndian
+	}
+	return binary.LittleEndian
+}
+
+// SampleSize is number of bytes in single sample.
+func (s Format) SampleSize() int { return int(s.BitsPerSample) / 8 }
+
+func (s Format) Validate() error {
+	if s.BitsPerSample != 8 && s.BitsPerSample != 16 {
+		return fmt.Errorf("bits per sample(%d) is not supported, expected 8 or 16", s.BitsPerSample)
+	}
+	if s.NumChannels == 0 {
+		return errors.New("at least one channel required")
+	}
+	return nil
+}
+
+func (s Format) MarshalBinary() ([]byte, error) {
+	var b bytes.Buffer
+	if err := binary.Write(&b, binary.LittleEndian, s); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func (s *Format) UnmarshalBinary(b []byte) error {
+	if err := binary.Read(bytes.NewReader(b), binary.LittleEndian, s); err != nil {
+		return err
+	}
+	return s.Validate()
+}
+
+// Reader reads samples until end of input.
+// Bytes of last partial sample are available in Trailer.
+type Reader struct {
+	Format  Format
+	r       io.Reader
+	buf     []byte
+	trailer []byte
+}
+
+func NewReader(format Format, r io.Reader) *Reader { return &Reader{Format: format, r: r} }
+
+func (s *Reader) Trailer() io.Reader { return bytes.NewReader(s.trailer) }
+
+func (s *Reader) ReadSamples(p []uint16) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	size := s.Format.SampleSize()
+	if cap(s.buf) < len(p)*size {
+		s.buf = make([]byte, len(p)*size)
+	}
+	b := s.buf[:len(p)*size]
+
+	k, err := io.ReadFull(s.r, b)
+	if err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	if err == nil && k < len(b) {
+		err = io.EOF
+	}
+
+	n := k / size
+	if err == io.EOF {
+		s.trailer = append(s.trailer, b[n*size:k]...)
+	}
+
+	for i := range n {
+		switch size {
+		case 1:
+			p[i] = uint16(b[i])
+		case 2:
+			p[i] = s.Format.ByteOrder().Uint16(b[i*size:])
+		}
+	}
+
+	if n > 0 && err == io.EOF {
+		// report samples first, next read will report end
+		s.r = eofReader{}
+		return n, nil
+	}
+	return n, err
+}
+
+type eofReader struct{}
+
+func (eofReader) Read([]byte) (int, error) { return 0, io.EOF }
+
+type Writer struct {
+	Format Format
+	w      io.Writer
+	buf    []byte
+}
+
+func NewWriter(format Format, w io.Writer) *Writer { return &Writer{Format: format, w: w} }
+
+func (s *Writer) WriteSamples(p []uint16) error {
+	size := s.Format.SampleSize()
+	if cap(s.buf) < len(p)*size {
+		s.buf = make([]byte, len(p)*size)
+	}
+	b := s.buf[:len(p)*size]
+
+	for i, v := range p {
+		switch size {
+		case 1:
+			if v > 0xFF {
+				return fmt.Errorf("sample(%d) does not fit into 8 bits", v)
+			}
+			b[i] = byte(v)
+		case 2:
+			s.Format.ByteOrder().PutUint16(b[i*size:], v)
+		}
+	}
+
+	_, err := s.w.Write(b)
+	return err
+}
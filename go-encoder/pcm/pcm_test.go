@@ -0,0 +1,83 @@
+package pcm_test
+
+import (
+	"bytes"
+	"io"
+	"slices"
+	"testing"
+
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/pcm"
+)
+
+func TestReaderWriter(t *testing.T) {
+	tests := []struct {
+		format pcm.Format
+		in     []byte
+		exp    []uint16
+	}{
+		{
+			format: pcm.Format{NumChannels: 1, BitsPerSample: 16},
+			in:     []byte{0x01, 0x02, 0x03, 0x04},
+			exp:    []uint16{0x0201, 0x0403},
+		},
+		{
+			format: pcm.Format{NumChannels: 2, BitsPerSample: 16, BigEndian: true},
+			in:     []byte{0x01, 0x02, 0x03, 0x04, 0x05},
+			exp:    []uint16{0x0102, 0x0304},
+		},
+		{
+			format: pcm.Format{NumChannels: 1, BitsPerSample: 8},
+			in:     []byte{0x01, 0xFF, 0x03},
+			exp:    []uint16{0x01, 0xFF, 0x03},
+		},
+	}
+	for _, tc := range tests {
+		r := pcm.NewReader(tc.format, bytes.NewReader(tc.in))
+
+		var got []uint16
+		p := make([]uint16, 2)
+		for {
+			n, err := r.ReadSamples(p)
+			got = append(got, p[:n]...)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if !slices.Equal(got, tc.exp) {
+			t.Errorf("exp(%v) != got(%v)", tc.exp, got)
+		}
+
+		var b bytes.Buffer
+		w := pcm.NewWriter(tc.format, &b)
+		if err := w.WriteSamples(got); err != nil {
+			t.Fatal(err)
+		}
+		io.Copy(&b, r.Trailer())
+
+		if !bytes.Equal(b.Bytes(), tc.in) {
+			t.Errorf("exp(%v) != got(%v)", tc.in, b.Bytes())
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	format := pcm.Format{SampleRate: 19531, NumChannels: 2, BitsPerSample: 16, BigEndian: true}
+
+	b, err := format.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got pcm.Format
+	if err := got.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+
+	if got != format {
+		t.Errorf("exp(%#v) != got(%#v)", format, got)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/cache"
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/container"
+)
+
+// RateConfig is budget of output of encoder.
+type RateConfig struct {
+	BitsPerSecond float64       // 0 for no budget
+	Window        time.Duration // output is measured and coding is adapted after each window
+	MaxError      int           // of samples when over budget, required as lossless output can not be adapted
+}
+
+// RateStats is how often budget forced degradation of samples.
+type RateStats struct {
+	NumWindows           int
+	NumWindowsOverBudget int
+	NumWindowsDegraded   int         // encoded with max error above zero
+	NumSamplesByMaxError map[int]int // encoded with max error
+	BitsPerSecond        float64
+}
+
+// RateController adapts max error of encoder so that output is within budget.
+// Max error doubles after window that makes output over budget, and halves after window that makes it within budget with margin.
+// Output is of stream header and of encoder.
+type RateController struct {
+	config  RateConfig
+	encoder *CacheSampleEncoder
+	offset  int64   // bytes of stream header
+	window  int     // samples
+	budget  float64 // bytes per sample
+	level   int     // index of max error
+	errors  []int   // max error by level
+	n       int     // samples of current window
+	total   int     // samples
+	stats   RateStats
+}
+
+func NewRateController(config RateConfig, encoder *CacheSampleEncoder, headerSize int64, samplesPerSecond float64) *RateController {
+	maxErrors := []int{0}
+	for e := 1; e < config.MaxError; e *= 2 {
+		maxErrors = append(maxErrors, e)
+	}
+	if config.MaxError > 0 {
+		maxErrors = append(maxErrors, config.MaxError)
+	}
+
+	return &RateController{
+		config:  config,
+		encoder: encoder,
+		offset:  headerSize,
+		window:  max(1, int(config.Window.Seconds()*samplesPerSecond)),
+		budget:  config.BitsPerSecond / 8 / samplesPerSecond,
+		errors:  maxErrors,
+		stats:   RateStats{NumSamplesByMaxError: make(map[int]int)},
+	}
+}
+
+func (s *RateController) Write(v uint16) error {
+	if err := s.encoder.Write(v); err != nil {
+		return err
+	}
+	s.stats.NumSamplesByMaxError[s.errors[s.level]]++
+	s.total++
+
+	if s.n++; s.n < s.window {
+		return nil
+	}
+	return s.endWindow()
+}
+
+// endWindow flushes samples of window, so that size of output is as of all samples written, and adapts max error.
+func (s *RateController) endWindow() error {
+	if err := s.encoder.FlushBuffer(); err != nil {
+		return err
+	}
+
+	s.stats.NumWindows++
+	if s.level > 0 {
+		s.stats.NumWindowsDegraded++
+	}
+
+	// budget is of all samples so far, so that savings of one window are spent in next ones
+	budget := s.budget * float64(s.total)
+	switch size := float64(s.Size()); {
+	case size > budget:
+		s.stats.NumWindowsOverBudget++
+		s.level = min(s.level+1, len(s.errors)-1)
+	case size < 0.9*budget:
+		s.level = max(s.level-1, 0)
+	}
+	s.n = 0
+	return s.encoder.SetMaxError(s.errors[s.level])
+}
+
+func (s *RateController) FlushBuffer() error { return s.encoder.FlushBuffer() }
+
+// Size of output so far, with stream header.
+func (s *RateController) Size() int64 { return s.offset + s.encoder.Size() }
+
+func (s *RateController) Index() container.Index { return s.encoder.Index() }
+
+func (s *RateController) Stats() CacheSampleEncoderStats { return s.encoder.Stats() }
+
+// RateStats of windows so far.
+func (s *RateController) RateStats() RateStats { return s.stats }
+
+// encodeRate encodes with cache codec, with max error of samples adapted to stay within budget.
+func encodeRate(config RateConfig, codec Codec, encoderConfig CacheSampleEncoderConfig, cacheConfig cache.Config, inputConfig InputConfig, r io.Reader, w *bufio.Writer) error {
+	if config.MaxError <= 0 {
+		return errors.New("rate control requires max error, lossless output can not be adapted")
+	}
+
+	sampleReader, header, err := newSampleReader(inputConfig, r)
+	if err != nil {
+		return err
+	}
+
+	sampleRate, numChannels := sampleLayout(sampleReader)
+	if sampleRate == 0 {
+		return errors.New("rate control requires sample rate of input")
+	}
+
+	// samples are lossless until output is over budget
+	sections := append(streamSections(encoderConfig, codec), container.MaxErrorSection(config.MaxError))
+	var streamHeader bytes.Buffer
+	if err := writeStreamHeader(header, &streamHeader, sections...); err != nil {
+		return err
+	}
+	if _, err := w.Write(streamHeader.Bytes()); err != nil {
+		return err
+	}
+
+	encoder, ok := codec.NewEncoder(encoderConfig, cacheConfig, w).(*CacheSampleEncoder)
+	if !ok {
+		return errors.New("rate control requires codec of cache")
+	}
+	controller := NewRateController(config, encoder, int64(streamHeader.Len()), sampleRate*float64(max(1, numChannels)))
+
+	if err := encodeSamples(sampleReader, controller, encoderConfig.EncodedSeqMaxLen); err != nil {
+		return err
+	}
+	if err := finishEncode(encoderConfig, controller, sampleReader.Trailer(), w); err != nil {
+		return err
+	}
+
+	stats := controller.RateStats()
+	if n := encoder.Stats().NumTotalSamples; n > 0 {
+		stats.BitsPerSecond = float64(controller.Size()) * 8 * sampleRate * float64(max(1, numChannels)) / float64(n)
+	}
+	slog.Info("rate", "stats", stats)
+	return nil
+}
@@ -0,0 +1,111 @@
+package spike
+
+import (
+	"fmt"
+	"math"
+)
+
+// Event is spike at threshold crossing of filtered signal.
+type Event struct {
+	Sample    int     `json:"sample"`    // of crossing
+	Time      float64 `json:"time"`      // of crossing in seconds
+	Peak      int     `json:"peak"`      // sample of largest filtered value within window after crossing
+	Amplitude float64 `json:"amplitude"` // filtered value at peak
+	Waveform  []int16 `json:"waveform"`  // input from Pre samples before crossing to Post samples after it, clipped at ends
+}
+
+// Events are crossings of samples filtered by band-pass, at first sample of each run over threshold, apart by at least refractory period.
+func Events(config Config, sampleRate float64, samples []uint16) ([]Event, error) {
+	values, err := BandPass(floats(samples), sampleRate, config.LowCut, config.HighCut)
+	if err != nil {
+		return nil, err
+	}
+
+	var events []Event
+	prev := -1 // crossing before
+	for _, i := range crossings(config, values) {
+		if i == prev+1 {
+			prev = i
+			continue
+		}
+		prev = i
+		if n := len(events); n > 0 && i < events[n-1].Sample+config.Refractory {
+			continue
+		}
+
+		e := Event{Sample: i, Peak: i}
+		if sampleRate > 0 {
+			e.Time = float64(i) / sampleRate
+		}
+		for j := i; j < min(len(values), i+config.Post+1); j++ {
+			if math.Abs(values[j]) > math.Abs(values[e.Peak]) {
+				e.Peak = j
+			}
+		}
+		e.Amplitude = values[e.Peak]
+		for _, v := range samples[max(0, i-config.Pre):min(len(samples), i+config.Post+1)] {
+			e.Waveform = append(e.Waveform, int16(v))
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+// BandPass filters values by high-pass at low and low-pass at high Hz, each of second order Butterworth, 0 for none of them.
+func BandPass(values []float64, sampleRate, low, high float64) ([]float64, error) {
+	if low == 0 && high == 0 {
+		return values, nil
+	}
+	if sampleRate <= 0 {
+		return nil, fmt.Errorf("band-pass requires sample rate")
+	}
+	if low < 0 || high < 0 || low >= sampleRate/2 || high >= sampleRate/2 || (high > 0 && low >= high) {
+		return nil, fmt.Errorf("band-pass(%v, %v) is out of bound for sample rate %v", low, high, sampleRate)
+	}
+
+	var filters []biquad
+	if low > 0 {
+		filters = append(filters, highPass(low, sampleRate))
+	}
+	if high > 0 {
+		filters = append(filters, lowPass(high, sampleRate))
+	}
+
+	filtered := make([]float64, len(values))
+	for i, v := range values {
+		for j := range filters {
+			v = filters[j].next(v)
+		}
+		filtered[i] = v
+	}
+	return filtered, nil
+}
+
+// biquad is filter of second order, as in Audio EQ Cookbook by Robert Bristow-Johnson.
+type biquad struct {
+	b0, b1, b2, a1, a2 float64
+	x1, x2, y1, y2     float64
+}
+
+func (s *biquad) next(x float64) float64 {
+	y := s.b0*x + s.b1*s.x1 + s.b2*s.x2 - s.a1*s.y1 - s.a2*s.y2
+	s.x1, s.x2 = x, s.x1
+	s.y1, s.y2 = y, s.y1
+	return y
+}
+
+func newBiquad(b0, b1, b2, a0, a1, a2 float64) biquad {
+	return biquad{b0: b0 / a0, b1: b1 / a0, b2: b2 / a0, a1: a1 / a0, a2: a2 / a0}
+}
+
+func lowPass(cut, sampleRate float64) biquad {
+	w := 2 * math.Pi * cut / sampleRate
+	alpha, cos := math.Sin(w)/math.Sqrt2, math.Cos(w)
+	return newBiquad((1-cos)/2, 1-cos, (1-cos)/2, 1+alpha, -2*cos, 1-alpha)
+}
+
+func highPass(cut, sampleRate float64) biquad {
+	w := 2 * math.Pi * cut / sampleRate
+	alpha, cos := math.Sin(w)/math.Sqrt2, math.Cos(w)
+	return newBiquad((1+cos)/2, -(1 + cos), (1+cos)/2, 1+alpha, -2*cos, 1-alpha)
+}
@@ -0,0 +1,144 @@
+// Package spike detects action potentials as crossings of threshold of noise of signal.
+//
+// Noise of each block of samples is median absolute deviation from median, scaled to deviation of normal distribution.
+// Samples are signed 16 bit, as in WAV.
+// Events are crossings of signal filtered by band-pass, apart by at least refractory period, with waveform of input around them.
+package spike
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"slices"
+)
+
+// madScale is median absolute deviation of standard normal distribution.
+const madScale = 0.6745
+
+type Config struct {
+	Threshold  float64 // in deviations of noise from median
+	Block      int     // samples of each estimate of noise, DefaultConfig.Block when 0
+	Pre        int     // samples of window before crossing
+	Post       int     // samples of window after crossing
+	LowCut     float64 // Hz of high-pass of events, 0 for none
+	HighCut    float64 // Hz of low-pass of events, 0 for none
+	Refractory int     // samples after event in which there is no other event
+}
+
+var DefaultConfig = Config{Threshold: 5, Block: 1 << 12, Pre: 16, Post: 32}
+
+// Window is samples around spikes.
+type Window struct {
+	Start int
+	Count int
+}
+
+func (s Window) End() int { return s.Start + s.Count }
+
+// Noise is median and deviation of noise of samples.
+func Noise(samples []uint16) (median, sigma float64) { return noise(floats(samples)) }
+
+func noise(values []float64) (median, sigma float64) {
+	if len(values) == 0 {
+		return 0, 0
+	}
+
+	values = slices.Clone(values)
+	median = medianOf(values)
+
+	for i, v := range values {
+		values[i] = math.Abs(v - median)
+	}
+	return median, medianOf(values) / madScale
+}
+
+func medianOf(values []float64) float64 {
+	slices.Sort(values)
+	n := len(values)
+	if n%2 == 1 {
+		return values[n/2]
+	}
+	return (values[n/2-1] + values[n/2]) / 2
+}
+
+// Crossings are samples over threshold of noise of their block.
+// Noise of at least one is used, so that flat signal has crossings only where it changes.
+func Crossings(config Config, samples []uint16) []int { return crossings(config, floats(samples)) }
+
+func crossings(config Config, values []float64) []int {
+	size := config.Block
+	if size <= 0 {
+		size = DefaultConfig.Block
+	}
+
+	var crossings []int
+	for start := 0; start < len(values); start += size {
+		block := values[start:min(start+size, len(values))]
+		median, sigma := noise(block)
+		threshold := config.Threshold * max(sigma, 1)
+		for i, v := range block {
+			if math.Abs(v-median) > threshold {
+				crossings = append(crossings, start+i)
+			}
+		}
+	}
+	return crossings
+}
+
+func floats(samples []uint16) []float64 {
+	values := make([]float64, len(samples))
+	for i, v := range samples {
+		values[i] = float64(int16(v))
+	}
+	return values
+}
+
+// Detect is windows around crossings, windows that overlap or touch are merged.
+func Detect(config Config, samples []uint16) []Window {
+	var windows []Window
+	for _, i := range Crossings(config, samples) {
+		w := Window{Start: max(0, i-config.Pre)}
+		w.Count = min(len(samples), i+config.Post+1) - w.Start
+
+		if n := len(windows); n > 0 && windows[n-1].End() >= w.Start {
+			windows[n-1].Count = max(windows[n-1].End(), w.End()) - windows[n-1].Start
+			continue
+		}
+		windows = append(windows, w)
+	}
+	return windows
+}
+
+// AppendWindows codes windows in order, each by uvarint of samples from end of previous window and uvarint of count.
+func AppendWindows(b []byte, windows []Window) []byte {
+	end := 0
+	for _, w := range windows {
+		b = binary.AppendUvarint(b, uint64(w.Start-end))
+		b = binary.AppendUvarint(b, uint64(w.Count))
+		end = w.End()
+	}
+	return b
+}
+
+// ParseWindows decodes windows coded by AppendWindows.
+func ParseWindows(b []byte) ([]Window, error) {
+	var windows []Window
+	end := 0
+	for len(b) > 0 {
+		gap, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, errors.New("bad start of window")
+		}
+		b = b[n:]
+		count, n := binary.Uvarint(b)
+		if n <= 0 {
+			return nil, errors.New("bad count of window")
+		}
+		b = b[n:]
+
+		w := Window{Start: end + int(gap), Count: int(count)}
+		windows = append(windows, w)
+		end = w.End()
+	}
+	return windows, nil
+}
@@ -0,0 +1,131 @@
+package spike_test
+
+import (
+	"math"
+	"math/rand/v2"
+	"slices"
+	"testing"
+
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/spike"
+)
+
+func noise(r *rand.Rand, n int) []uint16 {
+	samples := make([]uint16, n)
+	for i := range samples {
+		samples[i] = uint16(int16(r.NormFloat64() * 100))
+	}
+	return samples
+}
+
+func TestNoise(t *testing.T) {
+	median, sigma := spike.Noise(noise(rand.New(rand.NewPCG(1, 2)), 10000))
+	if median < -5 || median > 5 || sigma < 95 || sigma > 105 {
+		t.Errorf("median(%f) sigma(%f)", median, sigma)
+	}
+}
+
+func TestDetect(t *testing.T) {
+	samples := noise(rand.New(rand.NewPCG(1, 2)), 10000)
+	spikeValue := int16(-2000)
+	for _, i := range []int{100, 110, 5000, 9990} {
+		samples[i] = uint16(spikeValue)
+	}
+
+	config := spike.Config{Threshold: 6, Block: 1000, Pre: 10, Post: 20}
+	got := spike.Detect(config, samples)
+	exp := []spike.Window{{Start: 90, Count: 41}, {Start: 4990, Count: 31}, {Start: 9980, Count: 20}}
+	if !slices.Equal(got, exp) {
+		t.Errorf("windows(%v) != %v", got, exp)
+	}
+
+	// noise is of default block
+	config.Block = 0
+	if got := spike.Detect(config, samples); !slices.Equal(got, exp) {
+		t.Errorf("windows of default block(%v) != %v", got, exp)
+	}
+}
+
+func TestWindows(t *testing.T) {
+	windows := []spike.Window{{Start: 0, Count: 3}, {Start: 1000, Count: 200}, {Start: 100000, Count: 1}}
+	got, err := spike.ParseWindows(spike.AppendWindows(nil, windows))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !slices.Equal(got, windows) {
+		t.Errorf("windows(%v) != %v", got, windows)
+	}
+
+	if _, err := spike.ParseWindows([]byte{0x80}); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestEvents(t *testing.T) {
+	samples := noise(rand.New(rand.NewPCG(1, 2)), 10000)
+	spikeValue := int16(-2000)
+	for _, i := range []int{100, 101, 110, 5000, 9990} {
+		samples[i] = uint16(spikeValue)
+	}
+
+	config := spike.Config{Threshold: 6, Block: 1000, Pre: 10, Post: 20, Refractory: 20}
+	events, err := spike.Events(config, 1000, samples)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got []int
+	for _, e := range events {
+		got = append(got, e.Sample)
+	}
+	if exp := []int{100, 5000, 9990}; !slices.Equal(got, exp) {
+		t.Fatalf("events(%v) != %v", got, exp)
+	}
+
+	if e := events[1]; e.Time != 5 || e.Peak != 5000 || e.Amplitude != -2000 || len(e.Waveform) != 31 || e.Waveform[10] != spikeValue {
+		t.Errorf("event(%+v)", e)
+	}
+	if n := len(events[2].Waveform); n != 20 {
+		t.Errorf("waveform at end(%d) != 20", n)
+	}
+}
+
+func TestBandPass(t *testing.T) {
+	const sampleRate = 20000
+	sine := func(hz float64) []float64 {
+		values := make([]float64, sampleRate)
+		for i := range values {
+			values[i] = 1000 * math.Sin(2*math.Pi*hz*float64(i)/sampleRate)
+		}
+		return values
+	}
+	amplitude := func(values []float64) (a float64) {
+		for _, v := range values[len(values)/2:] {
+			a = max(a, math.Abs(v))
+		}
+		return a
+	}
+
+	tests := []struct {
+		hz       float64
+		min, max float64
+	}{
+		{hz: 10, max: 10},
+		{hz: 1000, min: 900, max: 1010},
+		{hz: 9000, max: 200},
+	}
+	for _, tc := range tests {
+		filtered, err := spike.BandPass(sine(tc.hz), sampleRate, 300, 3000)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if a := amplitude(filtered); a < tc.min || a > tc.max {
+			t.Errorf("%v Hz: amplitude(%f) is not in [%f, %f]", tc.hz, a, tc.min, tc.max)
+		}
+	}
+
+	for _, cut := range [][2]float64{{3000, 300}, {300, 10000}, {-1, 0}} {
+		if _, err := spike.BandPass(sine(10), sampleRate, cut[0], cut[1]); err == nil {
+			t.Errorf("%v: expected error", cut)
+		}
+	}
+}
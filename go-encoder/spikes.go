@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/cache"
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/container"
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/spike"
+)
+
+// Distortion is error of decoded samples of segments of one type.
+type Distortion struct {
+	Segment         string
+	NumSegments     int
+	NumSamples      int
+	MaxError        int
+	RMSE            float64
+	NumExtraMarkers int // of samples of segment, that end before buffer of encoder is full at end of segment
+}
+
+// readAllSamples reads samples until there is no more of them.
+func readAllSamples(r SampleReader) ([]uint16, error) {
+	var samples []uint16
+	buf := make([]uint16, 1<<12)
+	for {
+		n, err := r.ReadSamples(buf)
+		samples = append(samples, buf[:n]...)
+		if err == io.EOF {
+			return samples, nil
+		}
+		if err != nil {
+			return samples, err
+		}
+	}
+}
+
+// segmentDistortion is distortion of spike windows and of baseline between them.
+func segmentDistortion(original, decoded []uint16, windows []spike.Window) [2]Distortion {
+	d := [2]Distortion{{Segment: "spike", NumSegments: len(windows)}, {Segment: "baseline"}}
+	var sumSquared [2]float64
+
+	add := func(segment, start, end int) {
+		if start >= end {
+			return
+		}
+		if segment == 1 {
+			d[1].NumSegments++
+		}
+		for i := start; i < end; i++ {
+			e := int(int16(decoded[i])) - int(int16(original[i]))
+			d[segment].MaxError = max(d[segment].MaxError, e, -e)
+			sumSquared[segment] += float64(e * e)
+		}
+		d[segment].NumSamples += end - start
+	}
+
+	end := 0
+	for _, w := range windows {
+		add(1, end, w.Start)
+		add(0, w.Start, w.End())
+		end = w.End()
+	}
+	add(1, end, len(original))
+
+	for i := range d {
+		if d[i].NumSamples > 0 {
+			d[i].RMSE = math.Sqrt(sumSquared[i] / float64(d[i].NumSamples))
+		}
+	}
+	return d
+}
+
+// encodeSpikes encodes samples of spike windows losslessly, and samples between them within max error.
+// Windows are in stream, and distortion of each type of segment is reported.
+func encodeSpikes(config spike.Config, codec Codec, encoderConfig CacheSampleEncoderConfig, cacheConfig cache.Config, inputConfig InputConfig, r io.Reader, w *bufio.Writer) error {
+	sampleReader, header, err := newSampleReader(inputConfig, r)
+	if err != nil {
+		return err
+	}
+	// noise and windows of interleaved channels would be mixed
+	if _, numChannels := sampleLayout(sampleReader); numChannels > 1 {
+		return fmt.Errorf("spikes require single channel, got %d", numChannels)
+	}
+	samples, err := readAllSamples(sampleReader)
+	if err != nil {
+		return err
+	}
+
+	windows := spike.Detect(config, samples)
+	sections := append(streamSections(encoderConfig, codec), container.Section{Kind: container.SectionSpikes, Data: spike.AppendWindows(nil, windows)})
+
+	var b bytes.Buffer
+	if err := writeStreamHeader(header, &b, sections...); err != nil {
+		return err
+	}
+
+	baselineError := encoderConfig.MaxError
+	encoder, ok := codec.NewEncoder(encoderConfig, cacheConfig, &b).(*CacheSampleEncoder)
+	if !ok {
+		return errors.New("spikes require codec of cache")
+	}
+
+	// marker of segment ends at its end, when encoder has samples of segment buffered
+	var extraMarkers [2]int
+	setMaxError := func(segment, maxError int) error {
+		n := encoder.Stats().NumFlushesByMaxError
+		if err := encoder.SetMaxError(maxError); err != nil {
+			return err
+		}
+		extraMarkers[segment] += encoder.Stats().NumFlushesByMaxError - n
+		return nil
+	}
+
+	next := 0 // window
+	for i, v := range samples {
+		if next < len(windows) && i == windows[next].Start {
+			if err := setMaxError(1, 0); err != nil {
+				return err
+			}
+		}
+		if next < len(windows) && i == windows[next].End() {
+			if err := setMaxError(0, baselineError); err != nil {
+				return err
+			}
+			next++
+		}
+		if err := encoder.Write(v); err != nil {
+			return err
+		}
+	}
+	if err := finishEncode(encoderConfig, encoder, sampleReader.Trailer(), &b); err != nil {
+		return err
+	}
+
+	// distortion is of samples as decoder makes them
+	decoded, err := decodeBytes(encoderConfig, cacheConfig, b.Bytes())
+	if err != nil {
+		return err
+	}
+	decodedReader, _, err := newSampleReader(inputConfig, bytes.NewReader(decoded))
+	if err != nil {
+		return err
+	}
+	decodedSamples, err := readAllSamples(decodedReader)
+	if err != nil {
+		return err
+	}
+	if len(decodedSamples) != len(samples) {
+		return errors.New("number of decoded samples is different from input")
+	}
+	for i, d := range segmentDistortion(samples, decodedSamples, windows) {
+		d.NumExtraMarkers = extraMarkers[i]
+		slog.Info("distortion", "segment", d.Segment, "segments", d.NumSegments, "samples", d.NumSamples, "max_error", d.MaxError, "rmse", d.RMSE, "extra_markers", d.NumExtraMarkers)
+	}
+
+	_, err = w.Write(b.Bytes())
+	return err
+}
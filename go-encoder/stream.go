@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/cache"
+)
+
+// StreamConfig is bound of delay of samples in streaming encoder.
+type StreamConfig struct {
+	MaxLatency     int           // samples, 0 for EncodedSeqMaxLen
+	MaxLatencyTime time.Duration // 0 for none, else samples are flushed at least this often, and it bounds samples by sample rate of input
+}
+
+// maxLatencySamples is number of samples after which frame is flushed.
+func (s StreamConfig) maxLatencySamples(sampleRate float64, numChannels int, seqMaxLen int) int {
+	n := seqMaxLen
+	if s.MaxLatency > 0 {
+		n = min(n, s.MaxLatency)
+	}
+	if s.MaxLatencyTime > 0 && sampleRate > 0 {
+		n = min(n, max(1, int(s.MaxLatencyTime.Seconds()*sampleRate*float64(max(1, numChannels)))))
+	}
+	return n
+}
+
+// encodeStream encodes samples as they arrive from input.
+// Each frame is flushed to w once it has max latency samples, or once max latency time passes with samples pending.
+// Frame ends at marker, so decoder emits all samples of frame as soon as it arrives.
+func encodeStream(config StreamConfig, codec Codec, encoderConfig CacheSampleEncoderConfig, cacheConfig cache.Config, inputConfig InputConfig, r io.Reader, w *bufio.Writer) error {
+	if encoderConfig.KeyframeInterval > 0 && !supportsKeyframes(codec, encoderConfig, cacheConfig) {
+		return fmt.Errorf("codec %s does not support keyframes", codec.Name())
+	}
+
+	sampleReader, header, err := newSampleReader(inputConfig, r)
+	if err != nil {
+		return err
+	}
+	if err := writeStreamHeader(header, w, streamSections(encoderConfig, codec)...); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	sampleRate, numChannels := sampleLayout(sampleReader)
+	maxLatency := config.maxLatencySamples(sampleRate, numChannels, encoderConfig.EncodedSeqMaxLen)
+	slog.Info("stream", "max_latency_samples", maxLatency, "max_latency_time", config.MaxLatencyTime)
+
+	// samples are read one by one, so that each of them is encoded as soon as it is in input
+	// reader stops once encoder returns, reader that waits for input is left until input is closed
+	samples := make(chan uint16, maxLatency)
+	errc := make(chan error, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		defer close(samples)
+		p := make([]uint16, 1)
+		for {
+			n, err := sampleReader.ReadSamples(p)
+			if n > 0 {
+				select {
+				case samples <- p[0]:
+				case <-done:
+					return
+				}
+			}
+			if err == io.EOF {
+				errc <- nil
+				return
+			}
+			if err != nil {
+				errc <- err
+				return
+			}
+		}
+	}()
+
+	var tick <-chan time.Time
+	if config.MaxLatencyTime > 0 {
+		ticker := time.NewTicker(config.MaxLatencyTime)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	encoder := codec.NewEncoder(encoderConfig, cacheConfig, w)
+
+	pending := 0
+	flush := func() error {
+		pending = 0
+		if err := encoder.FlushBuffer(); err != nil {
+			return err
+		}
+		return w.Flush()
+	}
+
+	for samples != nil {
+		select {
+		case sample, ok := <-samples:
+			if !ok {
+				samples = nil
+				break
+			}
+			if err := encoder.Write(sample); err != nil {
+				return err
+			}
+			if pending++; pending >= maxLatency {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		case <-tick:
+			if pending > 0 {
+				if err := flush(); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	if err := <-errc; err != nil {
+		return err
+	}
+
+	return finishEncode(encoderConfig, encoder, sampleReader.Trailer(), w)
+}
@@ -0,0 +1,255 @@
+// Package substream splits markers of cache codec into streams of similar statistics, to compress each by its own backend.
+//
+// Streams are markers, packed keys of each encoding size, and not encoded samples.
+// Joining them back restores markers as they were.
+package substream
+
+import (
+	"bytes"
+	"compress/flate"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/bits"
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/container"
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/encoding"
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/huffman"
+)
+
+type Stream uint8
+
+const (
+	StreamMarkers Stream = iota
+	StreamPacked4
+	StreamPacked6
+	StreamPacked7
+	StreamRaw
+	NumStreams
+)
+
+func (s Stream) String() string {
+	switch s {
+	case StreamMarkers:
+		return "markers"
+	case StreamPacked4:
+		return "packed4"
+	case StreamPacked6:
+		return "packed6"
+	case StreamPacked7:
+		return "packed7"
+	case StreamRaw:
+		return "raw"
+	default:
+		return fmt.Sprintf("Stream(%d)", uint8(s))
+	}
+}
+
+var packedStream = map[int]Stream{4: StreamPacked4, 6: StreamPacked6, 7: StreamPacked7}
+
+// Split reads markers until zero marker or end of r.
+func Split(r io.Reader, byteOrder binary.ByteOrder) (streams [NumStreams][]byte, err error) {
+	var bufs [NumStreams]bytes.Buffer
+	for {
+		var marker encoding.Marker
+		if err := marker.UnmarshalBinaryFromReader(r, byteOrder); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return streams, err
+		}
+		if err := marker.MarshalBinaryToWriter(&bufs[StreamMarkers], byteOrder); err != nil {
+			return streams, err
+		}
+
+		stream, size := StreamRaw, marker.Count*2
+		if marker.IsEncoded {
+			packer := bits.Packers[marker.EncodingSize]
+			stream, size = packedStream[marker.EncodingSize], (marker.Count/packer.UnpackedLen())*packer.PackedLen()
+		}
+		if _, err := io.CopyN(&bufs[stream], r, int64(size)); err != nil {
+			if err == io.EOF {
+				return streams, io.ErrUnexpectedEOF
+			}
+			return streams, err
+		}
+	}
+
+	for i := range streams {
+		streams[i] = bufs[i].Bytes()
+	}
+	return streams, nil
+}
+
+// Join interleaves streams back into markers, without zero marker.
+func Join(streams [NumStreams][]byte, byteOrder binary.ByteOrder) ([]byte, error) {
+	var readers [NumStreams]*bytes.Reader
+	for i, b := range streams {
+		readers[i] = bytes.NewReader(b)
+	}
+
+	var out bytes.Buffer
+	for readers[StreamMarkers].Len() > 0 {
+		var marker encoding.Marker
+		if err := marker.UnmarshalBinaryFromReader(readers[StreamMarkers], byteOrder); err != nil {
+			if err == io.EOF {
+				return nil, errors.New("zero marker in stream of markers")
+			}
+			return nil, err
+		}
+		if err := marker.MarshalBinaryToWriter(&out, byteOrder); err != nil {
+			return nil, err
+		}
+
+		stream, size := StreamRaw, marker.Count*2
+		if marker.IsEncoded {
+			packer := bits.Packers[marker.EncodingSize]
+			stream, size = packedStream[marker.EncodingSize], (marker.Count/packer.UnpackedLen())*packer.PackedLen()
+		}
+		if _, err := io.CopyN(&out, readers[stream], int64(size)); err != nil {
+			return nil, fmt.Errorf("stream %s: %w", stream, io.ErrUnexpectedEOF)
+		}
+	}
+
+	for i, r := range readers {
+		if r.Len() > 0 {
+			return nil, fmt.Errorf("stream %s has %d bytes left", Stream(i), r.Len())
+		}
+	}
+	return out.Bytes(), nil
+}
+
+// Backend compresses stream.
+type Backend uint8
+
+const (
+	BackendNone Backend = iota
+	BackendFlate
+	BackendHuffman
+)
+
+var Backends = []Backend{BackendNone, BackendFlate, BackendHuffman}
+
+func (s Backend) String() string {
+	switch s {
+	case BackendNone:
+		return "none"
+	case BackendFlate:
+		return "flate"
+	case BackendHuffman:
+		return "huffman"
+	default:
+		return fmt.Sprintf("Backend(%d)", uint8(s))
+	}
+}
+
+func ParseBackend(name string) (Backend, error) {
+	for _, q := range Backends {
+		if q.String() == name {
+			return q, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown backend: %s", name)
+}
+
+func Compress(backend Backend, data []byte) ([]byte, error) {
+	switch backend {
+	case BackendNone:
+		return data, nil
+	case BackendFlate:
+		var b bytes.Buffer
+		w, err := flate.NewWriter(&b, flate.BestCompression)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write(data); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		return b.Bytes(), nil
+	case BackendHuffman:
+		return huffman.Encode(data), nil
+	default:
+		return nil, fmt.Errorf("unsupported backend: %s", backend)
+	}
+}
+
+func Decompress(backend Backend, data []byte) ([]byte, error) {
+	switch backend {
+	case BackendNone:
+		return data, nil
+	case BackendFlate:
+		return io.ReadAll(flate.NewReader(bytes.NewReader(data)))
+	case BackendHuffman:
+		return huffman.Decode(data)
+	default:
+		return nil, fmt.Errorf("unsupported backend: %s", backend)
+	}
+}
+
+// CompressBest compresses by backend that makes smallest output.
+func CompressBest(data []byte) (Backend, []byte, error) {
+	best, bestData := BackendNone, data
+	for _, backend := range Backends {
+		b, err := Compress(backend, data)
+		if err != nil {
+			return 0, nil, err
+		}
+		if len(b) < len(bestData) {
+			best, bestData = backend, b
+		}
+	}
+	return best, bestData, nil
+}
+
+// Sections of streams compressed by backend, or by best backend for each stream if best is set.
+func Sections(streams [NumStreams][]byte, backend Backend, best bool) ([]container.Section, error) {
+	var sections []container.Section
+	for i, data := range streams {
+		if len(data) == 0 {
+			continue
+		}
+
+		q, compressed := backend, data
+		var err error
+		if best {
+			q, compressed, err = CompressBest(data)
+		} else {
+			compressed, err = Compress(backend, data)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		sections = append(sections, container.Section{
+			Kind: container.SectionSubstream,
+			Data: append([]byte{byte(i), byte(q)}, compressed...),
+		})
+	}
+	return sections, nil
+}
+
+// FromHeader decompresses streams of sections of header, false if there are none.
+func FromHeader(header container.Header) (streams [NumStreams][]byte, ok bool, err error) {
+	for _, section := range header.Sections {
+		if section.Kind != container.SectionSubstream {
+			continue
+		}
+		ok = true
+
+		if len(section.Data) < 2 {
+			return streams, ok, errors.New("substream section is too short")
+		}
+		stream, backend := Stream(section.Data[0]), Backend(section.Data[1])
+		if stream >= NumStreams {
+			return streams, ok, fmt.Errorf("unknown stream: %s", stream)
+		}
+		if streams[stream], err = Decompress(backend, section.Data[2:]); err != nil {
+			return streams, ok, fmt.Errorf("stream %s: %w", stream, err)
+		}
+	}
+	return streams, ok, nil
+}
@@ -0,0 +1,63 @@
+package substream_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/conformance"
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/container"
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/substream"
+)
+
+func TestSplitJoin(t *testing.T) {
+	for _, v := range conformance.Generate() {
+		t.Run(v.Name, func(t *testing.T) {
+			streams, err := substream.Split(bytes.NewReader(v.Encoded), binary.LittleEndian)
+			if err != nil {
+				t.Fatal(err)
+			}
+			joined, err := substream.Join(streams, binary.LittleEndian)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.HasPrefix(v.Encoded, joined) {
+				t.Error("joined stream is not prefix of encoded stream")
+			}
+
+			for _, backend := range substream.Backends {
+				sections, err := substream.Sections(streams, backend, false)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, ok, err := substream.FromHeader(container.Header{Sections: sections})
+				if err != nil {
+					t.Fatal(backend, err)
+				}
+				if ok != (len(sections) > 0) {
+					t.Error(backend, ok)
+				}
+				for i := range streams {
+					if !bytes.Equal(got[i], streams[i]) {
+						t.Error(backend, substream.Stream(i), "wrong stream")
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestJoin_Truncated(t *testing.T) {
+	v := conformance.Generate()[0]
+	streams, _ := substream.Split(bytes.NewReader(v.Encoded), binary.LittleEndian)
+	for i := range streams {
+		if len(streams[i]) == 0 {
+			continue
+		}
+		s := streams
+		s[i] = s[i][:len(s[i])-1]
+		if _, err := substream.Join(s, binary.LittleEndian); err == nil {
+			t.Errorf("%s: expected error", substream.Stream(i))
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/cache"
+)
+
+// VerifyResult is error of decoded samples from original ones.
+type VerifyResult struct {
+	NumSamples int
+	NumChanged int
+	MaxError   int // of bound
+	MaxDiff    int // of samples
+	RMSE       float64
+}
+
+func (s VerifyResult) String() string {
+	return fmt.Sprintf("samples %d changed %d max error %d bound %d rmse %.3f", s.NumSamples, s.NumChanged, s.MaxDiff, s.MaxError, s.RMSE)
+}
+
+// verifySamples compares decoded samples with original ones, as signed, it fails when any of them is not within max error.
+func verifySamples(original, decoded SampleReader, maxError int) (VerifyResult, error) {
+	result := VerifyResult{MaxError: maxError}
+	var sumSquared float64
+
+	a, b := make([]uint16, 1<<12), make([]uint16, 1<<12)
+	for {
+		n, errA := readFull(original, a)
+		m, errB := readFull(decoded, b)
+		if errA != nil && errA != io.EOF {
+			return result, errA
+		}
+		if errB != nil && errB != io.EOF {
+			return result, errB
+		}
+
+		for i := range min(n, m) {
+			d := int(int16(b[i])) - int(int16(a[i]))
+			if d < -maxError || d > maxError {
+				return result, fmt.Errorf("sample %d: error(%d) is over max error(%d)", result.NumSamples+i, d, maxError)
+			}
+			if d != 0 {
+				result.NumChanged++
+			}
+			result.MaxDiff = max(result.MaxDiff, d, -d)
+			sumSquared += float64(d * d)
+		}
+		result.NumSamples += min(n, m)
+
+		if n != m {
+			return result, fmt.Errorf("number of decoded samples is different from original after sample %d", result.NumSamples)
+		}
+		if errA == io.EOF || errB == io.EOF {
+			break
+		}
+	}
+
+	if result.NumSamples > 0 {
+		result.RMSE = math.Sqrt(sumSquared / float64(result.NumSamples))
+	}
+	return result, nil
+}
+
+// verifyStream decodes stream and compares its samples with original, within max error, or within max error of stream if it is zero.
+func verifyStream(maxError int, encoderConfig CacheSampleEncoderConfig, cacheConfig cache.Config, inputConfig InputConfig, original io.Reader, r io.Reader) (VerifyResult, error) {
+	encoded, err := io.ReadAll(r)
+	if err != nil {
+		return VerifyResult{}, err
+	}
+
+	if maxError == 0 {
+		header, err := ReadStreamHeader(bufio.NewReader(bytes.NewReader(encoded)))
+		if err != nil {
+			return VerifyResult{}, err
+		}
+		if maxError, err = header.MaxError(); err != nil {
+			return VerifyResult{}, err
+		}
+	}
+
+	decoded, err := decodeBytes(encoderConfig, cacheConfig, encoded)
+	if err != nil {
+		return VerifyResult{}, err
+	}
+
+	originalReader, _, err := newSampleReader(inputConfig, original)
+	if err != nil {
+		return VerifyResult{}, err
+	}
+	if maxError > 0 && !isInt16(originalReader) {
+		return VerifyResult{}, fmt.Errorf("max error requires signed 16 bit samples, which %s input does not have", inputConfig.Format)
+	}
+	decodedReader, _, err := newSampleReader(inputConfig, bytes.NewReader(decoded))
+	if err != nil {
+		return VerifyResult{}, err
+	}
+	return verifySamples(originalReader, decodedReader, maxError)
+}
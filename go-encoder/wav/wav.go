@@ -1,16 +1,25 @@
 package wav
 
 import (
+	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"io"
+	"math"
 )
 
+// SampleSize is number of bytes in single sample, only 16 bits per sample are supported.
+const SampleSize = 2
+
+var ErrPartialSample = errors.New("partial sample")
+
 type WAVHeader struct {
-	ChunkID       [4]byte // RIFF chunk descriptor
+	ChunkID       [4]byte // RIFF chunk descriptor, RF64 or BW64 for files over 4GiB
 	ChunkSize     uint32
 	Format        [4]byte
-	Subchunk1ID   [4]byte // "fmt" sub-chunk
+	DS64          DS64Chunk // "ds64" sub-chunk, only in RF64 and BW64
+	Subchunk1ID   [4]byte   // "fmt" sub-chunk
 	Subchunk1Size uint32
 	AudioFormat   uint16
 	NumChannels   uint16
@@ -22,23 +31,171 @@ type WAVHeader struct {
 	Subchunk2Size uint32
 }
 
+// DS64Chunk holds 64 bit sizes of RF64 and BW64 files, 32 bit sizes are set to 0xFFFFFFFF then.
+// EBU Tech 3306 and ITU-R BS.2088.
+type DS64Chunk struct {
+	ID          [4]byte
+	Size        uint32
+	RIFFSize    uint64
+	DataSize    uint64
+	SampleCount uint64
+	Table       []DS64TableEntry
+	Extra       []byte // bytes after table, if chunk is larger than its table
+}
+
+type DS64TableEntry struct {
+	ChunkID   [4]byte
+	ChunkSize uint64
+}
+
+const (
+	ds64FixedSize      = 28
+	ds64TableEntrySize = 12
+	fmtAndDataSize     = 32
+)
+
+var (
+	riffID = [4]byte{'R', 'I', 'F', 'F'}
+	rf64ID = [4]byte{'R', 'F', '6', '4'}
+	bw64ID = [4]byte{'B', 'W', '6', '4'}
+	ds64ID = [4]byte{'d', 's', '6', '4'}
+)
+
+// NewWAVHeader is header of PCM of 16 bits per sample, sizes are set by SetDataSize.
+func NewWAVHeader(sampleRate uint32, numChannels uint16) WAVHeader {
+	s := WAVHeader{
+		ChunkID:       riffID,
+		Format:        [4]byte{'W', 'A', 'V', 'E'},
+		Subchunk1ID:   [4]byte{'f', 'm', 't', ' '},
+		Subchunk1Size: 16,
+		AudioFormat:   1,
+		NumChannels:   numChannels,
+		SampleRate:    sampleRate,
+		ByteRate:      sampleRate * uint32(numChannels) * SampleSize,
+		BlockAlign:    numChannels * SampleSize,
+		BitsPerSample: 8 * SampleSize,
+		Subchunk2ID:   [4]byte{'d', 'a', 't', 'a'},
+	}
+	s.SetDataSize(0)
+	return s
+}
+
 func (s WAVHeader) IsPCM() bool { return s.AudioFormat == 1 }
 
-func (s *WAVHeader) MarshalBinary(w io.Writer) error { return binary.Write(w, binary.LittleEndian, s) }
+func (s WAVHeader) IsRF64() bool { return s.ChunkID == rf64ID || s.ChunkID == bw64ID }
+
+// DataSize is size of data chunk in bytes.
+func (s WAVHeader) DataSize() uint64 {
+	if s.IsRF64() && s.Subchunk2Size == math.MaxUint32 {
+		return s.DS64.DataSize
+	}
+	return uint64(s.Subchunk2Size)
+}
+
+// Size is size of header in bytes.
+func (s WAVHeader) Size() int {
+	n := 12 + fmtAndDataSize
+	if s.IsRF64() {
+		n += 8 + int(s.DS64.Size)
+	}
+	return n
+}
+
+// SetDataSize updates sizes for data chunk of n bytes.
+// Header is converted to RF64 when sizes do not fit into 32 bits.
+func (s *WAVHeader) SetDataSize(n uint64) {
+	if !s.IsRF64() && (uint64(s.Size())+n-8) <= math.MaxUint32 {
+		s.Subchunk2Size = uint32(n)
+		s.ChunkSize = uint32(uint64(s.Size()) + n - 8)
+		return
+	}
+
+	if !s.IsRF64() {
+		s.ChunkID = rf64ID
+	}
+	if s.DS64.ID != ds64ID {
+		s.DS64 = DS64Chunk{ID: ds64ID, Size: ds64FixedSize}
+	}
+
+	s.ChunkSize = math.MaxUint32
+	s.Subchunk2Size = math.MaxUint32
+	s.DS64.RIFFSize = uint64(s.Size()) + n - 8
+	s.DS64.DataSize = n
+	if s.BlockAlign > 0 {
+		s.DS64.SampleCount = n / uint64(s.BlockAlign)
+	}
+}
+
+func (s *WAVHeader) MarshalBinary(w io.Writer) error {
+	if err := binary.Write(w, binary.LittleEndian, struct {
+		ChunkID   [4]byte
+		ChunkSize uint32
+		Format    [4]byte
+	}{s.ChunkID, s.ChunkSize, s.Format}); err != nil {
+		return err
+	}
+
+	if s.IsRF64() {
+		if err := s.DS64.MarshalBinary(w); err != nil {
+			return err
+		}
+	}
+
+	return binary.Write(w, binary.LittleEndian, struct {
+		Subchunk1ID   [4]byte
+		Subchunk1Size uint32
+		AudioFormat   uint16
+		NumChannels   uint16
+		SampleRate    uint32
+		ByteRate      uint32
+		BlockAlign    uint16
+		BitsPerSample uint16
+		Subchunk2ID   [4]byte
+		Subchunk2Size uint32
+	}{
+		s.Subchunk1ID, s.Subchunk1Size,
+		s.AudioFormat, s.NumChannels, s.SampleRate, s.ByteRate, s.BlockAlign, s.BitsPerSample,
+		s.Subchunk2ID, s.Subchunk2Size,
+	})
+}
 
 func (s *WAVHeader) UnmarshalBinary(r io.Reader) error {
-	if err := binary.Read(r, binary.LittleEndian, s); err != nil {
+	if err := binary.Read(r, binary.LittleEndian, &s.ChunkID); err != nil {
 		return err
 	}
 
-	if s.ChunkID != [4]byte{'R', 'I', 'F', 'F'} {
-		return fmt.Errorf("invalid chunk ID: (%s) != RIFF", s.ChunkID)
+	if s.ChunkID != riffID && !s.IsRF64() {
+		return fmt.Errorf("invalid chunk ID: (%s) != RIFF, RF64, BW64", s.ChunkID)
+	}
+
+	if err := binary.Read(r, binary.LittleEndian, &s.ChunkSize); err != nil {
+		return err
+	}
+
+	if err := binary.Read(r, binary.LittleEndian, &s.Format); err != nil {
+		return err
 	}
 
 	if s.Format != [4]byte{'W', 'A', 'V', 'E'} {
 		return fmt.Errorf("invalid format: (%s) != WAVE", s.Format)
 	}
 
+	if s.IsRF64() {
+		if err := s.DS64.UnmarshalBinary(r); err != nil {
+			return err
+		}
+	}
+
+	for _, v := range []any{
+		&s.Subchunk1ID, &s.Subchunk1Size,
+		&s.AudioFormat, &s.NumChannels, &s.SampleRate, &s.ByteRate, &s.BlockAlign, &s.BitsPerSample,
+		&s.Subchunk2ID, &s.Subchunk2Size,
+	} {
+		if err := binary.Read(r, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+
 	if s.Subchunk1ID != [4]byte{'f', 'm', 't', ' '} {
 		return fmt.Errorf("invalid subchunk1 ID: (%s) != fmt", s.Subchunk1ID)
 	}
@@ -50,38 +207,201 @@ func (s *WAVHeader) UnmarshalBinary(r io.Reader) error {
 	return nil
 }
 
+func (s *DS64Chunk) MarshalBinary(w io.Writer) error {
+	if int(s.Size) != ds64FixedSize+ds64TableEntrySize*len(s.Table)+len(s.Extra) {
+		return fmt.Errorf("ds64 size(%d) does not match table length(%d) and extra bytes(%d)", s.Size, len(s.Table), len(s.Extra))
+	}
+
+	for _, v := range []any{s.ID, s.Size, s.RIFFSize, s.DataSize, s.SampleCount, uint32(len(s.Table)), s.Table} {
+		if err := binary.Write(w, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+
+	_, err := w.Write(s.Extra)
+	return err
+}
+
+func (s *DS64Chunk) UnmarshalBinary(r io.Reader) error {
+	if err := binary.Read(r, binary.LittleEndian, &s.ID); err != nil {
+		return err
+	}
+
+	if s.ID != ds64ID {
+		return fmt.Errorf("invalid ds64 chunk ID: (%s) != ds64", s.ID)
+	}
+
+	var tableLength uint32
+	for _, v := range []any{&s.Size, &s.RIFFSize, &s.DataSize, &s.SampleCount, &tableLength} {
+		if err := binary.Read(r, binary.LittleEndian, v); err != nil {
+			return err
+		}
+	}
+
+	if uint64(s.Size) < ds64FixedSize+ds64TableEntrySize*uint64(tableLength) {
+		return fmt.Errorf("ds64 size(%d) is too small for table length(%d)", s.Size, tableLength)
+	}
+
+	// sizes are not trusted, so table and extra bytes grow only as they are read
+	s.Table = nil
+	for range tableLength {
+		var entry DS64TableEntry
+		if err := binary.Read(r, binary.LittleEndian, &entry); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+		s.Table = append(s.Table, entry)
+	}
+
+	var extra bytes.Buffer
+	if _, err := io.CopyN(&extra, r, int64(s.Size)-ds64FixedSize-ds64TableEntrySize*int64(tableLength)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	s.Extra = extra.Bytes()
+	return nil
+}
+
+// WAVReader reads samples from data chunk.
+// Reading stops at end of data chunk, chunks after it are available in Trailer.
 type WAVReader struct {
-	Header WAVHeader
-	r      io.Reader
+	Header    WAVHeader
+	r         io.Reader
+	remaining int64
+	buf       []byte
 }
 
 func NewWAVReader(r io.Reader) *WAVReader { return &WAVReader{r: r} }
 
-func (s *WAVReader) ReadHeader() error { return s.Header.UnmarshalBinary(s.r) }
+func (s *WAVReader) ReadHeader() error {
+	if err := s.Header.UnmarshalBinary(s.r); err != nil {
+		return err
+	}
+	if n := s.Header.DataSize(); n > math.MaxInt64 {
+		return fmt.Errorf("data size(%d) is too large", n)
+	}
+	s.remaining = int64(s.Header.DataSize())
+	return nil
+}
+
+// Remaining is number of bytes left to read in data chunk.
+func (s *WAVReader) Remaining() int64 { return s.remaining }
+
+// Trailer is everything after data chunk.
+// It is valid only after all samples have been read.
+func (s *WAVReader) Trailer() io.Reader { return s.r }
 
 func (s *WAVReader) Next() (uint16, error) {
-	var sample uint16
-	if err := binary.Read(s.r, binary.LittleEndian, &sample); err != nil {
+	var sample [1]uint16
+	if _, err := s.ReadSamples(sample[:]); err != nil {
 		return 0, err
 	}
-	return sample, nil
+	return sample[0], nil
+}
+
+// ReadSamples reads up to len(p) samples.
+// It returns io.EOF when data chunk has no more samples.
+func (s *WAVReader) ReadSamples(p []uint16) (int, error) {
+	b, err := s.readSampleBytes(len(p))
+	for i := range len(b) / SampleSize {
+		p[i] = binary.LittleEndian.Uint16(b[i*SampleSize:])
+	}
+	return len(b) / SampleSize, err
 }
 
-// TODO: correct wrapping bytes into samples
-func (s *WAVReader) Read(p []byte) (int, error) { return s.r.Read(p) }
+// ReadInt16Samples reads up to len(p) samples.
+// It returns io.EOF when data chunk has no more samples.
+func (s *WAVReader) ReadInt16Samples(p []int16) (int, error) {
+	b, err := s.readSampleBytes(len(p))
+	for i := range len(b) / SampleSize {
+		p[i] = int16(binary.LittleEndian.Uint16(b[i*SampleSize:]))
+	}
+	return len(b) / SampleSize, err
+}
+
+func (s *WAVReader) readSampleBytes(numSamples int) ([]byte, error) {
+	if numSamples == 0 {
+		return nil, nil
+	}
+
+	n := int64(numSamples) * SampleSize
+	if n > s.remaining {
+		n = s.remaining - (s.remaining % SampleSize)
+	}
+	if n == 0 {
+		if s.remaining > 0 {
+			return nil, ErrPartialSample
+		}
+		return nil, io.EOF
+	}
+
+	if int64(cap(s.buf)) < n {
+		s.buf = make([]byte, n)
+	}
+	b := s.buf[:n]
+
+	k, err := io.ReadFull(s.r, b)
+	s.remaining -= int64(k)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return b[:k-(k%SampleSize)], err
+}
+
+// Read reads bytes of data chunk, only whole samples are read.
+func (s *WAVReader) Read(p []byte) (int, error) {
+	if len(p) < SampleSize {
+		return 0, io.ErrShortBuffer
+	}
+	b, err := s.readSampleBytes(len(p) / SampleSize)
+	return copy(p, b), err
+}
 
 type WAVWriter struct {
 	header WAVHeader
 	w      io.Writer
+	buf    []byte
 }
 
 func NewWAVWriter(h WAVHeader, w io.Writer) *WAVWriter { return &WAVWriter{header: h, w: w} }
 
 func (s *WAVWriter) WriteHeader() error { return s.header.MarshalBinary(s.w) }
 
-func (s *WAVWriter) WriteSample(sample uint16) error {
-	return binary.Write(s.w, binary.LittleEndian, sample)
+func (s *WAVWriter) WriteSample(sample uint16) error { return s.WriteSamples([]uint16{sample}) }
+
+func (s *WAVWriter) WriteSamples(p []uint16) error {
+	b := s.sampleBytes(len(p))
+	for i, v := range p {
+		binary.LittleEndian.PutUint16(b[i*SampleSize:], v)
+	}
+	_, err := s.w.Write(b)
+	return err
+}
+
+func (s *WAVWriter) WriteInt16Samples(p []int16) error {
+	b := s.sampleBytes(len(p))
+	for i, v := range p {
+		binary.LittleEndian.PutUint16(b[i*SampleSize:], uint16(v))
+	}
+	_, err := s.w.Write(b)
+	return err
+}
+
+func (s *WAVWriter) sampleBytes(numSamples int) []byte {
+	if cap(s.buf) < numSamples*SampleSize {
+		s.buf = make([]byte, numSamples*SampleSize)
+	}
+	return s.buf[:numSamples*SampleSize]
 }
 
-// TODO: correct wrapping bytes into samples
-func (s *WAVWriter) Write(b []byte) (int, error) { return s.w.Write(b) }
+// Write writes bytes of data chunk, only whole samples are accepted.
+func (s *WAVWriter) Write(b []byte) (int, error) {
+	if len(b)%SampleSize != 0 {
+		return 0, ErrPartialSample
+	}
+	return s.w.Write(b)
+}
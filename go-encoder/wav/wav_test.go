@@ -2,8 +2,11 @@ package wav_test
 
 import (
 	"bytes"
+	"encoding/binary"
 	"io"
+	"math"
 	"os"
+	"runtime"
 	"testing"
 
 	"github.com/nikolaydubina/neuralink-compression-challenge/go-encoder/wav"
@@ -53,3 +56,180 @@ func TestWAVReaderWriter(t *testing.T) {
 		}
 	})
 }
+
+func newHeader(dataSize uint32) wav.WAVHeader {
+	header := wav.NewWAVHeader(19531, 1)
+	header.SetDataSize(uint64(dataSize))
+	return header
+}
+
+func TestWAVReader_TrailingChunk(t *testing.T) {
+	header := newHeader(6)
+	trailer := []byte("LIST\x04\x00\x00\x00INFO")
+
+	var b bytes.Buffer
+	w := wav.NewWAVWriter(header, &b)
+	w.WriteHeader()
+	w.WriteInt16Samples([]int16{1, -2, 3})
+	b.Write(trailer)
+
+	r := wav.NewWAVReader(&b)
+	if err := r.ReadHeader(); err != nil {
+		t.Fatal(err)
+	}
+	if r.Remaining() != 6 {
+		t.Errorf("remaining %d", r.Remaining())
+	}
+
+	samples := make([]int16, 10)
+	n, err := r.ReadInt16Samples(samples)
+	if err != nil {
+		t.Error(err)
+	}
+	if n != 3 || samples[0] != 1 || samples[1] != -2 || samples[2] != 3 {
+		t.Errorf("wrong samples: %v", samples[:n])
+	}
+
+	if n, err := r.ReadInt16Samples(samples); n != 0 || err != io.EOF {
+		t.Errorf("expected EOF at end of data chunk, got %d %v", n, err)
+	}
+
+	got, _ := io.ReadAll(r.Trailer())
+	if !bytes.Equal(got, trailer) {
+		t.Errorf("trailer: exp(%q) != got(%q)", trailer, got)
+	}
+}
+
+func TestWAVReader_Read(t *testing.T) {
+	var b bytes.Buffer
+	header := newHeader(6)
+	header.MarshalBinary(&b)
+	b.Write([]byte{1, 2, 3, 4, 5, 6, 7, 8})
+
+	r := wav.NewWAVReader(&b)
+	if err := r.ReadHeader(); err != nil {
+		t.Fatal(err)
+	}
+
+	p := make([]byte, 5)
+	n, _ := r.Read(p)
+	if n != 4 {
+		t.Errorf("expected only whole samples, got %d bytes", n)
+	}
+	n, _ = r.Read(p)
+	if n != 2 {
+		t.Errorf("expected read to stop at end of data chunk, got %d bytes", n)
+	}
+	if _, err := r.Read(p); err != io.EOF {
+		t.Error(err)
+	}
+}
+
+func TestWAVHeader_RF64(t *testing.T) {
+	header := newHeader(0)
+	header.SetDataSize(5 << 30)
+
+	if !header.IsRF64() {
+		t.Fatal("expected RF64 for data over 4GiB")
+	}
+	if header.Size() != 80 {
+		t.Errorf("header size %d", header.Size())
+	}
+
+	var b bytes.Buffer
+	if err := header.MarshalBinary(&b); err != nil {
+		t.Fatal(err)
+	}
+	if b.Len() != header.Size() {
+		t.Errorf("written %d bytes, expected %d", b.Len(), header.Size())
+	}
+
+	var got wav.WAVHeader
+	if err := got.UnmarshalBinary(&b); err != nil {
+		t.Fatal(err)
+	}
+	if got.DataSize() != 5<<30 {
+		t.Errorf("data size %d", got.DataSize())
+	}
+	if got.DS64.SampleCount != (5<<30)/2 {
+		t.Errorf("sample count %d", got.DS64.SampleCount)
+	}
+	if got.DS64.RIFFSize != 80+(5<<30)-8 {
+		t.Errorf("riff size %d", got.DS64.RIFFSize)
+	}
+}
+
+func TestWAVReader_BW64(t *testing.T) {
+	header := newHeader(0)
+	header.ChunkID = [4]byte{'B', 'W', '6', '4'}
+	header.SetDataSize(4)
+	header.DS64.Table = []wav.DS64TableEntry{{ChunkID: [4]byte{'a', 'x', 'm', 'l'}, ChunkSize: 1 << 33}}
+	header.DS64.Size += 12
+
+	var b bytes.Buffer
+	w := wav.NewWAVWriter(header, &b)
+	if err := w.WriteHeader(); err != nil {
+		t.Fatal(err)
+	}
+	w.WriteSamples([]uint16{7, 9})
+	exp := bytes.Clone(b.Bytes())
+
+	r := wav.NewWAVReader(&b)
+	if err := r.ReadHeader(); err != nil {
+		t.Fatal(err)
+	}
+	if r.Header.DS64.Table[0].ChunkSize != 1<<33 {
+		t.Errorf("table %v", r.Header.DS64.Table)
+	}
+
+	samples := make([]uint16, 4)
+	if n, _ := r.ReadSamples(samples); n != 2 || samples[0] != 7 || samples[1] != 9 {
+		t.Errorf("wrong samples %v", samples[:n])
+	}
+
+	var got bytes.Buffer
+	w = wav.NewWAVWriter(r.Header, &got)
+	w.WriteHeader()
+	w.WriteSamples(samples[:2])
+	if !bytes.Equal(exp, got.Bytes()) {
+		t.Error("output is not the same")
+	}
+}
+
+func TestWAVReader_HugeDataSize(t *testing.T) {
+	header := newHeader(0)
+	header.ChunkID = [4]byte{'R', 'F', '6', '4'}
+	header.SetDataSize(math.MaxUint64 - 1)
+
+	var b bytes.Buffer
+	header.MarshalBinary(&b)
+	b.Write([]byte{1, 2, 3, 4})
+
+	r := wav.NewWAVReader(&b)
+	if err := r.ReadHeader(); err == nil {
+		t.Errorf("expected error of data size, remaining(%d)", r.Remaining())
+	}
+}
+
+func TestWAVHeader_HugeDS64(t *testing.T) {
+	for _, tableLength := range []uint32{0, 1 << 28} {
+		b := []byte("RF64\xFF\xFF\xFF\xFFWAVEds64")
+		b = binary.LittleEndian.AppendUint32(b, 0xFFFFFFFF)
+		b = append(b, make([]byte, 24)...)
+		b = binary.LittleEndian.AppendUint32(b, tableLength)
+		b = append(b, 1, 2, 3)
+
+		var before, after runtime.MemStats
+		runtime.ReadMemStats(&before)
+		var header wav.WAVHeader
+		err := header.UnmarshalBinary(bytes.NewReader(b))
+		runtime.ReadMemStats(&after)
+
+		if err != io.ErrUnexpectedEOF {
+			t.Errorf("table length %d: expected unexpected EOF, got %v", tableLength, err)
+		}
+		if n := after.TotalAlloc - before.TotalAlloc; n > 1<<20 {
+			t.Errorf("table length %d: allocated %d bytes for truncated ds64", tableLength, n)
+		}
+	}
+}